@@ -2,14 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 )
 
 // Estruturas para Analytics
 type AnalyticsOverview struct {
 	TotalHabits      int     `json:"total_habits"`
 	ActiveHabits     int     `json:"active_habits"`
+	ArchivedHabits   int     `json:"archived_habits"`
 	TotalEntries     int     `json:"total_entries"`
 	CurrentStreak    int     `json:"current_streak"`
 	LongestStreak    int     `json:"longest_streak"`
@@ -24,12 +28,17 @@ type HabitTrend struct {
 	Category    string `json:"category"`
 	TotalCount  int    `json:"total_count"`
 	WeeklyCount int    `json:"weekly_count"`
+	Polarity    string  `json:"polarity"` // nos hábitos "quit" as contagens são recaídas
+	Unit        string  `json:"unit,omitempty"`
+	TotalValue  float64 `json:"total_value"`  // soma na unidade do hábito
+	WeeklyValue float64 `json:"weekly_value"`
 	Trend       string `json:"trend"` // "up", "down", "stable"
 }
 
 type ActivityCalendar struct {
 	Date  string `json:"date"`
 	Count int    `json:"count"`
+	Totals map[string]float64 `json:"totals,omitempty"` // soma do dia por unidade (hábitos quantitativos)
 	Level int    `json:"level"` // 0-4 (intensidade para heatmap)
 }
 
@@ -54,6 +63,7 @@ type AnalyticsResponse struct {
 	ActivityCalendar []ActivityCalendar `json:"activity_calendar"`
 	WeeklyStats      []WeeklyStats      `json:"weekly_stats"`
 	CategoryStats    []CategoryStats    `json:"category_stats"`
+	QuitHabits       []QuitHabitStats   `json:"quit_habits"`
 }
 
 // Endpoint principal de analytics
@@ -71,12 +81,21 @@ func getAnalytics(w http.ResponseWriter, r *http.Request) {
 		days = 30
 	}
 	
+	// Estatísticas por categoria (padrão) ou por etiqueta (?group_by=tag)
+	groupBy := r.URL.Query().Get("group_by")
+	
+	// Dias e semanas no fuso e no início de semana do usuário
+	cal := userCalendar(userID)
+	// Dias pulados, congelados e pausados ficam fora dos streaks e taxas
+	ex := userExcuses(userID)
+	
 	analytics := AnalyticsResponse{
-		Overview:         getOverview(userID, days),
+		Overview:         getOverview(userID, days, cal, ex),
 		HabitTrends:      getHabitTrends(userID, days),
-		ActivityCalendar: getActivityCalendar(userID, days),
-		WeeklyStats:      getWeeklyStats(userID, days),
-		CategoryStats:    getCategoryStats(userID, days),
+		ActivityCalendar: getActivityCalendar(userID, days, cal),
+		WeeklyStats:      getWeeklyStats(userID, days, cal, ex),
+		CategoryStats:    getCategoryStats(userID, days, groupBy, cal, ex),
+		QuitHabits:       getQuitHabitStats(userID, days, cal),
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -84,113 +103,123 @@ func getAnalytics(w http.ResponseWriter, r *http.Request) {
 }
 
 // Calcular overview geral
-func getOverview(userID int, days int) AnalyticsOverview {
+func getOverview(userID int, days int, cal Calendar, ex *Excuses) AnalyticsOverview {
 	var overview AnalyticsOverview
+	now := time.Now()
 	
-	// Total de hábitos
-	db.QueryRow("SELECT COUNT(*) FROM habits WHERE user_id = ? AND is_active = 1", userID).Scan(&overview.TotalHabits)
+	// Total de hábitos, inclusive os arquivados
+	overview.TotalHabits, _ = store.CountHabits(userID)
 	
-	// Hábitos ativos (com entradas nos últimos 7 dias)
-	db.QueryRow(`
-		SELECT COUNT(DISTINCT h.id) 
-		FROM habits h 
-		JOIN habit_entries he ON h.id = he.habit_id 
-		WHERE h.user_id = ? AND he.completed_at >= DATE_SUB(NOW(), INTERVAL 7 DAY)
-	`, userID).Scan(&overview.ActiveHabits)
+	// Hábitos ativos (com entradas nos últimos 7 dias), do mesmo conjunto do total
+	overview.ActiveHabits, _ = store.CountHabitsWithEntriesSince(userID, now.AddDate(0, 0, -7))
 	
-	// Total de entradas no período
-	db.QueryRow(`
-		SELECT COUNT(*) 
-		FROM habit_entries he 
-		JOIN habits h ON he.habit_id = h.id 
-		WHERE h.user_id = ? AND he.completed_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, userID, days).Scan(&overview.TotalEntries)
+	habits, _ := store.ListHabits(userID)
+	for _, habit := range habits {
+		if !habit.IsActive {
+			overview.ArchivedHabits++
+		}
+	}
 	
-	// Streak atual (dias consecutivos com pelo menos 1 entrada)
-	overview.CurrentStreak = getCurrentStreakForUser(userID)
+	// Total de entradas no período (inclusive dos hábitos arquivados)
+	if entries, err := store.ListUserEntries(userID, now.AddDate(0, 0, -days)); err == nil {
+		overview.TotalEntries = len(entries)
+	}
 	
-	// Maior streak
-	overview.LongestStreak = getLongestStreakForUser(userID)
+	// Streaks (dias consecutivos com pelo menos 1 entrada, pulando os dias
+	// em que nenhum hábito estava previsto ou todos estavam dispensados)
+	if entries, err := store.ListUserEntries(userID, time.Time{}); err == nil {
+		dates := completionDates(entryTimes(withoutRelapses(entries, habits)), cal.Loc)
+		overview.CurrentStreak, overview.LongestStreak = dueDayStreaks(dates, cal.today(), anyHabitDue(habits, cal, ex))
+	}
 	
 	// Taxa de conclusão (últimos 30 dias)
-	overview.CompletionRate = calculateCompletionRate(userID, 30)
+	overview.CompletionRate = calculateCompletionRate(userID, 30, cal, ex)
 	
 	// Progresso semanal
-	overview.WeeklyProgress = calculateCompletionRate(userID, 7)
+	overview.WeeklyProgress = calculateCompletionRate(userID, 7, cal, ex)
 	
 	// Progresso mensal
-	overview.MonthlyProgress = calculateCompletionRate(userID, 30)
+	overview.MonthlyProgress = calculateCompletionRate(userID, 30, cal, ex)
 	
 	return overview
 }
 
 // Calcular tendências de hábitos
 func getHabitTrends(userID int, days int) []HabitTrend {
-	query := `
-		SELECT h.id, h.name, h.category,
-			   COUNT(he.id) as total_count,
-			   COUNT(CASE WHEN he.completed_at >= DATE_SUB(NOW(), INTERVAL 7 DAY) THEN 1 END) as weekly_count
-		FROM habits h
-		LEFT JOIN habit_entries he ON h.id = he.habit_id AND he.completed_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		WHERE h.user_id = ? AND h.is_active = 1
-		GROUP BY h.id, h.name, h.category
-		ORDER BY total_count DESC
-		LIMIT 10
-	`
-	
-	rows, err := db.Query(query, days, userID)
+	now := time.Now()
+	trends, err := store.ListHabitTrends(userID, now.AddDate(0, 0, -days), now.AddDate(0, 0, -7))
 	if err != nil {
 		return []HabitTrend{}
 	}
-	defer rows.Close()
 	
-	var trends []HabitTrend
-	for rows.Next() {
-		var trend HabitTrend
-		rows.Scan(&trend.HabitID, &trend.HabitName, &trend.Category, &trend.TotalCount, &trend.WeeklyCount)
+	for i := range trends {
+		trend := &trends[i]
 		
-		// Calcular tendência
-		if trend.WeeklyCount > trend.TotalCount/4 {
+		// Calcular tendência (pela soma dos valores nos hábitos com unidade)
+		if trend.Unit != "" {
+			trend.Trend = valueTrend(trend.WeeklyValue, trend.TotalValue)
+		} else if trend.WeeklyCount > trend.TotalCount/4 {
 			trend.Trend = "up"
 		} else if trend.WeeklyCount < trend.TotalCount/6 {
 			trend.Trend = "down"
 		} else {
 			trend.Trend = "stable"
 		}
-		
-		trends = append(trends, trend)
 	}
 	
 	return trends
 }
 
+func valueTrend(weekly, total float64) string {
+	if weekly > total/4 {
+		return "up"
+	} else if weekly < total/6 {
+		return "down"
+	}
+	return "stable"
+}
+
 // Gerar calendário de atividades (heatmap)
-func getActivityCalendar(userID int, days int) []ActivityCalendar {
-	query := `
-		SELECT DATE(he.completed_at) as date, COUNT(*) as count
-		FROM habit_entries he
-		JOIN habits h ON he.habit_id = h.id
-		WHERE h.user_id = ? AND he.completed_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		GROUP BY DATE(he.completed_at)
-		ORDER BY date
-	`
-	
-	rows, err := db.Query(query, userID, days)
+func getActivityCalendar(userID int, days int, cal Calendar) []ActivityCalendar {
+	entries, err := store.ListUserEntries(userID, time.Now().AddDate(0, 0, -days))
 	if err != nil {
 		return []ActivityCalendar{}
 	}
-	defer rows.Close()
 	
+	// Unidade de cada hábito quantitativo; recaídas não entram no heatmap
+	units := map[int]string{}
+	if habits, err := store.ListHabits(userID); err == nil {
+		entries = withoutRelapses(entries, habits)
+		for _, habit := range habits {
+			if habit.Unit != "" {
+				units[habit.ID] = habit.Unit
+			}
+		}
+	}
+	
+	// Agrupar por dia, do mais antigo para o mais recente
 	var calendar []ActivityCalendar
 	maxCount := 0
 	
-	for rows.Next() {
-		var activity ActivityCalendar
-		rows.Scan(&activity.Date, &activity.Count)
+	for i := len(entries) - 1; i >= 0; i-- {
+		date := cal.day(entries[i].CompletedAt).Format("2006-01-02")
+		if len(calendar) == 0 || calendar[len(calendar)-1].Date != date {
+			calendar = append(calendar, ActivityCalendar{Date: date})
+		}
+		day := &calendar[len(calendar)-1]
+		day.Count++
+		if unit, ok := units[entries[i].HabitID]; ok {
+			if day.Totals == nil {
+				day.Totals = map[string]float64{}
+			}
+			day.Totals[unit] += entries[i].Value
+		}
+	}
+	
+	for _, activity := range calendar {
 		if activity.Count > maxCount {
 			maxCount = activity.Count
 		}
-		calendar = append(calendar, activity)
 	}
 	
 	// Calcular níveis (0-4) baseado na contagem máxima
@@ -207,171 +236,237 @@ func getActivityCalendar(userID int, days int) []ActivityCalendar {
 }
 
 // Estatísticas semanais
-func getWeeklyStats(userID int, days int) []WeeklyStats {
-	query := `
-		SELECT 
-			DATE_SUB(DATE(he.completed_at), INTERVAL WEEKDAY(he.completed_at) DAY) as week_start,
-			COUNT(he.id) as completed,
-			COUNT(DISTINCT h.id) * 7 as total
-		FROM habit_entries he
-		JOIN habits h ON he.habit_id = h.id
-		WHERE h.user_id = ? AND he.completed_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		GROUP BY week_start
-		ORDER BY week_start DESC
-		LIMIT 8
-	`
-	
-	rows, err := db.Query(query, userID, days)
+func getWeeklyStats(userID int, days int, cal Calendar, ex *Excuses) []WeeklyStats {
+	entries, err := store.ListUserEntries(userID, time.Now().AddDate(0, 0, -days))
 	if err != nil {
 		return []WeeklyStats{}
 	}
-	defer rows.Close()
+	allHabits, _ := store.ListHabits(userID)
+	entries = withoutRelapses(entries, allHabits)
 	
+	// Agrupar por semana (a partir do dia escolhido pelo usuário), da mais recente para a mais antiga
 	var stats []WeeklyStats
-	for rows.Next() {
-		var week WeeklyStats
-		rows.Scan(&week.WeekStart, &week.Completed, &week.Total)
+	dates := map[string]map[int][]time.Time{}
+	for _, entry := range entries {
+		day := cal.day(entry.CompletedAt)
+		first, _ := cal.bounds(unitWeek, day)
+		weekStart := first.Format("2006-01-02")
+		if len(stats) == 0 || stats[len(stats)-1].WeekStart != weekStart {
+			if len(stats) == 8 {
+				break
+			}
+			stats = append(stats, WeeklyStats{WeekStart: weekStart})
+			dates[weekStart] = map[int][]time.Time{}
+		}
+		dates[weekStart][entry.HabitID] = append(dates[weekStart][entry.HabitID], day)
+	}
+	
+	for i := range stats {
+		week := &stats[i]
+		weekStart, _ := time.Parse("2006-01-02", week.WeekStart)
+		for _, habit := range allHabits {
+			if days, ok := dates[week.WeekStart][habit.ID]; ok {
+				done, expected := habitCompletions(habit, days, weekStart, weekStart.AddDate(0, 0, 6), cal, ex)
+				week.Completed += done
+				week.Total += expected
+			}
+		}
 		
 		if week.Total > 0 {
 			week.CompletionRate = float64(week.Completed) / float64(week.Total) * 100
 		}
-		
-		stats = append(stats, week)
 	}
 	
 	return stats
 }
 
 // Estatísticas por categoria
-func getCategoryStats(userID int, days int) []CategoryStats {
-	query := `
-		SELECT 
-			h.category,
-			COUNT(DISTINCT h.id) as habit_count,
-			COUNT(he.id) as completed,
-			COUNT(DISTINCT h.id) * ? as total
-		FROM habits h
-		LEFT JOIN habit_entries he ON h.id = he.habit_id AND he.completed_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		WHERE h.user_id = ? AND h.is_active = 1
-		GROUP BY h.category
-		ORDER BY completed DESC
-	`
-	
-	rows, err := db.Query(query, days, days, userID)
+func getCategoryStats(userID int, days int, groupBy string, cal Calendar, ex *Excuses) []CategoryStats {
+	since := time.Now().AddDate(0, 0, -days)
+	stats, err := store.ListCategoryStats(userID, since)
+	inGroup := func(habit Habit, name string) bool {
+		return habit.Category == name
+	}
+	if groupBy == "tag" {
+		// Cada linha é uma etiqueta; Category traz o nome dela
+		stats, err = store.ListTagStats(userID, since)
+		inGroup = func(habit Habit, name string) bool {
+			for _, tag := range habit.Tags {
+				if tag == name {
+					return true
+				}
+			}
+			return false
+		}
+	}
 	if err != nil {
 		return []CategoryStats{}
 	}
-	defer rows.Close()
 	
-	var stats []CategoryStats
-	for rows.Next() {
-		var category CategoryStats
-		rows.Scan(&category.Category, &category.HabitCount, &category.Completed, &category.Total)
+	// Dias concluídos de cada hábito no período; a consulta conta entradas
+	// avulsas, então a contagem é refeita aqui pela agenda
+	dates := map[int][]time.Time{}
+	if entries, err := store.ListUserEntries(userID, since); err == nil {
+		for _, entry := range entries {
+			dates[entry.HabitID] = append(dates[entry.HabitID], cal.day(entry.CompletedAt))
+		}
+	}
+	
+	habits, _ := store.ListHabits(userID)
+	today := cal.today()
+	for i := range stats {
+		category := &stats[i]
+		category.Completed = 0
+		for _, habit := range habits {
+			if habit.IsActive && !habit.isQuit() && inGroup(habit, category.Category) {
+				done, expected := habitCompletions(habit, dates[habit.ID], today.AddDate(0, 0, -(days-1)), today, cal, ex)
+				category.Completed += done
+				category.Total += expected
+			}
+		}
 		
 		if category.Total > 0 {
 			category.CompletionRate = float64(category.Completed) / float64(category.Total) * 100
 		}
-		
-		stats = append(stats, category)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Completed > stats[j].Completed
+	})
+	
+	return stats
+}
+
+// Abstinência dos hábitos negativos ativos
+func getQuitHabitStats(userID int, days int, cal Calendar) []QuitHabitStats {
+	stats := []QuitHabitStats{}
+	habits, err := store.ListHabits(userID)
+	if err != nil {
+		return stats
+	}
+	
+	for _, habit := range habits {
+		if !habit.IsActive || !habit.isQuit() {
+			continue
+		}
+		quit, err := quitHabitStats(&habit, days, cal)
+		if err != nil {
+			continue
+		}
+		stats = append(stats, quit)
 	}
 	
 	return stats
 }
 
 // Funções auxiliares
-func getCurrentStreakForUser(userID int) int {
-	// Buscar datas únicas com entradas
-	rows, err := db.Query(`
-		SELECT DISTINCT DATE(he.completed_at) as date
-		FROM habit_entries he
-		JOIN habits h ON he.habit_id = h.id
-		WHERE h.user_id = ?
-		ORDER BY date DESC
-		LIMIT 365
-	`, userID)
+
+// Entradas sem as recaídas dos hábitos negativos, que não são conclusões
+func withoutRelapses(entries []HabitEntry, habits []Habit) []HabitEntry {
+	quit := map[int]bool{}
+	for _, habit := range habits {
+		if habit.isQuit() {
+			quit[habit.ID] = true
+		}
+	}
+	if len(quit) == 0 {
+		return entries
+	}
+	
+	var filtered []HabitEntry
+	for _, entry := range entries {
+		if !quit[entry.HabitID] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+func entryTimes(entries []HabitEntry) []time.Time {
+	times := make([]time.Time, len(entries))
+	for i, entry := range entries {
+		times[i] = entry.CompletedAt
+	}
+	return times
+}
+
+// Taxa de conclusão considerando só os dias em que cada hábito ativo
+// estava previsto na agenda, a partir da sua criação, e não dispensado
+func calculateCompletionRate(userID int, days int, cal Calendar, ex *Excuses) float64 {
+	var completed, total float64
 	
+	habits, err := store.ListHabits(userID)
 	if err != nil {
 		return 0
 	}
-	defer rows.Close()
 	
-	var dates []string
-	for rows.Next() {
-		var date string
-		rows.Scan(&date)
-		dates = append(dates, date)
+	// Dias de conclusão de cada hábito no período
+	dates := map[int][]time.Time{}
+	if entries, err := store.ListUserEntries(userID, time.Now().AddDate(0, 0, -days)); err == nil {
+		for _, entry := range entries {
+			dates[entry.HabitID] = append(dates[entry.HabitID], cal.day(entry.CompletedAt))
+		}
 	}
 	
-	if len(dates) == 0 {
-		return 0
+	today := cal.today()
+	for _, habit := range habits {
+		if !habit.IsActive {
+			continue
+		}
+		from := habitWindowStart(habit, today.AddDate(0, 0, -(days-1)), cal)
+		done, expected := habit.Schedule.completion(dates[habit.ID], from, today, cal, ex.habit(habit.ID))
+		if habit.isQuit() {
+			// Dia sem recaída conta como cumprido
+			done, expected = quitCompletion(dates[habit.ID], from, today, ex.habit(habit.ID))
+		}
+		completed += done
+		total += expected
 	}
 	
-	// Calcular streak atual
-	streak := 1
-	for i := 1; i < len(dates); i++ {
-		// Verificar se é dia consecutivo (diferença de 1 dia)
-		// Implementação simplificada
-		streak++
-		if i > 10 { // Limitar para performance
-			break
-		}
+	if total > 0 {
+		return completed / total * 100
 	}
 	
-	return streak
+	return 0
 }
 
-func getLongestStreakForUser(userID int) int {
-	var longestStreak int
-	db.QueryRow(`
-		SELECT COUNT(*) as max_streak
-		FROM habit_entries he
-		JOIN habits h ON he.habit_id = h.id
-		WHERE h.user_id = ?
-		GROUP BY DATE(he.completed_at)
-		ORDER BY max_streak DESC
-		LIMIT 1
-	`, userID).Scan(&longestStreak)
-	
-	return longestStreak
+// Início da janela de cálculo, sem contar dias antes da criação do hábito
+func habitWindowStart(habit Habit, from time.Time, cal Calendar) time.Time {
+	if created := cal.day(habit.CreatedAt); created.After(from) {
+		return created
+	}
+	return from
 }
 
-func calculateLongestStreak(userID int) int {
-	// Implementação simplificada - pode ser otimizada
-	var longestStreak int
-	db.QueryRow(`
-		SELECT IFNULL(MAX(streak_length), 0) FROM (
-			SELECT COUNT(*) as streak_length
-			FROM habit_entries he
-			JOIN habits h ON he.habit_id = h.id
-			WHERE h.user_id = ?
-			GROUP BY DATE(he.completed_at)
-		) streaks
-	`, userID).Scan(&longestStreak)
-	
-	return longestStreak
+// Conclusões efetivas e esperadas do hábito em [from, to], arredondadas,
+// sem os dias dispensados. Cada dia previsto conta uma vez, só dentro da
+// janela e nunca acima do esperado.
+func habitCompletions(habit Habit, dates []time.Time, from, to time.Time, cal Calendar, ex *Excuses) (int, int) {
+	from = habitWindowStart(habit, from, cal)
+	if from.After(to) {
+		return 0, 0
+	}
+	done, expected := habit.Schedule.completion(dates, from, to, cal, ex.habit(habit.ID))
+	return min(int(math.Round(done)), int(math.Round(expected))), int(math.Round(expected))
 }
 
-func calculateCompletionRate(userID int, days int) float64 {
-	var completed, total int
-	
-	// Entradas completadas
-	db.QueryRow(`
-		SELECT COUNT(*)
-		FROM habit_entries he
-		JOIN habits h ON he.habit_id = h.id
-		WHERE h.user_id = ? AND he.completed_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, userID, days).Scan(&completed)
-	
-	// Total possível (hábitos * dias)
-	db.QueryRow(`
-		SELECT COUNT(*) * ?
-		FROM habits h
-		WHERE h.user_id = ? AND h.is_active = 1
-	`, days, userID).Scan(&total)
-	
-	if total > 0 {
-		return float64(completed) / float64(total) * 100
+// Dia previsto para o streak geral: algum hábito ativo com agenda por dia
+// estava previsto e não dispensado. Hábitos por frequência não marcam dias
+// específicos; sem nenhum hábito por dia, todo dia conta.
+func anyHabitDue(habits []Habit, cal Calendar, ex *Excuses) func(time.Time) bool {
+	var daily []Habit
+	for _, habit := range habits {
+		if habit.IsActive && !habit.isQuit() && !habit.Schedule.isFrequency() {
+			daily = append(daily, habit)
+		}
+	}
+	return func(day time.Time) bool {
+		if len(daily) == 0 {
+			return true
+		}
+		for _, habit := range daily {
+			if !day.Before(cal.day(habit.CreatedAt)) && habit.Schedule.isDue(day) && !ex.habit(habit.ID).has(day) {
+				return true
+			}
+		}
+		return false
 	}
-	
-	return 0
 }
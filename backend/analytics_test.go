@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Hábito diário criado há dois dias, com uma entrada retroativa antes da
+// criação e várias entradas hoje: só os dias previstos concluídos contam
+func TestCompletionStatsCountDueDays(t *testing.T) {
+	useTestStore(t)
+	user := createTestUser(t, "ana")
+	now := time.Now()
+	midnight := dayStart(localToday(time.UTC), time.UTC)
+
+	habit := &Habit{UserID: user.ID, Name: "Correr", Category: "saude", Visibility: "private", IsActive: true, CreatedAt: now.AddDate(0, 0, -2)}
+	if err := store.CreateHabit(habit); err != nil {
+		t.Fatalf("create habit: %v", err)
+	}
+	for _, at := range []time.Time{
+		now.AddDate(0, 0, -10), // antes da criação
+		now.AddDate(0, 0, -1),
+		midnight,
+		midnight.Add(time.Second),
+		midnight.Add(2 * time.Second),
+	} {
+		if err := store.CreateEntry(&HabitEntry{HabitID: habit.ID, CompletedAt: at}); err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+	}
+
+	cal := Calendar{Loc: time.UTC, WeekStart: time.Monday}
+	ex := userExcuses(user.ID)
+
+	categories := getCategoryStats(user.ID, 30, "", cal, ex)
+	if len(categories) != 1 {
+		t.Fatalf("got %d categories, want 1", len(categories))
+	}
+	if got := categories[0]; got.Completed != 2 || got.Total != 3 {
+		t.Errorf("category completed/total = %d/%d, want 2/3", got.Completed, got.Total)
+	}
+
+	completed := 0
+	for _, week := range getWeeklyStats(user.ID, 30, cal, ex) {
+		if week.Completed > week.Total || week.CompletionRate > 100 {
+			t.Errorf("week %s: completed %d of %d (%.0f%%)", week.WeekStart, week.Completed, week.Total, week.CompletionRate)
+		}
+		completed += week.Completed
+	}
+	if completed != 2 {
+		t.Errorf("weekly completed = %d, want 2", completed)
+	}
+}
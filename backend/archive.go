@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Arquivamento e remoção reversível de hábitos. Arquivado, o hábito sai da
+// lista padrão, das metas e das estatísticas do período, mas as entradas
+// continuam contando no histórico (total de entradas e streaks gerais).
+// Removido, some de tudo e pode ser restaurado por config.HabitRestoreWindow;
+// depois disso o job de limpeza apaga o hábito e todo o histórico.
+
+func archiveHabit(w http.ResponseWriter, r *http.Request) {
+	setHabitArchived(w, r, true)
+}
+
+func unarchiveHabit(w http.ResponseWriter, r *http.Request) {
+	setHabitArchived(w, r, false)
+}
+
+func setHabitArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := store.ArchiveHabit(habit.UserID, habit.ID, archived); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error updating habit", http.StatusInternalServerError)
+		return
+	}
+
+	habit, err := store.GetHabit(habit.UserID, habit.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(habit)
+}
+
+// Hábitos removidos que ainda podem ser restaurados, com o prazo (purge_at)
+func getDeletedHabits(w http.ResponseWriter, r *http.Request) {
+	habits, err := store.ListDeletedHabits(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	restorable := []Habit{}
+	now := time.Now()
+	for _, habit := range habits {
+		purgeAt := habit.DeletedAt.Add(config.HabitRestoreWindow)
+		if purgeAt.Before(now) {
+			// Aguardando o job de limpeza
+			continue
+		}
+		habit.PurgeAt = &purgeAt
+		restorable = append(restorable, habit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restorable)
+}
+
+func restoreHabit(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+	habitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.RestoreHabit(userID, habitID, time.Now().Add(-config.HabitRestoreWindow)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Deleted habit not found or restore window expired", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error restoring habit", http.StatusInternalServerError)
+		return
+	}
+
+	habit, err := store.GetHabit(userID, habitID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(habit)
+}
+
+func startHabitPurgeJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purgeDeletedHabits(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// Apaga os hábitos removidos há mais de config.HabitRestoreWindow
+func purgeDeletedHabits(now time.Time) {
+	purged, err := store.PurgeDeletedHabits(now.Add(-config.HabitRestoreWindow))
+	if err != nil {
+		log.Printf("Habit purge job: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Habit purge job: purged %d deleted habit(s)", purged)
+	}
+}
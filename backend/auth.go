@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Sessões: o login gera um access token JWT de vida curta (com o id da
+// sessão) e um refresh token opaco, guardado no banco só como hash. Cada
+// refresh troca o refresh token; apresentar um token já trocado revoga a
+// sessão inteira.
+
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	UserAgent  string     `json:"device"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Intervalo mínimo entre atualizações de last_used_at pelo middleware
+const sessionTouchInterval = time.Minute
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IP do cliente; X-Forwarded-For só é considerado atrás de proxy confiável
+func clientIP(r *http.Request) string {
+	if config.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Cria uma sessão para o usuário e devolve a resposta de autenticação
+func startSession(r *http.Request, user User) (*AuthResponse, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session := Session{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        clientIP(r),
+		ExpiresAt: time.Now().Add(config.RefreshTokenLifetime),
+	}
+	if err := store.CreateSession(&session, hashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	token, err := generateJWT(user.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(config.TokenLifetime.Seconds()),
+		User:         user,
+	}, nil
+}
+
+// Verifica se a sessão do access token continua válida
+func checkSession(userID, sessionID int) bool {
+	session, err := store.GetSession(sessionID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Error loading session %d: %v", sessionID, err)
+		}
+		return false
+	}
+	if session.UserID != userID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return false
+	}
+
+	if now := time.Now(); now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		if err := store.TouchSession(sessionID, now); err != nil {
+			log.Printf("Error updating session %d: %v", sessionID, err)
+		}
+	}
+	return true
+}
+
+func getSessionID(r *http.Request) int {
+	sessionID, _ := strconv.Atoi(r.Header.Get("session_id"))
+	return sessionID
+}
+
+// Troca um refresh token válido por um novo par de tokens
+func refreshSession(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	oldHash := hashToken(req.RefreshToken)
+	session, reused, err := store.FindSessionByRefreshHash(oldHash)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if reused {
+		// Token antigo reapresentado: alguém mais pode tê-lo
+		log.Printf("Refresh token reuse detected for session %d (user %d)", session.ID, session.UserID)
+		store.RevokeSession(session.UserID, session.ID)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		http.Error(w, "Session expired", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := store.GetUser(session.UserID)
+	if err != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	if err := store.RotateSessionToken(session.ID, oldHash, hashToken(refreshToken), time.Now().Add(config.RefreshTokenLifetime)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := generateJWT(user.ID, session.ID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(config.TokenLifetime.Seconds()),
+		User:         *user,
+	})
+}
+
+// Encerra a sessão atual
+func logout(w http.ResponseWriter, r *http.Request) {
+	if err := store.RevokeSession(getUserID(r), getSessionID(r)); err != nil && !errors.Is(err, ErrNotFound) {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Encerra todas as sessões do usuário, inclusive a atual
+func logoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := store.RevokeUserSessions(getUserID(r)); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := store.ListSessions(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := getSessionID(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	if sessions == nil {
+		sessions = []Session{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func revokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.RevokeSession(getUserID(r), sessionID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuração do servidor. A ordem de precedência é: valores padrão,
+// arquivo JSON opcional (-config ou CONFIG_FILE), variáveis de ambiente
+// e por fim as flags de linha de comando.
+
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+type Config struct {
+	Env         string   `json:"env"` // development, staging ou production
+	Port        string   `json:"port"`
+	DBDriver    string   `json:"db_driver"`
+	DBDSN       string   `json:"db_dsn"`
+	JWTSecret   string   `json:"jwt_secret"`
+	CORSOrigins []string `json:"cors_origins"` // aceita "*" no final como prefixo
+	TrustProxy  bool     `json:"trust_proxy"`  // usar X-Forwarded-For como IP do cliente
+
+	TokenLifetime        time.Duration `json:"-"` // access token
+	RefreshTokenLifetime time.Duration `json:"-"`
+
+	// URL do frontend, usada nos links enviados por e-mail
+	AppURL string `json:"app_url"`
+	// Diretório dos arquivos enviados pelos usuários (avatares)
+	UploadDir string `json:"upload_dir"`
+
+	MailDriver   string `json:"mail_driver"` // log, file ou smtp
+	MailFrom     string `json:"mail_from"`
+	MailDir      string `json:"mail_dir"` // destino do driver file
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     string `json:"smtp_port"`
+	SMTPUser     string `json:"smtp_user"`
+	SMTPPassword string `json:"smtp_password"`
+
+	// Limites das rotas públicas de autenticação. Os contadores ficam em
+	// memória (uma instância) ou no banco (várias instâncias).
+	RateLimitStore     string        `json:"rate_limit_store"` // memory ou database
+	AuthRateLimit      int           `json:"auth_rate_limit"`  // pedidos por IP a cada AuthRateWindow
+	AuthRateWindow     time.Duration `json:"-"`
+	LoginMaxFailures   int           `json:"login_max_failures"`        // por conta, em LoginFailureWindow
+	LoginMaxFailuresIP int           `json:"login_max_failures_per_ip"` // por IP, somando todas as contas
+	LoginFailureWindow time.Duration `json:"-"`
+	LockoutDuration    time.Duration `json:"-"` // primeiro bloqueio; dobra a cada novo bloqueio
+	LockoutMaxDuration time.Duration `json:"-"`
+
+	// Intervalo do job que grava o resultado das metas ao fim de cada
+	// período; zero desativa (outra instância já roda o job)
+	GoalJobInterval time.Duration `json:"-"`
+
+	// Hábitos removidos podem ser restaurados por HabitRestoreWindow; o job
+	// de limpeza roda a cada HabitPurgeInterval (zero desativa)
+	HabitRestoreWindow time.Duration `json:"-"`
+	HabitPurgeInterval time.Duration `json:"-"`
+
+	// Agendador de lembretes: intervalo entre rodadas (zero desativa), atraso
+	// máximo para enviar um horário perdido e canal de envio (log, mail ou
+	// push)
+	ReminderInterval time.Duration `json:"-"`
+	ReminderCatchUp  time.Duration `json:"-"`
+	NotifyDriver     string        `json:"notify_driver"`
+
+	// Chaves VAPID do Web Push em base64url; sem elas o servidor gera um par
+	// e guarda no banco. O subject (mailto: ou https:) identifica o
+	// servidor para os serviços de push.
+	VAPIDPublicKey  string `json:"vapid_public_key"`
+	VAPIDPrivateKey string `json:"vapid_private_key"`
+	VAPIDSubject    string `json:"vapid_subject"`
+
+	// Resumo por e-mail: intervalo do job (zero desativa) e hora local a
+	// partir da qual o resumo do dia (ou da semana, no primeiro dia dela) é
+	// enviado
+	DigestInterval time.Duration `json:"-"`
+	DigestHour     int           `json:"digest_hour"`
+}
+
+// Formato do arquivo: durações como texto ("168h")
+type configFile struct {
+	Config
+	TokenLifetime        string `json:"token_lifetime"`
+	RefreshTokenLifetime string `json:"refresh_token_lifetime"`
+	AuthRateWindow       string `json:"auth_rate_window"`
+	LoginFailureWindow   string `json:"login_failure_window"`
+	LockoutDuration      string `json:"lockout_duration"`
+	LockoutMaxDuration   string `json:"lockout_max_duration"`
+	GoalJobInterval      string `json:"goal_job_interval"`
+	HabitRestoreWindow   string `json:"habit_restore_window"`
+	HabitPurgeInterval   string `json:"habit_purge_interval"`
+	ReminderInterval     string `json:"reminder_interval"`
+	ReminderCatchUp      string `json:"reminder_catch_up"`
+	DigestInterval       string `json:"digest_interval"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Env:                  "development",
+		Port:                 "8080",
+		DBDriver:             "mysql",
+		JWTSecret:            defaultJWTSecret,
+		CORSOrigins:          []string{"http://localhost:3000", "http://192.168.0.*"},
+		TokenLifetime:        15 * time.Minute,
+		RefreshTokenLifetime: 30 * 24 * time.Hour,
+		AppURL:               "http://localhost:3000",
+		UploadDir:            "uploads",
+		MailDriver:           "log",
+		MailFrom:             "Habit Tracker <no-reply@localhost>",
+		MailDir:              "mail",
+		SMTPPort:             "587",
+		RateLimitStore:       "memory",
+		AuthRateLimit:        20,
+		AuthRateWindow:       time.Minute,
+		LoginMaxFailures:     5,
+		LoginMaxFailuresIP:   50,
+		LoginFailureWindow:   15 * time.Minute,
+		LockoutDuration:      time.Minute,
+		LockoutMaxDuration:   time.Hour,
+		GoalJobInterval:      15 * time.Minute,
+		HabitRestoreWindow:   30 * 24 * time.Hour,
+		HabitPurgeInterval:   time.Hour,
+		ReminderInterval:     time.Minute,
+		ReminderCatchUp:      30 * time.Minute,
+		NotifyDriver:         "log",
+		DigestInterval:       15 * time.Minute,
+		DigestHour:           7,
+	}
+}
+
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, fmt.Errorf("reading config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	file := configFile{Config: *c}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	*c = file.Config
+
+	values := map[string]string{
+		"token_lifetime":         file.TokenLifetime,
+		"refresh_token_lifetime": file.RefreshTokenLifetime,
+		"auth_rate_window":       file.AuthRateWindow,
+		"login_failure_window":   file.LoginFailureWindow,
+		"lockout_duration":       file.LockoutDuration,
+		"lockout_max_duration":   file.LockoutMaxDuration,
+		"goal_job_interval":      file.GoalJobInterval,
+		"habit_restore_window":   file.HabitRestoreWindow,
+		"habit_purge_interval":   file.HabitPurgeInterval,
+		"reminder_interval":      file.ReminderInterval,
+		"reminder_catch_up":      file.ReminderCatchUp,
+		"digest_interval":        file.DigestInterval,
+	}
+	for name, field := range c.durations() {
+		if err := parseDuration(field, values[name], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Campos de duração pelo nome no arquivo; a variável de ambiente é o
+// mesmo nome em maiúsculas
+func (c *Config) durations() map[string]*time.Duration {
+	return map[string]*time.Duration{
+		"token_lifetime":         &c.TokenLifetime,
+		"refresh_token_lifetime": &c.RefreshTokenLifetime,
+		"auth_rate_window":       &c.AuthRateWindow,
+		"login_failure_window":   &c.LoginFailureWindow,
+		"lockout_duration":       &c.LockoutDuration,
+		"lockout_max_duration":   &c.LockoutMaxDuration,
+		"goal_job_interval":      &c.GoalJobInterval,
+		"habit_restore_window":   &c.HabitRestoreWindow,
+		"habit_purge_interval":   &c.HabitPurgeInterval,
+		"reminder_interval":      &c.ReminderInterval,
+		"reminder_catch_up":      &c.ReminderCatchUp,
+		"digest_interval":        &c.DigestInterval,
+	}
+}
+
+func (c *Config) loadEnv() error {
+	setFromEnv(&c.Env, "APP_ENV")
+	setFromEnv(&c.Port, "PORT")
+	setFromEnv(&c.DBDriver, "DB_DRIVER")
+	setFromEnv(&c.DBDSN, "DB_DSN")
+	setFromEnv(&c.JWTSecret, "JWT_SECRET")
+	setFromEnv(&c.AppURL, "APP_URL")
+	setFromEnv(&c.UploadDir, "UPLOAD_DIR")
+	setFromEnv(&c.MailDriver, "MAIL_DRIVER")
+	setFromEnv(&c.MailFrom, "MAIL_FROM")
+	setFromEnv(&c.MailDir, "MAIL_DIR")
+	setFromEnv(&c.SMTPHost, "SMTP_HOST")
+	setFromEnv(&c.SMTPPort, "SMTP_PORT")
+	setFromEnv(&c.SMTPUser, "SMTP_USER")
+	setFromEnv(&c.SMTPPassword, "SMTP_PASSWORD")
+	setFromEnv(&c.RateLimitStore, "RATE_LIMIT_STORE")
+	setFromEnv(&c.NotifyDriver, "NOTIFY_DRIVER")
+	setFromEnv(&c.VAPIDPublicKey, "VAPID_PUBLIC_KEY")
+	setFromEnv(&c.VAPIDPrivateKey, "VAPID_PRIVATE_KEY")
+	setFromEnv(&c.VAPIDSubject, "VAPID_SUBJECT")
+
+	if v := os.Getenv("CORS_ORIGINS"); v != "" {
+		c.CORSOrigins = splitList(v)
+	}
+	if v := os.Getenv("TRUST_PROXY"); v != "" {
+		c.TrustProxy = v == "1" || v == "true"
+	}
+	for name, field := range map[string]*int{
+		"AUTH_RATE_LIMIT":           &c.AuthRateLimit,
+		"LOGIN_MAX_FAILURES":        &c.LoginMaxFailures,
+		"LOGIN_MAX_FAILURES_PER_IP": &c.LoginMaxFailuresIP,
+		"DIGEST_HOUR":               &c.DigestHour,
+	} {
+		if err := parseInt(field, os.Getenv(name), name); err != nil {
+			return err
+		}
+	}
+	for name, field := range c.durations() {
+		name = strings.ToUpper(name)
+		if err := parseDuration(field, os.Getenv(name), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFromEnv(field *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*field = v
+	}
+}
+
+// Atualiza field quando value não é vazio
+func parseDuration(field *time.Duration, value, name string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*field = d
+	return nil
+}
+
+func parseInt(field *int, value, name string) error {
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*field = n
+	return nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *Config) isDev() bool {
+	return c.Env == "development" || c.Env == "dev"
+}
+
+// Completa valores derivados e rejeita configurações inválidas
+func (c *Config) validate() error {
+	var problems []string
+
+	switch c.Env {
+	case "development", "dev", "staging", "production":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown env %q", c.Env))
+	}
+
+	switch c.DBDriver {
+	case "mysql":
+		if c.DBDSN == "" && c.isDev() {
+			c.DBDSN = "root:rootpass123@tcp(localhost:3306)/habit_tracker?parseTime=true"
+		}
+	case "sqlite", "sqlite3":
+		if c.DBDSN == "" {
+			c.DBDSN = "habit_tracker.db"
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported db_driver %q", c.DBDriver))
+	}
+	if c.DBDSN == "" {
+		problems = append(problems, "db_dsn is required outside development")
+	}
+
+	if c.JWTSecret == "" {
+		problems = append(problems, "jwt_secret is required")
+	} else if !c.isDev() {
+		if c.JWTSecret == defaultJWTSecret {
+			problems = append(problems, "jwt_secret must be changed from the default outside development")
+		} else if len(c.JWTSecret) < 32 {
+			problems = append(problems, "jwt_secret must be at least 32 characters outside development")
+		}
+	}
+
+	if c.TokenLifetime <= 0 {
+		problems = append(problems, "token_lifetime must be positive")
+	}
+	if c.RefreshTokenLifetime < c.TokenLifetime {
+		problems = append(problems, "refresh_token_lifetime must not be shorter than token_lifetime")
+	}
+	if c.UploadDir == "" {
+		problems = append(problems, "upload_dir is required")
+	}
+	if c.Port == "" {
+		problems = append(problems, "port is required")
+	}
+
+	switch c.MailDriver {
+	case "log":
+		// O driver log grava os links de redefinição e verificação no log
+		if !c.isDev() {
+			problems = append(problems, "mail_driver log is only allowed in development (use smtp or file)")
+		}
+	case "file":
+	case "smtp":
+		if c.SMTPHost == "" {
+			problems = append(problems, "smtp_host is required for the smtp mail driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported mail_driver %q", c.MailDriver))
+	}
+	if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid mail_from %q", c.MailFrom))
+	}
+	c.AppURL = strings.TrimSuffix(c.AppURL, "/")
+
+	switch c.RateLimitStore {
+	case "memory", "database":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported rate_limit_store %q", c.RateLimitStore))
+	}
+	if c.AuthRateLimit <= 0 || c.AuthRateWindow <= 0 {
+		problems = append(problems, "auth_rate_limit and auth_rate_window must be positive")
+	}
+	if c.LoginMaxFailures <= 0 || c.LoginMaxFailuresIP <= 0 || c.LoginFailureWindow <= 0 {
+		problems = append(problems, "login_max_failures, login_max_failures_per_ip and login_failure_window must be positive")
+	}
+	if c.LockoutDuration <= 0 || c.LockoutMaxDuration < c.LockoutDuration {
+		problems = append(problems, "lockout_duration must be positive and not longer than lockout_max_duration")
+	}
+	if c.GoalJobInterval < 0 {
+		problems = append(problems, "goal_job_interval must not be negative")
+	}
+	if c.HabitRestoreWindow <= 0 || c.HabitPurgeInterval < 0 {
+		problems = append(problems, "habit_restore_window must be positive and habit_purge_interval must not be negative")
+	}
+	if c.ReminderInterval < 0 || c.ReminderCatchUp < c.ReminderInterval {
+		problems = append(problems, "reminder_interval must not be negative and reminder_catch_up must not be shorter than it")
+	}
+	switch c.NotifyDriver {
+	case "log", "mail", "push":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported notify_driver %q", c.NotifyDriver))
+	}
+	if c.VAPIDPublicKey != "" && c.VAPIDPrivateKey == "" {
+		problems = append(problems, "vapid_private_key is required when vapid_public_key is set")
+	} else if c.VAPIDPrivateKey != "" {
+		if _, err := parseVAPIDKeys(c.VAPIDPublicKey, c.VAPIDPrivateKey); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.VAPIDSubject == "" {
+		if strings.HasPrefix(c.AppURL, "https://") {
+			c.VAPIDSubject = c.AppURL
+		} else {
+			c.VAPIDSubject = "mailto:no-reply@localhost"
+		}
+	} else if !strings.HasPrefix(c.VAPIDSubject, "mailto:") && !strings.HasPrefix(c.VAPIDSubject, "https://") {
+		problems = append(problems, "vapid_subject must be a mailto: or https: URL")
+	}
+
+	if c.DigestInterval < 0 {
+		problems = append(problems, "digest_interval must not be negative")
+	}
+	if c.DigestHour < 0 || c.DigestHour > 23 {
+		problems = append(problems, "digest_hour must be between 0 and 23")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Usado pelo AllowOriginFunc do CORS
+func (c *Config) allowOrigin(origin string) bool {
+	for _, allowed := range c.CORSOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(origin, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,669 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Resumo por e-mail, opcional (digest_frequency em PATCH /api/me). O diário
+// cobre o dia anterior e o semanal a semana anterior, no fuso e com o
+// início de semana do usuário: conclusões e faltas, sequências atuais
+// (calculateStreaks), situação das metas por período (como
+// checkGoalCompletion) e atividades novas dos amigos. O job envia a partir
+// de config.DigestHour (hora local), fora do horário de silêncio e só no
+// próprio dia (o semanal no primeiro dia da semana); cada envio é
+// reservado antes em digest_deliveries. Só e-mails verificados recebem o
+// resumo. O texto e o HTML vêm dos templates em templates/, no idioma do
+// usuário.
+
+const (
+	digestOff    = "off"
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+
+	purposeDigestUnsubscribe  = "digest_unsubscribe"
+	digestUnsubscribeLifetime = 60 * 24 * time.Hour
+
+	digestRetentionDays = 35
+	maxDigestActivities = 10
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	digestHTML = htmltemplate.Must(htmltemplate.New("").Funcs(htmltemplate.FuncMap(digestFuncs(defaultLocale))).
+			ParseFS(templateFiles, "templates/digest.html.tmpl", "templates/digest_lines.tmpl"))
+	digestText = texttemplate.Must(texttemplate.New("").Funcs(digestFuncs(defaultLocale)).
+			ParseFS(templateFiles, "templates/digest.txt.tmpl", "templates/digest_lines.tmpl"))
+)
+
+type Digest struct {
+	Frequency string           `json:"frequency"`
+	FirstDay  string           `json:"first_day"` // YYYY-MM-DD
+	LastDay   string           `json:"last_day"`
+	Completed []DigestHabit    `json:"completed"`
+	Missed    []DigestHabit    `json:"missed"`
+	Streaks   []DigestStreak   `json:"streaks"`
+	Goals     []DigestGoal     `json:"goals"`
+	Activity  []DigestActivity `json:"activity"`
+}
+
+// Dias do período com conclusão (em Completed) ou com falta (em Missed);
+// nos hábitos por frequência, a falta é o que faltou para a meta do período
+type DigestHabit struct {
+	HabitID int    `json:"habit_id"`
+	Name    string `json:"name"`
+	Days    int    `json:"days"`
+}
+
+type DigestStreak struct {
+	HabitID int    `json:"habit_id"`
+	Name    string `json:"name"`
+	Current int    `json:"current"`
+	Longest int    `json:"longest"`
+	Unit    string `json:"unit"` // "days", "weeks" ou "months", como Schedule.streakUnit
+	Quit    bool   `json:"quit"` // dias sem recaída
+}
+
+// Meta do último período que toca o resumo; no resumo semanal uma meta
+// diária tem vários períodos e Achieved conta os cumpridos
+type DigestGoal struct {
+	HabitID  int     `json:"habit_id"`
+	Name     string  `json:"name"`
+	Value    float64 `json:"value"`
+	Target   float64 `json:"target"`
+	Unit     string  `json:"unit,omitempty"`
+	Status   string  `json:"status"` // achieved, missed ou in_progress
+	EndsOn   string  `json:"ends_on"`
+	Periods  int     `json:"periods"`
+	Achieved int     `json:"achieved"`
+}
+
+type DigestActivity struct {
+	Type      string    `json:"type"`
+	Friend    string    `json:"friend"`
+	Subject   string    `json:"subject"` // hábito ou desafio
+	Progress  float64   `json:"progress,omitempty"`
+	Goal      float64   `json:"goal,omitempty"`
+	Unit      string    `json:"unit,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func validDigestFrequency(frequency string) bool {
+	return frequency == digestOff || frequency == digestDaily || frequency == digestWeekly
+}
+
+func (d *Digest) empty() bool {
+	return len(d.Completed)+len(d.Missed)+len(d.Streaks)+len(d.Goals)+len(d.Activity) == 0
+}
+
+func startDigestJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sendDueDigests(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// Primeiro e último dia do último período completo antes de hoje
+func digestPeriod(frequency string, cal Calendar, now time.Time) (first, last time.Time) {
+	today := cal.day(now)
+	if frequency == digestWeekly {
+		weekStart, _ := cal.bounds(unitWeek, today)
+		return weekStart.AddDate(0, 0, -7), weekStart.AddDate(0, 0, -1)
+	}
+	yesterday := today.AddDate(0, 0, -1)
+	return yesterday, yesterday
+}
+
+// Uma rodada do job; devolve quantos resumos foram enviados
+func sendDueDigests(now time.Time) int {
+	users, err := store.ListDigestUsers()
+	if err != nil {
+		log.Printf("Digest job: error listing users: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for i := range users {
+		user := &users[i]
+		cal := Calendar{Loc: loadLocation(user.Timezone), WeekStart: time.Weekday(user.WeekStart)}
+		local := now.In(cal.Loc)
+		if local.Hour() < config.DigestHour || userQuietHours(user).contains(local) {
+			continue
+		}
+		first, last := digestPeriod(user.DigestFrequency, cal, now)
+		if !last.AddDate(0, 0, 1).Equal(cal.day(now)) {
+			// Resumo semanal fora do primeiro dia da semana
+			continue
+		}
+
+		ok, err := sendDigest(user, first, last, cal)
+		if err != nil {
+			log.Printf("Digest job: user %d, %s digest of %s: %v", user.ID, user.DigestFrequency, first.Format(dateLayout), err)
+		}
+		if ok {
+			sent++
+		}
+	}
+
+	before := localToday(time.UTC).AddDate(0, 0, -digestRetentionDays).Format(dateLayout)
+	if _, err := store.PruneDigestDeliveries(before); err != nil {
+		log.Printf("Digest job: error pruning deliveries: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Digest job: sent %d digest(s)", sent)
+	}
+	return sent
+}
+
+// Reserva e envia o resumo do período; false se já tinha sido enviado ou
+// não havia nada para contar
+func sendDigest(user *User, first, last time.Time, cal Calendar) (bool, error) {
+	periodStart := first.Format(dateLayout)
+	if err := store.ClaimDigest(user.ID, user.DigestFrequency, periodStart); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	digest, err := buildDigest(user, user.DigestFrequency, first, last, cal)
+	if err == nil && digest.empty() {
+		return false, nil
+	}
+	var mail Mail
+	if err == nil {
+		mail, err = digestMail(user, digest)
+	}
+	if err == nil {
+		err = mailer.Send(mail)
+	}
+	if err != nil {
+		// Libera o período para a próxima rodada tentar de novo
+		if releaseErr := store.ReleaseDigest(user.ID, user.DigestFrequency, periodStart); releaseErr != nil {
+			log.Printf("Digest job: error releasing digest: %v", releaseErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Reúne o conteúdo do resumo dos dias first a last (datas locais)
+func buildDigest(user *User, frequency string, first, last time.Time, cal Calendar) (*Digest, error) {
+	habits, err := store.ListHabits(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	ex := userExcuses(user.ID)
+	digest := &Digest{
+		Frequency: frequency,
+		FirstDay:  first.Format(dateLayout),
+		LastDay:   last.Format(dateLayout),
+		Completed: []DigestHabit{},
+		Missed:    []DigestHabit{},
+		Streaks:   []DigestStreak{},
+		Goals:     []DigestGoal{},
+		Activity:  []DigestActivity{},
+	}
+
+	for i := range habits {
+		habit := &habits[i]
+		if !habit.IsActive {
+			continue
+		}
+
+		current, longest, err := calculateStreaks(habit, cal)
+		if err != nil {
+			return nil, err
+		}
+		if current > 0 {
+			digest.Streaks = append(digest.Streaks, DigestStreak{
+				HabitID: habit.ID, Name: habit.Name, Current: current, Longest: longest,
+				Unit: habit.Schedule.streakUnit(), Quit: habit.isQuit(),
+			})
+		}
+		// Nos hábitos negativos as entradas são recaídas
+		if habit.isQuit() {
+			continue
+		}
+
+		done, missed, err := digestHabitDays(habit, first, last, cal, ex)
+		if err != nil {
+			return nil, err
+		}
+		if done > 0 {
+			digest.Completed = append(digest.Completed, DigestHabit{HabitID: habit.ID, Name: habit.Name, Days: done})
+		}
+		if missed > 0 {
+			digest.Missed = append(digest.Missed, DigestHabit{HabitID: habit.ID, Name: habit.Name, Days: missed})
+		}
+
+		goal, ok, err := digestHabitGoal(habit, first, last, cal)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			digest.Goals = append(digest.Goals, goal)
+		}
+	}
+	sort.SliceStable(digest.Streaks, func(i, j int) bool {
+		return digest.Streaks[i].Current > digest.Streaks[j].Current
+	})
+
+	from, to := dayStart(first, cal.Loc), dayStart(last.AddDate(0, 0, 1), cal.Loc).Add(-time.Second)
+	activities, err := store.ListFriendActivity(user.ID, from, to, maxDigestActivities)
+	if err != nil {
+		return nil, err
+	}
+	for _, activity := range activities {
+		digest.Activity = append(digest.Activity, digestActivity(activity))
+	}
+	return digest, nil
+}
+
+// Dias com conclusão e dias previstos sem conclusão entre first e last;
+// nos hábitos por frequência, as faltas são o que faltou para a meta de
+// cada período encerrado no intervalo
+func digestHabitDays(habit *Habit, first, last time.Time, cal Calendar, ex *Excuses) (done, missed int, err error) {
+	times, err := store.EntryTimes(habit.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	completed := completedDays(completionDates(times, cal.Loc))
+
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		if completed[day] {
+			done++
+			continue
+		}
+		if habit.Schedule.isFrequency() {
+			continue
+		}
+		due, err := habitDueOn(habit, day, cal, ex)
+		if err != nil {
+			return 0, 0, err
+		}
+		if due {
+			missed++
+		}
+	}
+	if habit.Schedule.isFrequency() {
+		missed = frequencyShortfall(habit, completed, first, last, cal, ex)
+	}
+	return done, missed, nil
+}
+
+// Conclusões que faltaram nos períodos (semanas ou meses) que terminam
+// entre first e last; períodos iniciados antes da criação do hábito não
+// contam e a meta de cada um desconta os dias dispensados
+func frequencyShortfall(habit *Habit, completed map[time.Time]bool, first, last time.Time, cal Calendar, ex *Excuses) int {
+	created := cal.day(habit.CreatedAt)
+	excused := ex.habit(habit.ID)
+	missed := 0
+	unit := habit.Schedule.periodUnit()
+	for start, next := cal.bounds(unit, first); !start.After(last); start, next = cal.bounds(unit, next) {
+		end := next.AddDate(0, 0, -1)
+		if end.After(last) || start.Before(created) {
+			continue
+		}
+		available, count := 0, 0
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			if excused.has(day) {
+				continue
+			}
+			available++
+			if completed[day] {
+				count++
+			}
+		}
+		if target := min(habit.Schedule.Times, available); count < target {
+			missed += target - count
+		}
+	}
+	return missed
+}
+
+// Situação da meta nos períodos que terminam entre first e last ou estão
+// em andamento em last; ok é false para hábitos sem meta por período
+func digestHabitGoal(habit *Habit, first, last time.Time, cal Calendar) (DigestGoal, bool, error) {
+	goal := DigestGoal{HabitID: habit.ID, Name: habit.Name, Target: habit.goalTarget(), Unit: habit.Unit}
+	if goal.Target == 0 {
+		return goal, false, nil
+	}
+
+	spec := habit.periodSpec()
+	created := cal.day(habit.CreatedAt)
+	to := dayStart(last.AddDate(0, 0, 1), cal.Loc).Add(-time.Second)
+	for day := last; !day.Before(first) && !day.Before(created); {
+		period, ok := spec.containing(day, cal)
+		if !ok || day.Before(period.FirstDay) {
+			break
+		}
+		if day.After(period.LastDay) {
+			// Intervalo fixo que terminou antes: avaliar o último dia dele
+			day = period.LastDay
+			continue
+		}
+
+		end := period.End
+		if end.After(to) {
+			end = to
+		}
+		_, value, err := goalPeriodProgress(habit, period, end, cal.Loc)
+		if err != nil {
+			return goal, false, err
+		}
+
+		status := "missed"
+		if value >= goal.Target {
+			status = "achieved"
+			goal.Achieved++
+		} else if period.LastDay.After(last) {
+			status = "in_progress"
+		}
+		if goal.Periods == 0 {
+			goal.Value, goal.Status, goal.EndsOn = value, status, period.LastDay.Format(dateLayout)
+		}
+		goal.Periods++
+		day = period.FirstDay.AddDate(0, 0, -1)
+	}
+	return goal, goal.Periods > 0, nil
+}
+
+func digestActivity(activity ActivityFeed) DigestActivity {
+	item := DigestActivity{Type: activity.ActivityType, CreatedAt: activity.CreatedAt}
+	if activity.User != nil {
+		item.Friend = activity.User.DisplayName
+		if item.Friend == "" {
+			item.Friend = activity.User.Username
+		}
+	}
+	switch {
+	case activity.Habit != nil:
+		item.Subject = activity.Habit.Name
+	case activity.Challenge != nil:
+		item.Subject = activity.Challenge.Name
+	}
+	if name, ok := activity.Metadata["habit_name"].(string); ok && item.Subject == "" {
+		item.Subject = name
+	}
+	item.Progress, _ = activity.Metadata["new_progress"].(float64)
+	item.Goal, _ = activity.Metadata["goal_value"].(float64)
+	item.Unit, _ = activity.Metadata["unit"].(string)
+	return item
+}
+
+// Dados dos templates
+type digestView struct {
+	*Digest
+	Name           string
+	Weekly         bool
+	AppURL         string
+	UnsubscribeURL string
+}
+
+func digestMail(user *User, digest *Digest) (Mail, error) {
+	token, err := signPurposeToken(purposeDigestUnsubscribe, user.ID, digestUnsubscribeLifetime, nil)
+	if err != nil {
+		return Mail{}, err
+	}
+	name := user.DisplayName
+	if name == "" {
+		name = user.Username
+	}
+	view := digestView{
+		Digest:         digest,
+		Name:           name,
+		Weekly:         digest.Frequency == digestWeekly,
+		AppURL:         config.AppURL,
+		UnsubscribeURL: appLink("/digest/unsubscribe", token),
+	}
+
+	funcs := digestFuncs(user.Locale)
+	var subject, text, html bytes.Buffer
+	textTemplate, err := digestText.Clone()
+	if err != nil {
+		return Mail{}, err
+	}
+	textTemplate.Funcs(funcs)
+	if err := textTemplate.ExecuteTemplate(&subject, "subject", view); err != nil {
+		return Mail{}, err
+	}
+	if err := textTemplate.ExecuteTemplate(&text, "digest.txt.tmpl", view); err != nil {
+		return Mail{}, err
+	}
+	htmlTemplate, err := digestHTML.Clone()
+	if err != nil {
+		return Mail{}, err
+	}
+	if err := htmlTemplate.Funcs(htmltemplate.FuncMap(funcs)).ExecuteTemplate(&html, "digest.html.tmpl", view); err != nil {
+		return Mail{}, err
+	}
+	return Mail{To: user.Email, Subject: strings.TrimSpace(subject.String()), Text: text.String(), HTML: html.String()}, nil
+}
+
+// Prévia do resumo do último período completo:
+// GET /api/me/digest?frequency=daily|weekly&format=json|text|html
+func getDigestPreview(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	frequency := r.URL.Query().Get("frequency")
+	if frequency == "" {
+		frequency = user.DigestFrequency
+		if frequency == digestOff {
+			frequency = digestDaily
+		}
+	}
+	if frequency != digestDaily && frequency != digestWeekly {
+		http.Error(w, "Frequency must be daily or weekly", http.StatusBadRequest)
+		return
+	}
+
+	cal := Calendar{Loc: loadLocation(user.Timezone), WeekStart: time.Weekday(user.WeekStart)}
+	first, last := digestPeriod(frequency, cal, time.Now())
+	digest, err := buildDigest(user, frequency, first, last, cal)
+	if err != nil {
+		http.Error(w, "Error building digest", http.StatusInternalServerError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" || format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(digest)
+		return
+	}
+	mail, err := digestMail(user, digest)
+	if err != nil {
+		http.Error(w, "Error rendering digest", http.StatusInternalServerError)
+		return
+	}
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(mail.Text))
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(mail.HTML))
+	default:
+		http.Error(w, "Format must be json, text or html", http.StatusBadRequest)
+	}
+}
+
+type DigestUnsubscribeRequest struct {
+	Token string `json:"token"`
+}
+
+// Desliga o resumo pelo link do próprio e-mail, sem login
+func unsubscribeDigest(w http.ResponseWriter, r *http.Request) {
+	var req DigestUnsubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, err := parsePurposeToken(req.Token, purposeDigestUnsubscribe)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	user, err := store.GetUser(userID)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	if user.DigestFrequency != digestOff {
+		user.DigestFrequency = digestOff
+		if err := store.UpdateProfile(user); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unsubscribed from the email digest"})
+}
+
+// Textos do resumo por idioma; o template usa t e tn (plural)
+var digestMessages = map[string]map[string]string{
+	"pt-BR": {
+		"subject_daily":     "Seu resumo de %s",
+		"subject_weekly":    "Seu resumo da semana de %s a %s",
+		"greeting":          "Olá, %s!",
+		"intro_daily":       "Veja como foram seus hábitos em %s.",
+		"intro_weekly":      "Veja como foram seus hábitos de %s a %s.",
+		"completed":         "Concluídos",
+		"missed":            "Não concluídos",
+		"none_completed":    "Nenhum hábito concluído.",
+		"none_missed":       "Nenhuma falta. Parabéns!",
+		"days_one":          "%d dia",
+		"days_other":        "%d dias",
+		"weeks_one":         "%d semana",
+		"weeks_other":       "%d semanas",
+		"months_one":        "%d mês",
+		"months_other":      "%d meses",
+		"streaks":           "Sequências",
+		"streak":            "%s: %s (recorde: %s)",
+		"streak_quit":       "%s: %s sem recaída (recorde: %s)",
+		"goals":             "Metas",
+		"goal":              "%s: %s de %s",
+		"goal_achieved":     "cumprida",
+		"goal_missed":       "não cumprida",
+		"goal_in_progress":  "em andamento, até %s",
+		"goal_periods":      "%s: cumprida em %d de %d períodos",
+		"activity":          "Amigos",
+		"activity_goal":     "%s cumpriu a meta de %s",
+		"activity_joined":   "%s entrou no desafio %s",
+		"activity_progress": "%s avançou no desafio %s (%s de %s)",
+		"activity_other":    "%s tem uma nova atividade",
+		"open_app":          "Abrir o Habit Tracker",
+		"footer":            "Você recebe este e-mail porque ativou o resumo %s.",
+		"frequency_daily":   "diário",
+		"frequency_weekly":  "semanal",
+		"unsubscribe":       "Não quero mais receber",
+	},
+	"en-US": {
+		"subject_daily":     "Your summary for %s",
+		"subject_weekly":    "Your summary for the week of %s to %s",
+		"greeting":          "Hi, %s!",
+		"intro_daily":       "Here is how your habits went on %s.",
+		"intro_weekly":      "Here is how your habits went from %s to %s.",
+		"completed":         "Completed",
+		"missed":            "Missed",
+		"none_completed":    "No habits completed.",
+		"none_missed":       "Nothing missed. Well done!",
+		"days_one":          "%d day",
+		"days_other":        "%d days",
+		"weeks_one":         "%d week",
+		"weeks_other":       "%d weeks",
+		"months_one":        "%d month",
+		"months_other":      "%d months",
+		"streaks":           "Streaks",
+		"streak":            "%s: %s (best: %s)",
+		"streak_quit":       "%s: %s without a relapse (best: %s)",
+		"goals":             "Goals",
+		"goal":              "%s: %s of %s",
+		"goal_achieved":     "achieved",
+		"goal_missed":       "missed",
+		"goal_in_progress":  "in progress, until %s",
+		"goal_periods":      "%s: achieved in %d of %d periods",
+		"activity":          "Friends",
+		"activity_goal":     "%s achieved the goal for %s",
+		"activity_joined":   "%s joined the challenge %s",
+		"activity_progress": "%s made progress in the challenge %s (%s of %s)",
+		"activity_other":    "%s has new activity",
+		"open_app":          "Open Habit Tracker",
+		"footer":            "You are receiving this email because you turned on the %s digest.",
+		"frequency_daily":   "daily",
+		"frequency_weekly":  "weekly",
+		"unsubscribe":       "Unsubscribe",
+	},
+}
+
+var digestMonths = map[string][]string{
+	"en-US": {"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+}
+
+// Funções dos templates no idioma do usuário
+func digestFuncs(locale string) map[string]interface{} {
+	messages, ok := digestMessages[locale]
+	if !ok {
+		locale, messages = defaultLocale, digestMessages[defaultLocale]
+	}
+	t := func(key string, args ...interface{}) string {
+		return fmt.Sprintf(messages[key], args...)
+	}
+	return map[string]interface{}{
+		"t": t,
+		"tn": func(key string, n int) string {
+			if n == 1 {
+				return t(key+"_one", n)
+			}
+			return t(key+"_other", n)
+		},
+		"date": func(day string) string {
+			d, err := time.Parse(dateLayout, day)
+			if err != nil {
+				return day
+			}
+			if locale == "en-US" {
+				return fmt.Sprintf("%s %d, %d", digestMonths[locale][d.Month()-1], d.Day(), d.Year())
+			}
+			return d.Format("02/01/2006")
+		},
+		// Valor com a unidade, com vírgula decimal em pt-BR
+		"amount": func(v float64, unit string) string {
+			s := fmt.Sprintf("%g", v)
+			if locale == "pt-BR" {
+				s = strings.Replace(s, ".", ",", 1)
+			}
+			if unit != "" {
+				s += " " + unit
+			}
+			return s
+		},
+	}
+}
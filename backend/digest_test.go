@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Resumo de segunda 07/09 a domingo 13/09/2026, com semanas começando na
+// segunda: nos hábitos por frequência só o que faltou para a meta de cada
+// período encerrado conta como falta
+func TestDigestHabitDays(t *testing.T) {
+	useTestStore(t)
+	user := createTestUser(t, "ana")
+	cal := Calendar{Loc: time.UTC, WeekStart: time.Monday}
+	first, last := date("2026-09-07"), date("2026-09-13")
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		entries  []string
+		done     int
+		missed   int
+	}{
+		{
+			name:     "daily",
+			schedule: Schedule{Type: scheduleDaily},
+			entries:  []string{"2026-09-08T10:00:00Z", "2026-09-10T10:00:00Z"},
+			done:     2,
+			missed:   5,
+		},
+		{
+			name:     "three times a week, two days done",
+			schedule: Schedule{Type: scheduleWeekly, Times: 3},
+			entries:  []string{"2026-09-08T10:00:00Z", "2026-09-08T18:00:00Z", "2026-09-10T10:00:00Z"},
+			done:     2,
+			missed:   1,
+		},
+		{
+			name:     "monthly period still open",
+			schedule: Schedule{Type: scheduleMonthly, Times: 10},
+			entries:  []string{"2026-09-08T10:00:00Z"},
+			done:     1,
+			missed:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			habit := &Habit{UserID: user.ID, Name: tt.name, Visibility: "private", IsActive: true,
+				Schedule: tt.schedule, CreatedAt: utc("2026-08-30T12:00:00Z")}
+			if err := store.CreateHabit(habit); err != nil {
+				t.Fatalf("create habit: %v", err)
+			}
+			for _, at := range tt.entries {
+				if err := store.CreateEntry(&HabitEntry{HabitID: habit.ID, CompletedAt: utc(at)}); err != nil {
+					t.Fatalf("create entry: %v", err)
+				}
+			}
+
+			done, missed, err := digestHabitDays(habit, first, last, cal, userExcuses(user.ID))
+			if err != nil {
+				t.Fatalf("digestHabitDays: %v", err)
+			}
+			if done != tt.done || missed != tt.missed {
+				t.Errorf("done, missed = %d, %d, want %d, %d", done, missed, tt.done, tt.missed)
+			}
+		})
+	}
+}
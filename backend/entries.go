@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Entradas retroativas, edição e criação em lote. O limite de uma conclusão
+// por dia (hábitos sem multipleUpdate) vale para o dia local da própria
+// entrada, não para o dia em que ela é registrada, e toda criação, edição
+// ou remoção fica no histórico (habit_entry_changes).
+
+const (
+	maxBulkEntries = 100
+	// Tolerância para relógios de clientes um pouco adiantados
+	entryClockSkew = 5 * time.Minute
+)
+
+type UpdateEntryRequest struct {
+	CompletedAt *time.Time `json:"completed_at"`
+	Value       *float64   `json:"value"`
+	Notes       *string    `json:"notes"`
+}
+
+type BulkEntriesRequest struct {
+	Entries []HabitEntry `json:"entries"`
+}
+
+// Completa e valida horário e valor; sem horário, a entrada é de agora
+func prepareEntry(habit *Habit, entry *HabitEntry, now time.Time) error {
+	if entry.CompletedAt.IsZero() {
+		entry.CompletedAt = now
+	}
+	if entry.CompletedAt.After(now.Add(entryClockSkew)) {
+		return errors.New("completed_at must not be in the future")
+	}
+
+	// Hábitos com unidade exigem a quantidade; os de contagem valem 1
+	if habit.Unit == "" {
+		entry.Value = 1
+	} else if entry.Value <= 0 {
+		return errors.New("Value must be greater than zero")
+	}
+	return nil
+}
+
+// Entradas do hábito no dia local de t, sem contar except (a entrada que
+// está sendo editada)
+func entriesOnDay(habitID int, t time.Time, loc *time.Location, except *HabitEntry) (int, error) {
+	day := entryDay(t, loc)
+	count, err := store.CountEntries(habitID, dayStart(day, loc), dayStart(day.AddDate(0, 0, 1), loc).Add(-time.Second))
+	if err != nil {
+		return 0, err
+	}
+	if except != nil && entryDay(except.CompletedAt, loc).Equal(day) {
+		count--
+	}
+	return count, nil
+}
+
+// Entrada registrada num dia local posterior ao da conclusão
+func markBackdated(changes []EntryChange, loc *time.Location) {
+	for i := range changes {
+		c := &changes[i]
+		c.Backdated = c.Action == "create" && c.NewCompletedAt != nil &&
+			entryDay(*c.NewCompletedAt, loc).Before(entryDay(c.ChangedAt, loc))
+	}
+}
+
+func entryFromRequest(w http.ResponseWriter, r *http.Request, habit *Habit) (*HabitEntry, bool) {
+	entryID, err := strconv.Atoi(mux.Vars(r)["entryId"])
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	entry, err := store.GetEntry(habit.ID, entryID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Entry not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return entry, true
+}
+
+func updateHabitEntry(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := entryFromRequest(w, r, habit)
+	if !ok {
+		return
+	}
+	old := *entry
+
+	var req UpdateEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.CompletedAt != nil {
+		if req.CompletedAt.IsZero() {
+			http.Error(w, "completed_at must not be empty", http.StatusBadRequest)
+			return
+		}
+		entry.CompletedAt = *req.CompletedAt
+	}
+	if req.Value != nil {
+		entry.Value = *req.Value
+	}
+	if req.Notes != nil {
+		entry.Notes = *req.Notes
+	}
+	if err := prepareEntry(habit, entry, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Mudar a entrada de dia não pode gerar duas conclusões no mesmo dia
+	if !habit.MultipleUpdate {
+		count, err := entriesOnDay(habit.ID, entry.CompletedAt, userLocation(habit.UserID), &old)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, "Habit already completed on that day", http.StatusConflict)
+			return
+		}
+	}
+
+	if err := store.UpdateEntry(entry); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Entry not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error updating entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// Cria várias entradas de uma vez (por exemplo, uma semana esquecida);
+// se alguma for inválida nenhuma é criada
+func createHabitEntries(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req BulkEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Entries) == 0 {
+		http.Error(w, "entries must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Entries) > maxBulkEntries {
+		http.Error(w, fmt.Sprintf("At most %d entries can be created at once", maxBulkEntries), http.StatusBadRequest)
+		return
+	}
+
+	loc := userLocation(habit.UserID)
+	now := time.Now()
+	days := map[time.Time]bool{}
+	for i := range req.Entries {
+		entry := &req.Entries[i]
+		entry.ID = 0
+		entry.EditedAt = nil
+		if err := prepareEntry(habit, entry, now); err != nil {
+			http.Error(w, fmt.Sprintf("entries[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		entry.HabitID = habit.ID
+
+		if habit.MultipleUpdate {
+			continue
+		}
+		day := entryDay(entry.CompletedAt, loc)
+		count, err := entriesOnDay(habit.ID, entry.CompletedAt, loc, nil)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if count > 0 || days[day] {
+			http.Error(w, fmt.Sprintf("entries[%d]: Habit already completed on %s", i, day.Format(dateLayout)), http.StatusConflict)
+			return
+		}
+		days[day] = true
+	}
+
+	if err := store.CreateEntries(req.Entries); err != nil {
+		http.Error(w, "Error creating entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(req.Entries)
+}
+
+// Histórico de alterações de uma entrada ({entryId}) ou de todas as
+// entradas do hábito, inclusive as removidas
+func getHabitEntryHistory(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	entryID := 0
+	if id, found := mux.Vars(r)["entryId"]; found {
+		var err error
+		if entryID, err = strconv.Atoi(id); err != nil {
+			http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := store.ListEntryChanges(habit.ID, entryID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if entryID != 0 && len(changes) == 0 {
+		http.Error(w, "Entry not found", http.StatusNotFound)
+		return
+	}
+	if changes == nil {
+		changes = []EntryChange{}
+	}
+	markBackdated(changes, userLocation(habit.UserID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// Alterações que podem inflar o progresso num desafio: edições, remoções
+// e entradas registradas retroativamente
+func editedEntryCount(userID int, challenge *Challenge) int {
+	if challenge.HabitName == "" {
+		return 0
+	}
+	changes, err := store.ListUserEntryChanges(userID, challenge.HabitName, challenge.StartDate, challenge.EndDate)
+	if err != nil {
+		return 0
+	}
+	markBackdated(changes, userLocation(userID))
+
+	count := 0
+	for _, c := range changes {
+		if c.Action != "create" || c.Backdated {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Exportação completa dos dados do usuário em JSON versionado e importação
+// desse arquivo em outra conta (por exemplo, em outra instância). Hábitos
+// (inclusive os arquivados), entradas e seu histórico, metas cumpridas,
+// dias pulados, pausas, congelamentos ganhos, filtros salvos e atividades
+// próprias são restaurados com ids novos; amizades, grupos e desafios
+// dependem de outros usuários da instância de origem e ficam no arquivo
+// apenas como registro.
+//
+// Versão 2: skips, pauses, streak_freeze_awards, entry_changes e views.
+
+const (
+	exportFormat        = "track-habits-export"
+	exportFormatVersion = 2
+
+	maxImportSize = 50 << 20 // 50 MB
+)
+
+type ExportArchive struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Identifica a conta de origem; importar de novo a mesma origem não duplica
+	Source  string        `json:"source"`
+	Profile ExportProfile `json:"profile"`
+
+	Habits          []Habit          `json:"habits"`
+	Entries         []HabitEntry     `json:"entries"`
+	GoalCompletions []GoalCompletion `json:"goal_completions"`
+	Activities      []ActivityFeed   `json:"activities"`
+	Comments        []ExportComment  `json:"comments"`
+	Reactions       []ExportReaction `json:"reactions"`
+
+	Skips              []HabitSkip         `json:"skips"`
+	Pauses             []Pause             `json:"pauses"`
+	StreakFreezeAwards []ExportFreezeAward `json:"streak_freeze_awards"`
+	EntryChanges       []EntryChange       `json:"entry_changes"`
+	Views              []HabitView         `json:"views"`
+
+	Friendships             []ExportFriendship             `json:"friendships"`
+	GroupMemberships        []ExportGroupMembership        `json:"group_memberships"`
+	ChallengeParticipations []ExportChallengeParticipation `json:"challenge_participations"`
+}
+
+type ExportProfile struct {
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	DisplayName     string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	Timezone        string    `json:"timezone"`
+	Locale          string    `json:"locale"`
+	WeekStart       int       `json:"week_start"`
+	QuietHoursStart string    `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string    `json:"quiet_hours_end,omitempty"`
+	DigestFrequency string    `json:"digest_frequency,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ExportComment struct {
+	ID         int       `json:"id"`
+	ActivityID int       `json:"activity_id"`
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportReaction struct {
+	ActivityID   int       `json:"activity_id"`
+	ReactionType string    `json:"reaction_type"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ExportFreezeAward struct {
+	ID        int       `json:"id"`
+	HabitID   *int      `json:"habit_id"` // nil se o hábito foi apagado
+	Day       string    `json:"day"`
+	Streak    int       `json:"streak"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportFriendship struct {
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	Direction string    `json:"direction"` // "sent" ou "received"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportGroupMembership struct {
+	GroupID   int       `json:"group_id"`
+	GroupName string    `json:"group_name"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+type ExportChallengeParticipation struct {
+	ChallengeID   int       `json:"challenge_id"`
+	ChallengeName string    `json:"challenge_name"`
+	HabitName     string    `json:"habit_name"`
+	GoalType      string    `json:"goal_type"`
+	GoalValue     float64   `json:"goal_value"`
+	Unit          string    `json:"unit,omitempty"`
+	Progress      float64   `json:"progress"`
+	Notes         string    `json:"notes,omitempty"`
+	JoinedAt      time.Time `json:"joined_at"`
+}
+
+type ImportCount struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"` // já importados antes ou sem o registro pai
+}
+
+func (c *ImportCount) count(created bool) {
+	if created {
+		c.Imported++
+	} else {
+		c.Skipped++
+	}
+}
+
+type ImportResult struct {
+	Habits          ImportCount `json:"habits"`
+	Entries         ImportCount `json:"entries"`
+	GoalCompletions ImportCount `json:"goal_completions"`
+	Activities      ImportCount `json:"activities"`
+	Comments        ImportCount `json:"comments"`
+	Reactions       ImportCount `json:"reactions"`
+
+	Skips              ImportCount `json:"skips"`
+	Pauses             ImportCount `json:"pauses"`
+	StreakFreezeAwards ImportCount `json:"streak_freeze_awards"`
+	EntryChanges       ImportCount `json:"entry_changes"`
+	Views              ImportCount `json:"views"`
+	// Registros que só existem na instância de origem
+	NotRestored map[string]int `json:"not_restored"`
+}
+
+func exportSource(user *User) string {
+	return fmt.Sprintf("%s#%d@%d", config.AppURL, user.ID, user.CreatedAt.Unix())
+}
+
+func exportData(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	archive, err := store.ExportUserData(user.ID)
+	if err != nil {
+		log.Printf("Error exporting data for user %d: %v", user.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	archive.Format = exportFormat
+	archive.Version = exportFormatVersion
+	archive.ExportedAt = time.Now().UTC()
+	archive.Source = exportSource(user)
+	archive.Profile = ExportProfile{
+		Username:        user.Username,
+		Email:           user.Email,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		Timezone:        user.Timezone,
+		Locale:          user.Locale,
+		WeekStart:       user.WeekStart,
+		QuietHoursStart: user.QuietHoursStart,
+		QuietHoursEnd:   user.QuietHoursEnd,
+		DigestFrequency: user.DigestFrequency,
+		CreatedAt:       user.CreatedAt,
+	}
+
+	filename := fmt.Sprintf("habits-export-%s.json", archive.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(archive)
+}
+
+func importData(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var archive ExportArchive
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := json.NewDecoder(r.Body).Decode(&archive); err != nil {
+		http.Error(w, "Invalid JSON archive", http.StatusBadRequest)
+		return
+	}
+	if archive.Format != exportFormat || archive.Source == "" {
+		http.Error(w, "Not a habit tracker export archive", http.StatusBadRequest)
+		return
+	}
+	if archive.Version < 1 || archive.Version > exportFormatVersion {
+		http.Error(w, fmt.Sprintf("Unsupported archive version %d", archive.Version), http.StatusBadRequest)
+		return
+	}
+	if archive.Source == exportSource(user) {
+		http.Error(w, "This archive was exported from this account", http.StatusConflict)
+		return
+	}
+
+	// Hábitos sem nome não passariam pela API; o resto é normalizado
+	habits := archive.Habits[:0]
+	for _, habit := range archive.Habits {
+		if habit.Name == "" {
+			continue
+		}
+		if habit.Visibility == "" {
+			habit.Visibility = "public"
+		}
+		if validateHabitAmount(&habit) != nil {
+			habit.Unit, habit.TargetValue = "", 0
+		}
+		if validatePolarity(&habit) != nil {
+			habit.Polarity = polarityBuild
+		}
+		if validateReminderMode(&habit) != nil {
+			habit.ReminderMode = reminderModeFixed
+		}
+		if habit.periodSpec().validate() != nil {
+			habit.GoalType = "streak"
+		}
+		habit.normalizeGoalPeriod()
+		if habit.Schedule.validate() != nil {
+			habit.Schedule = Schedule{}
+		}
+		habit.Schedule.normalize(habit.CreatedAt)
+		// Arquivado é is_active falso com a data do arquivamento
+		if habit.IsActive {
+			habit.ArchivedAt = nil
+		} else if habit.ArchivedAt == nil {
+			now := time.Now()
+			habit.ArchivedAt = &now
+		}
+		habits = append(habits, habit)
+	}
+	archive.Habits = habits
+
+	skips := archive.Skips[:0]
+	for _, skip := range archive.Skips {
+		if _, err := time.Parse(dateLayout, skip.Date); err != nil || (skip.Kind != skipSkip && skip.Kind != skipFreeze) {
+			continue
+		}
+		skips = append(skips, skip)
+	}
+	archive.Skips = skips
+
+	pauses := archive.Pauses[:0]
+	for _, pause := range archive.Pauses {
+		start, err1 := time.Parse(dateLayout, pause.StartDate)
+		end, err2 := time.Parse(dateLayout, pause.EndDate)
+		if err1 != nil || err2 != nil || end.Before(start) || len(pause.Reason) > 255 {
+			continue
+		}
+		pauses = append(pauses, pause)
+	}
+	archive.Pauses = pauses
+
+	changes := archive.EntryChanges[:0]
+	for _, change := range archive.EntryChanges {
+		switch change.Action {
+		case "create", "update", "delete":
+			changes = append(changes, change)
+		}
+	}
+	archive.EntryChanges = changes
+
+	views := archive.Views[:0]
+	for _, view := range archive.Views {
+		view.Name = strings.TrimSpace(view.Name)
+		if view.Name == "" || utf8.RuneCountInString(view.Name) > maxViewNameLength {
+			continue
+		}
+		views = append(views, view)
+	}
+	archive.Views = views
+
+	result, err := store.ImportArchive(user.ID, hashToken(archive.Source), &archive)
+	if err != nil {
+		log.Printf("Error importing archive for user %d: %v", user.ID, err)
+		http.Error(w, "Error importing archive", http.StatusInternalServerError)
+		return
+	}
+	result.NotRestored = map[string]int{
+		"friendships":              len(archive.Friendships),
+		"group_memberships":        len(archive.GroupMemberships),
+		"challenge_participations": len(archive.ChallengeParticipations),
+	}
+
+	// Perfil: só preenche o que a conta ainda não personalizou
+	profile := archive.Profile
+	changed := false
+	if user.DisplayName == "" && profile.DisplayName != "" {
+		user.DisplayName, changed = profile.DisplayName, true
+	}
+	if user.Bio == "" && profile.Bio != "" {
+		user.Bio, changed = profile.Bio, true
+	}
+	if user.Timezone == defaultTimezone && validTimezone(profile.Timezone) {
+		user.Timezone, changed = profile.Timezone, true
+	}
+	if user.Locale == defaultLocale && validLocale(profile.Locale) {
+		user.Locale, changed = profile.Locale, true
+	}
+	if user.WeekStart == 0 && profile.WeekStart > 0 && profile.WeekStart <= 6 {
+		user.WeekStart, changed = profile.WeekStart, true
+	}
+	if user.QuietHoursStart == "" && user.QuietHoursEnd == "" && profile.QuietHoursStart != "" {
+		if setQuietHours(user, &profile.QuietHoursStart, &profile.QuietHoursEnd) == nil {
+			changed = true
+		} else {
+			user.QuietHoursStart, user.QuietHoursEnd = "", ""
+		}
+	}
+	if user.DigestFrequency == digestOff && profile.DigestFrequency != digestOff && validDigestFrequency(profile.DigestFrequency) {
+		user.DigestFrequency, changed = profile.DigestFrequency, true
+	}
+	if changed {
+		if err := store.UpdateProfile(user); err != nil {
+			log.Printf("Error updating profile from archive for user %d: %v", user.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Job de metas: ao fim de cada período (no fuso e com o início de semana do
+// usuário) grava em goal_completions o resultado das metas count, weekly,
+// monthly, yearly e range, inclusive as não cumpridas (missed), sem
+// depender do app estar aberto. Períodos já registrados (pelo cliente ou
+// por uma rodada anterior) são ignorados, então o job pode rodar a
+// qualquer momento e recupera os períodos perdidos enquanto o servidor
+// esteve parado, até goalBackfillDays.
+
+const goalBackfillDays = 35
+
+func startGoalJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			recordClosedGoalPeriods(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// Uma rodada do job; devolve quantos períodos foram gravados
+func recordClosedGoalPeriods(now time.Time) int {
+	habits, err := store.ListGoalHabits()
+	if err != nil {
+		log.Printf("Goal job: error listing habits: %v", err)
+		return 0
+	}
+
+	calendars := map[int]Calendar{}
+	recorded := 0
+	for i := range habits {
+		habit := &habits[i]
+		if habit.goalTarget() == 0 {
+			continue
+		}
+		cal, ok := calendars[habit.UserID]
+		if !ok {
+			cal = userCalendar(habit.UserID)
+			calendars[habit.UserID] = cal
+		}
+
+		n, err := recordHabitGoalPeriods(habit, cal, now)
+		if err != nil {
+			log.Printf("Goal job: habit %d: %v", habit.ID, err)
+		}
+		recorded += n
+	}
+	if recorded > 0 {
+		log.Printf("Goal job: recorded %d goal period(s)", recorded)
+	}
+	return recorded
+}
+
+// Grava os períodos encerrados e ainda não registrados do hábito, do mais
+// antigo para o mais recente
+func recordHabitGoalPeriods(habit *Habit, cal Calendar, now time.Time) (int, error) {
+	periods, err := closedGoalPeriods(habit, cal, now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(periods) - 1; i >= 0; i-- {
+		if err := recordGoalPeriod(habit, periods[i], cal); err != nil {
+			return len(periods) - 1 - i, err
+		}
+	}
+	return len(periods), nil
+}
+
+// Períodos encerrados antes de hoje, do mais recente para o mais antigo,
+// até o primeiro já registrado, a criação do hábito ou goalBackfillDays.
+// Um período que começou antes da criação não é avaliado: a meta valeria
+// para dias em que o hábito não existia. Nas metas diárias (count), dias
+// fora da agenda ou dispensados não geram registro.
+func closedGoalPeriods(habit *Habit, cal Calendar, now time.Time) ([]Period, error) {
+	spec := habit.periodSpec()
+	today := cal.day(now)
+	created := cal.day(habit.CreatedAt)
+	oldest := today.AddDate(0, 0, -goalBackfillDays)
+	if created.After(oldest) {
+		oldest = created
+	}
+	excused := userExcuses(habit.UserID).habit(habit.ID)
+
+	var periods []Period
+	for day := today.AddDate(0, 0, -1); !day.Before(oldest); {
+		period, ok := spec.containing(day, cal)
+		if !ok || day.Before(period.FirstDay) || period.FirstDay.Before(created) {
+			break
+		}
+		if day.After(period.LastDay) {
+			// Intervalo fixo que terminou antes: avaliar o último dia dele
+			day = period.LastDay
+			continue
+		}
+		if !period.LastDay.Before(today) {
+			// Período em andamento
+			day = period.FirstDay.AddDate(0, 0, -1)
+			continue
+		}
+		if habit.GoalType == "count" && (!habit.Schedule.isDue(day) || excused.has(day)) {
+			day = day.AddDate(0, 0, -1)
+			continue
+		}
+
+		count, err := store.CountGoalCompletions(habit.ID, period.Start, period.End)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			break
+		}
+		periods = append(periods, period)
+		day = period.FirstDay.AddDate(0, 0, -1)
+	}
+	return periods, nil
+}
+
+// Entradas do período até to e a soma dos seus valores; depois de um
+// reset, só contam as entradas posteriores a ele
+func goalPeriodProgress(habit *Habit, period Period, to time.Time, loc *time.Location) (int, float64, error) {
+	countFrom := period.Start
+	if habit.LastGoalReset != nil && !habit.LastGoalReset.Before(period.Start) {
+		countFrom = habit.LastGoalReset.Add(time.Second)
+	}
+	return sumDueEntries(habit, countFrom, to, loc)
+}
+
+// Avalia a meta no período, como checkGoalCompletion, e grava o resultado
+func recordGoalPeriod(habit *Habit, period Period, cal Calendar) error {
+	actualCount, actualValue, err := goalPeriodProgress(habit, period, period.End, cal.Loc)
+	if err != nil {
+		return err
+	}
+
+	completion := GoalCompletion{
+		HabitID:          habit.ID,
+		GoalType:         habit.GoalType,
+		GoalValue:        habit.Goal,
+		PeriodStart:      period.Start,
+		PeriodEnd:        period.End,
+		PeriodDefinition: period.Definition,
+		ActualCount:      actualCount,
+		Missed:           actualValue < habit.goalTarget(),
+	}
+	if err := store.CreateGoalCompletion(&completion); err != nil {
+		return err
+	}
+
+	if !completion.Missed {
+		goalAchievedActivity(habit, &completion)
+	}
+	return nil
+}
+
+// Atividade "goal_achieved" no feed; erros só são registrados no log
+func goalAchievedActivity(habit *Habit, completion *GoalCompletion) {
+	metadata := map[string]interface{}{
+		"habit_name":        habit.Name,
+		"goal_type":         completion.GoalType,
+		"goal_value":        completion.GoalValue,
+		"actual_count":      completion.ActualCount,
+		"period_definition": completion.PeriodDefinition,
+		"notes":             completion.Notes,
+	}
+	if habit.Unit != "" {
+		metadata["unit"] = habit.Unit
+	}
+
+	if err := createFeedActivity(habit.UserID, "goal_achieved", &habit.ID, &completion.ID, nil, metadata); err != nil {
+		log.Printf("Erro ao criar atividade no feed para meta completada: %v", err)
+	}
+}
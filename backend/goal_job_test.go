@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Hábitos criados numa quarta-feira (02/09/2026); o job roda duas semanas
+// depois, com semanas de domingo a sábado
+func TestClosedGoalPeriods(t *testing.T) {
+	useTestStore(t)
+	user := createTestUser(t, "ana")
+	cal := Calendar{Loc: time.UTC, WeekStart: time.Sunday}
+	created := utc("2026-09-02T12:00:00Z")
+	now := utc("2026-09-16T12:00:00Z")
+
+	tests := []struct {
+		name     string
+		goalType string
+		schedule Schedule
+		want     []string
+	}{
+		{
+			// 30/08 a 05/09 começou antes da criação; 13/09 a 19/09 está em andamento
+			name:     "weekly goal skips the week of creation",
+			goalType: "weekly",
+			want:     []string{"2026-09-06"},
+		},
+		{
+			name:     "count goal only on scheduled days",
+			goalType: "count",
+			schedule: Schedule{Type: scheduleWeekdays, Weekdays: []int{1}},
+			want:     []string{"2026-09-07", "2026-09-14"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			habit := &Habit{UserID: user.ID, Name: tt.name, Visibility: "private", IsActive: true,
+				Goal: 1, GoalType: tt.goalType, Schedule: tt.schedule, CreatedAt: created}
+			if err := store.CreateHabit(habit); err != nil {
+				t.Fatalf("create habit: %v", err)
+			}
+
+			if _, err := recordHabitGoalPeriods(habit, cal, now); err != nil {
+				t.Fatalf("recordHabitGoalPeriods: %v", err)
+			}
+			// Uma segunda rodada não grava nada de novo
+			if n, err := recordHabitGoalPeriods(habit, cal, now); err != nil || n != 0 {
+				t.Fatalf("second run recorded %d periods (err %v)", n, err)
+			}
+
+			completions, err := store.ListGoalCompletions(habit.ID)
+			if err != nil {
+				t.Fatalf("list goal completions: %v", err)
+			}
+			var got []string
+			for _, c := range completions {
+				if !c.Missed {
+					t.Errorf("period %s recorded as achieved", c.PeriodStart.Format(dateLayout))
+				}
+				got = append(got, c.PeriodStart.UTC().Format(dateLayout))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("recorded periods %v, want %v", got, tt.want)
+			}
+			for _, day := range tt.want {
+				found := false
+				for _, g := range got {
+					found = found || g == day
+				}
+				if !found {
+					t.Errorf("recorded periods %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
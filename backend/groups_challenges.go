@@ -1,11 +1,12 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -17,40 +18,12 @@ import (
 func getGroups(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
 
-	query := `
-		SELECT DISTINCT g.id, g.name, g.description, g.privacy, g.creator_id, g.created_at, g.updated_at,
-			   u.id, u.username, u.email,
-			   (SELECT COUNT(*) FROM group_members WHERE group_id = g.id) as member_count,
-			   (SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND user_id = ?) as is_joined
-		FROM ` + "`groups`" + ` g
-		JOIN users u ON u.id = g.creator_id
-		LEFT JOIN group_members gm ON gm.group_id = g.id
-		WHERE g.privacy = 'public' OR gm.user_id = ?
-		ORDER BY g.created_at DESC
-	`
-
-	rows, err := db.Query(query, userID, userID)
+	groups, err := store.ListGroups(userID)
 	if err != nil {
 		log.Printf("Erro ao buscar grupos: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var groups []Group
-	for rows.Next() {
-		var g Group
-		var creator User
-		var isJoinedInt int
-		err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.Privacy, &g.CreatorID, &g.CreatedAt, &g.UpdatedAt,
-						&creator.ID, &creator.Username, &creator.Email, &g.MemberCount, &isJoinedInt)
-		if err != nil {
-			continue
-		}
-		g.Creator = &creator
-		g.IsJoined = isJoinedInt > 0
-		groups = append(groups, g)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(groups)
@@ -67,41 +40,21 @@ func createGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validações
-	if req.Name == "" {
-		http.Error(w, "Nome do grupo é obrigatório", http.StatusBadRequest)
+	if writeValidationErrors(w, "Dados inválidos", req.validate()) {
 		return
 	}
 
-	if req.Privacy == "" {
-		req.Privacy = "public"
-	}
-
-	// Criar o grupo
-	query := "INSERT INTO `groups` (name, description, privacy, creator_id) VALUES (?, ?, ?, ?)"
-	result, err := db.Exec(query, req.Name, req.Description, req.Privacy, userID)
-	if err != nil {
-		log.Printf("Erro ao criar grupo: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-
-	groupID, _ := result.LastInsertId()
-
-	// Adicionar o criador como admin do grupo
-	_, err = db.Exec("INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, 'admin')", groupID, userID)
-	if err != nil {
-		log.Printf("Erro ao adicionar criador ao grupo: %v", err)
-		// Não falhar aqui, apenas logar
-	}
-
+	// Criar o grupo; o criador entra como admin
 	group := Group{
-		ID:          int(groupID),
 		Name:        req.Name,
 		Description: req.Description,
 		Privacy:     req.Privacy,
 		CreatorID:   userID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	}
+	if err := store.CreateGroup(&group); err != nil {
+		log.Printf("Erro ao criar grupo: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -119,21 +72,9 @@ func getGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := "SELECT g.id, g.name, g.description, g.privacy, g.creator_id, g.created_at, g.updated_at, " +
-			 "u.id, u.username, u.email, " +
-			 "(SELECT COUNT(*) FROM group_members WHERE group_id = g.id) as member_count, " +
-			 "(SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND user_id = ?) as is_joined " +
-			 "FROM " + "`groups`" + " g " +
-			 "JOIN users u ON u.id = g.creator_id " +
-			 "WHERE g.id = ?"
-
-	var g Group
-	var creator User
-	var isJoinedInt int
-	err = db.QueryRow(query, userID, groupID).Scan(&g.ID, &g.Name, &g.Description, &g.Privacy, &g.CreatorID, &g.CreatedAt, &g.UpdatedAt,
-												  &creator.ID, &creator.Username, &creator.Email, &g.MemberCount, &isJoinedInt)
+	g, err := store.GetGroup(userID, groupID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
 			return
 		}
@@ -142,9 +83,6 @@ func getGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	g.Creator = &creator
-	g.IsJoined = isJoinedInt > 0
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(g)
 }
@@ -160,8 +98,7 @@ func updateGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o usuário é o criador ou admin do grupo
-	var role string
-	err = db.QueryRow("SELECT role FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&role)
+	role, err := store.GetMemberRole(groupID, userID)
 	if err != nil {
 		http.Error(w, "Permissão negada", http.StatusForbidden)
 		return
@@ -178,17 +115,24 @@ func updateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := "UPDATE groups SET name = ?, description = ?, privacy = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
-	result, err := db.Exec(query, req.Name, req.Description, req.Privacy, groupID)
-	if err != nil {
-		log.Printf("Erro ao atualizar grupo: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	// Sem privacidade, o grupo mantém a atual
+	if req.Privacy == "" {
+		if existing, err := store.GetGroup(userID, groupID); err == nil {
+			req.Privacy = existing.Privacy
+		}
+	}
+	if writeValidationErrors(w, "Dados inválidos", req.validate()) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Grupo não encontrado", http.StatusNotFound)
+	group := Group{ID: groupID, Name: req.Name, Description: req.Description, Privacy: req.Privacy}
+	if err := store.UpdateGroup(&group); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao atualizar grupo: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
@@ -207,10 +151,9 @@ func deleteGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o usuário é o criador do grupo
-	var creatorID int
-	err = db.QueryRow("SELECT creator_id FROM `groups` WHERE id = ?", groupID).Scan(&creatorID)
+	group, err := store.GetGroup(userID, groupID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
 			return
 		}
@@ -219,25 +162,22 @@ func deleteGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if creatorID != userID {
+	if group.CreatorID != userID {
 		http.Error(w, "Apenas o criador pode deletar o grupo", http.StatusForbidden)
 		return
 	}
 
 	// Deletar grupo (cascade deletará membros e desafios)
-	result, err := db.Exec("DELETE FROM `groups` WHERE id = ?", groupID)
-	if err != nil {
+	if err := store.DeleteGroup(groupID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
+			return
+		}
 		log.Printf("Erro ao deletar grupo: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Grupo não encontrado", http.StatusNotFound)
-		return
-	}
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -252,10 +192,9 @@ func joinGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o grupo existe e é público
-	var privacy string
-	err = db.QueryRow("SELECT privacy FROM `groups` WHERE id = ?", groupID).Scan(&privacy)
+	group, err := store.GetGroup(userID, groupID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
 			return
 		}
@@ -264,22 +203,19 @@ func joinGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if privacy != "public" {
+	if group.Privacy != "public" {
 		http.Error(w, "Este grupo não permite entrada direta", http.StatusForbidden)
 		return
 	}
 
 	// Verificar se já é membro
-	var memberID int
-	err = db.QueryRow("SELECT id FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&memberID)
-	if err == nil {
+	if group.IsJoined {
 		http.Error(w, "Você já é membro deste grupo", http.StatusConflict)
 		return
 	}
 
 	// Adicionar como membro
-	_, err = db.Exec("INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, 'member')", groupID, userID)
-	if err != nil {
+	if err := store.AddGroupMember(groupID, userID, "member"); err != nil {
 		log.Printf("Erro ao entrar no grupo: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
@@ -300,10 +236,9 @@ func leaveGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se é o criador do grupo
-	var creatorID int
-	err = db.QueryRow("SELECT creator_id FROM `groups` WHERE id = ?", groupID).Scan(&creatorID)
+	group, err := store.GetGroup(userID, groupID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
 			return
 		}
@@ -312,26 +247,43 @@ func leaveGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if creatorID == userID {
+	if group.CreatorID == userID {
 		http.Error(w, "O criador do grupo não pode sair. Delete o grupo se necessário.", http.StatusForbidden)
 		return
 	}
 
 	// Remover da lista de membros
-	result, err := db.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
-	if err != nil {
+	if err := store.RemoveGroupMember(groupID, userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Você não é membro deste grupo", http.StatusNotFound)
+			return
+		}
 		log.Printf("Erro ao sair do grupo: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Você não é membro deste grupo", http.StatusNotFound)
-		return
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Busca o grupo e verifica se o usuário pode vê-lo (grupo público ou membro)
+func visibleGroup(w http.ResponseWriter, userID, groupID int) (*Group, bool) {
+	group, err := store.GetGroup(userID, groupID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Erro ao verificar grupo: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return nil, false
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	if group.Privacy != "public" && !group.IsJoined {
+		http.Error(w, "Permissão negada", http.StatusForbidden)
+		return nil, false
+	}
+	return group, true
 }
 
 // Listar membros do grupo
@@ -345,57 +297,16 @@ func getGroupMembers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o usuário é membro do grupo ou se o grupo é público
-	var privacy string
-	var isMember int
-	err = db.QueryRow("SELECT g.privacy, " +
-		"(SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND user_id = ?) as is_member " +
-		"FROM " + "`groups`" + " g WHERE g.id = ?", userID, groupID).Scan(&privacy, &isMember)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
-			return
-		}
-		log.Printf("Erro ao verificar grupo: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-
-	if privacy != "public" && isMember == 0 {
-		http.Error(w, "Permissão negada", http.StatusForbidden)
+	if _, ok := visibleGroup(w, userID, groupID); !ok {
 		return
 	}
 
-	query := `
-		SELECT gm.id, gm.group_id, gm.user_id, gm.role, gm.joined_at,
-			   u.id, u.username, u.email
-		FROM group_members gm
-		JOIN users u ON u.id = gm.user_id
-		WHERE gm.group_id = ?
-		ORDER BY gm.role DESC, gm.joined_at ASC
-	`
-
-	rows, err := db.Query(query, groupID)
+	members, err := store.ListGroupMembers(groupID)
 	if err != nil {
 		log.Printf("Erro ao buscar membros: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var members []GroupMember
-	for rows.Next() {
-		var gm GroupMember
-		var u User
-		err := rows.Scan(&gm.ID, &gm.GroupID, &gm.UserID, &gm.Role, &gm.JoinedAt,
-						&u.ID, &u.Username, &u.Email)
-		if err != nil {
-			log.Printf("Erro ao escanear membro: %v", err)
-			continue
-		}
-		gm.User = &u
-		members = append(members, gm)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(members)
@@ -407,54 +318,12 @@ func getGroupMembers(w http.ResponseWriter, r *http.Request) {
 func getChallenges(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
 
-	query := `
-		SELECT DISTINCT c.id, c.group_id, c.name, c.description, c.habit_name, c.goal_value, c.goal_type, 
-			   c.start_date, c.end_date, c.status, c.creator_id, c.created_at, c.updated_at,
-			   u.id, u.username, u.email,
-			   g.id, g.name, g.privacy,
-			   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id) as participant_count,
-			   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id AND user_id = ?) as is_participating,
-			   COALESCE((SELECT progress FROM challenge_participants WHERE challenge_id = c.id AND user_id = ?), 0) as user_progress,
-			   (SELECT COUNT(*) > 0 FROM challenge_participants WHERE challenge_id = c.id AND progress >= c.goal_value) as has_completed_participant
-		FROM challenges c
-		JOIN users u ON u.id = c.creator_id
-		JOIN ` + "`groups`" + ` g ON g.id = c.group_id
-		LEFT JOIN group_members gm ON gm.group_id = g.id
-		WHERE g.privacy = 'public' OR gm.user_id = ?
-		ORDER BY c.created_at DESC
-	`
-
-	rows, err := db.Query(query, userID, userID, userID)
+	challenges, err := store.ListChallenges(userID)
 	if err != nil {
 		log.Printf("Erro ao buscar desafios: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var challenges []Challenge
-	for rows.Next() {
-		var c Challenge
-		var creator User
-		var group Group
-		var isParticipatingInt int
-		var userProgress int
-		var hasCompletedParticipantInt int
-		err := rows.Scan(&c.ID, &c.GroupID, &c.Name, &c.Description, &c.HabitName, &c.GoalValue, &c.GoalType,
-						&c.StartDate, &c.EndDate, &c.Status, &c.CreatorID, &c.CreatedAt, &c.UpdatedAt,
-						&creator.ID, &creator.Username, &creator.Email,
-						&group.ID, &group.Name, &group.Privacy,
-						&c.ParticipantCount, &isParticipatingInt, &userProgress, &hasCompletedParticipantInt)
-		if err != nil {
-			continue
-		}
-		c.Creator = &creator
-		c.Group = &group
-		c.IsParticipating = isParticipatingInt > 0
-		c.UserProgress = userProgress
-		c.HasCompletedParticipant = hasCompletedParticipantInt > 0
-		challenges = append(challenges, c)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(challenges)
@@ -476,118 +345,104 @@ func createChallenge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validações
-	if req.Name == "" {
-		http.Error(w, "Nome do desafio é obrigatório", http.StatusBadRequest)
+	// Validações; valores padrão: meta streak de 7 dias
+	localChallengeDates(&req, userLocation(userID))
+	if writeValidationErrors(w, "Dados inválidos", req.validate()) {
 		return
 	}
 
 	// Verificar se o usuário é membro do grupo
-	var isMember int
-	err = db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&isMember)
-	if err != nil || isMember == 0 {
+	if _, err := store.GetMemberRole(groupID, userID); err != nil {
 		http.Error(w, "Você deve ser membro do grupo para criar desafios", http.StatusForbidden)
 		return
 	}
 
-	// Definir valores padrão
-	if req.GoalType == "" {
-		req.GoalType = "streak"
-	}
-	if req.GoalValue == 0 {
-		req.GoalValue = 7 // 7 dias por padrão
+	// Criar o desafio; o criador participa automaticamente
+	challenge := Challenge{
+		GroupID:         groupID,
+		Name:            req.Name,
+		Description:     req.Description,
+		HabitName:       req.HabitName,
+		GoalValue:       req.GoalValue,
+		Unit:            challengeUnit(userID, req),
+		GoalType:        req.GoalType,
+		StartDate:       req.StartDate,
+		EndDate:         req.EndDate,
+		Status:          "upcoming",
+		CreatorID:       userID,
+		IsParticipating: true,
 	}
-
-	// Criar o desafio
-	query := `
-		INSERT INTO challenges (group_id, name, description, habit_name, goal_value, goal_type, 
-								start_date, end_date, status, creator_id) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'upcoming', ?)
-	`
-	result, err := db.Exec(query, groupID, req.Name, req.Description, req.HabitName, 
-						  req.GoalValue, req.GoalType, req.StartDate, req.EndDate, userID)
-	if err != nil {
+	if err := store.CreateChallenge(&challenge); err != nil {
+		log.Printf("Erro ao criar desafio: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	challengeID, _ := result.LastInsertId()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(challenge)
+}
 
-	// Participar automaticamente do próprio desafio
-	_, err = db.Exec("INSERT INTO challenge_participants (challenge_id, user_id) VALUES (?, ?)", challengeID, userID)
+// Unidade do desafio: a informada ou, se vazia, a do hábito do usuário com
+// o mesmo nome do hábito do desafio
+func challengeUnit(userID int, req CreateChallengeRequest) string {
+	if req.Unit != "" || req.HabitName == "" {
+		return req.Unit
+	}
+	habits, err := store.ListHabits(userID)
 	if err != nil {
-		log.Printf("Erro ao adicionar criador ao desafio: %v", err)
+		return ""
 	}
-
-	challenge := Challenge{
-		ID:          int(challengeID),
-		GroupID:     groupID,
-		Name:        req.Name,
-		Description: req.Description,
-		HabitName:   req.HabitName,
-		GoalValue:   req.GoalValue,
-		GoalType:    req.GoalType,
-		StartDate:   req.StartDate,
-		EndDate:     req.EndDate,
-		Status:      "upcoming",
-		CreatorID:   userID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-		IsParticipating: true,
+	for _, habit := range habits {
+		if strings.EqualFold(habit.Name, req.HabitName) {
+			return habit.Unit
+		}
 	}
+	return ""
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(challenge)
+// Desafios duram dias inteiros no fuso de quem os cria: começam à
+// meia-noite local da data de início e terminam no fim da data final. Vale
+// a data como o cliente a escreveu, qualquer que seja o offset enviado.
+func localChallengeDates(req *CreateChallengeRequest, loc *time.Location) {
+	if !req.StartDate.IsZero() {
+		req.StartDate = dayStart(entryDay(req.StartDate, req.StartDate.Location()), loc)
+	}
+	if !req.EndDate.IsZero() {
+		next := entryDay(req.EndDate, req.EndDate.Location()).AddDate(0, 0, 1)
+		req.EndDate = dayStart(next, loc).Add(-time.Second)
+	}
 }
 
-// Buscar desafio específico
-func getChallenge(w http.ResponseWriter, r *http.Request) {
+// Busca o desafio do {id} da rota, respondendo o erro adequado
+func challengeFromRequest(w http.ResponseWriter, r *http.Request) (*Challenge, bool) {
 	userID := getUserID(r)
 	vars := mux.Vars(r)
 	challengeID, err := strconv.Atoi(vars["id"])
 	if err != nil {
 		http.Error(w, "ID de desafio inválido", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
-	query := `
-		SELECT c.id, c.group_id, c.name, c.description, c.habit_name, c.goal_value, c.goal_type,
-			   c.start_date, c.end_date, c.status, c.creator_id, c.created_at, c.updated_at,
-			   u.id, u.username, u.email,
-			   g.id, g.name, g.privacy,
-			   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id) as participant_count,
-			   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id AND user_id = ?) as is_participating
-		FROM challenges c
-		JOIN users u ON u.id = c.creator_id
-		JOIN ` + "`groups`" + ` g ON g.id = c.group_id
-		WHERE c.id = ?
-	`
-
-	var c Challenge
-	var creator User
-	var group Group
-	var isParticipatingInt int
-	err = db.QueryRow(query, userID, challengeID).Scan(
-		&c.ID, &c.GroupID, &c.Name, &c.Description, &c.HabitName, &c.GoalValue, &c.GoalType,
-		&c.StartDate, &c.EndDate, &c.Status, &c.CreatorID, &c.CreatedAt, &c.UpdatedAt,
-		&creator.ID, &creator.Username, &creator.Email,
-		&group.ID, &group.Name, &group.Privacy,
-		&c.ParticipantCount, &isParticipatingInt)
-
+	c, err := store.GetChallenge(userID, challengeID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Desafio não encontrado", http.StatusNotFound)
-			return
+			return nil, false
 		}
 		log.Printf("Erro ao buscar desafio: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
+	return c, true
+}
 
-	c.Creator = &creator
-	c.Group = &group
-	c.IsParticipating = isParticipatingInt > 0
+// Buscar desafio específico
+func getChallenge(w http.ResponseWriter, r *http.Request) {
+	c, ok := challengeFromRequest(w, r)
+	if !ok {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(c)
@@ -596,27 +451,14 @@ func getChallenge(w http.ResponseWriter, r *http.Request) {
 // Atualizar desafio (apenas criador)
 func updateChallenge(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	vars := mux.Vars(r)
-	challengeID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "ID de desafio inválido", http.StatusBadRequest)
-		return
-	}
 
 	// Verificar se o usuário é o criador do desafio
-	var creatorID int
-	err = db.QueryRow("SELECT creator_id FROM challenges WHERE id = ?", challengeID).Scan(&creatorID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Desafio não encontrado", http.StatusNotFound)
-			return
-		}
-		log.Printf("Erro ao verificar criador do desafio: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	existing, ok := challengeFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if creatorID != userID {
+	if existing.CreatorID != userID {
 		http.Error(w, "Apenas o criador pode atualizar o desafio", http.StatusForbidden)
 		return
 	}
@@ -626,24 +468,29 @@ func updateChallenge(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Dados inválidos", http.StatusBadRequest)
 		return
 	}
-
-	query := `
-		UPDATE challenges 
-		SET name = ?, description = ?, habit_name = ?, goal_value = ?, goal_type = ?,
-			start_date = ?, end_date = ?, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ?
-	`
-	result, err := db.Exec(query, req.Name, req.Description, req.HabitName, req.GoalValue, req.GoalType,
-						  req.StartDate, req.EndDate, challengeID)
-	if err != nil {
-		log.Printf("Erro ao atualizar desafio: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	localChallengeDates(&req, userLocation(userID))
+	if writeValidationErrors(w, "Dados inválidos", req.validate()) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Desafio não encontrado", http.StatusNotFound)
+	challenge := Challenge{
+		ID:          existing.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		HabitName:   req.HabitName,
+		GoalValue:   req.GoalValue,
+		Unit:        challengeUnit(userID, req),
+		GoalType:    req.GoalType,
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+	}
+	if err := store.UpdateChallenge(&challenge); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Desafio não encontrado", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao atualizar desafio: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
@@ -654,49 +501,20 @@ func updateChallenge(w http.ResponseWriter, r *http.Request) {
 // Deletar desafio (apenas criador e se não foi completado por ninguém)
 func deleteChallenge(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	vars := mux.Vars(r)
-	challengeID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "ID de desafio inválido", http.StatusBadRequest)
-		return
-	}
 
 	// Verificar se o usuário é o criador do desafio
-	var creatorID int
-	err = db.QueryRow("SELECT creator_id FROM challenges WHERE id = ?", challengeID).Scan(&creatorID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Desafio não encontrado", http.StatusNotFound)
-		} else {
-			log.Printf("Erro ao verificar criador do desafio: %v", err)
-			http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		}
+	challenge, ok := challengeFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if creatorID != userID {
+	if challenge.CreatorID != userID {
 		http.Error(w, "Apenas o criador pode deletar o desafio", http.StatusForbidden)
 		return
 	}
 
 	// Verificar se algum participante completou o desafio
-	var goalValue int
-	var hasCompletedParticipant bool
-	
-	err = db.QueryRow("SELECT goal_value FROM challenges WHERE id = ?", challengeID).Scan(&goalValue)
-	if err != nil {
-		log.Printf("Erro ao obter meta do desafio: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-
-	err = db.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1 FROM challenge_participants 
-			WHERE challenge_id = ? AND progress >= ?
-		)
-	`, challengeID, goalValue).Scan(&hasCompletedParticipant)
-	
+	hasCompletedParticipant, err := store.HasCompletedParticipant(challenge.ID)
 	if err != nil {
 		log.Printf("Erro ao verificar participantes completados: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
@@ -708,47 +526,14 @@ func deleteChallenge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Iniciar transação para deletar tudo relacionado ao desafio
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("Erro ao iniciar transação: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
-
-	// Deletar participações no desafio
-	_, err = tx.Exec("DELETE FROM challenge_participants WHERE challenge_id = ?", challengeID)
-	if err != nil {
-		log.Printf("Erro ao deletar participações do desafio: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-
-	// Deletar atividades do feed relacionadas ao desafio
-	_, err = tx.Exec("DELETE FROM activity_feeds WHERE challenge_id = ?", challengeID)
-	if err != nil {
-		log.Printf("Erro ao deletar atividades do desafio: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-
-	// Deletar o desafio
-	_, err = tx.Exec("DELETE FROM challenges WHERE id = ?", challengeID)
-	if err != nil {
+	// Deletar participações, atividades do feed e o desafio numa transação
+	if err := store.DeleteChallenge(challenge.ID); err != nil {
 		log.Printf("Erro ao deletar desafio: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	// Confirmar transação
-	if err := tx.Commit(); err != nil {
-		log.Printf("Erro ao confirmar transação: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("Desafio %d deletado com sucesso pelo usuário %d", challengeID, userID)
+	log.Printf("Desafio %d deletado com sucesso pelo usuário %d", challenge.ID, userID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -763,15 +548,12 @@ func joinChallenge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o desafio existe e se o usuário é membro do grupo
-	var groupID int
-	err = db.QueryRow(`
-		SELECT c.group_id FROM challenges c
-		JOIN group_members gm ON gm.group_id = c.group_id
-		WHERE c.id = ? AND gm.user_id = ?
-	`, challengeID, userID).Scan(&groupID)
-
+	challenge, err := store.GetChallenge(userID, challengeID)
+	if err == nil {
+		_, err = store.GetMemberRole(challenge.GroupID, userID)
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Desafio não encontrado ou você não é membro do grupo", http.StatusNotFound)
 			return
 		}
@@ -781,35 +563,24 @@ func joinChallenge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se já está participando
-	var existingID int
-	err = db.QueryRow("SELECT id FROM challenge_participants WHERE challenge_id = ? AND user_id = ?", challengeID, userID).Scan(&existingID)
-	if err == nil {
+	if challenge.IsParticipating {
 		http.Error(w, "Você já está participando deste desafio", http.StatusConflict)
 		return
 	}
 
 	// Adicionar como participante
-	_, err = db.Exec("INSERT INTO challenge_participants (challenge_id, user_id) VALUES (?, ?)", challengeID, userID)
-	if err != nil {
+	if err := store.AddParticipant(challengeID, userID); err != nil {
 		log.Printf("Erro ao participar do desafio: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	// Buscar informações do desafio para o feed
-	var challengeName, challengeHabitName string
-	err = db.QueryRow("SELECT name, habit_name FROM challenges WHERE id = ?", challengeID).Scan(&challengeName, &challengeHabitName)
-	if err != nil {
-		log.Printf("Erro ao buscar desafio para feed: %v", err)
-	} else {
-		// Criar atividade no feed
-		challengeIDPtr := &challengeID
-		metadata := map[string]interface{}{
-			"challenge_name": challengeName,
-			"habit_name": challengeHabitName,
-		}
-		createFeedActivity(userID, "challenge_joined", nil, nil, challengeIDPtr, metadata)
+	// Criar atividade no feed
+	metadata := map[string]interface{}{
+		"challenge_name": challenge.Name,
+		"habit_name":     challenge.HabitName,
 	}
+	createFeedActivity(userID, "challenge_joined", nil, nil, &challengeID, metadata)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Participação no desafio realizada com sucesso"})
@@ -818,45 +589,29 @@ func joinChallenge(w http.ResponseWriter, r *http.Request) {
 // Sair do desafio
 func leaveChallenge(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	vars := mux.Vars(r)
-	challengeID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "ID de desafio inválido", http.StatusBadRequest)
-		return
-	}
 
 	// Verificar se é o criador do desafio
-	var creatorID int
-	err = db.QueryRow("SELECT creator_id FROM challenges WHERE id = ?", challengeID).Scan(&creatorID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Desafio não encontrado", http.StatusNotFound)
-			return
-		}
-		log.Printf("Erro ao verificar desafio: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	challenge, ok := challengeFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if creatorID == userID {
+	if challenge.CreatorID == userID {
 		http.Error(w, "O criador do desafio não pode sair. Delete o desafio se necessário.", http.StatusForbidden)
 		return
 	}
 
 	// Remover da lista de participantes
-	result, err := db.Exec("DELETE FROM challenge_participants WHERE challenge_id = ? AND user_id = ?", challengeID, userID)
-	if err != nil {
+	if err := store.RemoveParticipant(challenge.ID, userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Você não está participando deste desafio", http.StatusNotFound)
+			return
+		}
 		log.Printf("Erro ao sair do desafio: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Você não está participando deste desafio", http.StatusNotFound)
-		return
-	}
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -870,19 +625,13 @@ func getChallengeParticipants(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verificar se o usuário tem acesso ao desafio (membro do grupo)
-	var groupID int
-	err = db.QueryRow(`
-		SELECT c.group_id FROM challenges c
-		JOIN ` + "`groups`" + ` g ON g.id = c.group_id
-		WHERE c.id = ? AND (
-			g.privacy = 'public' OR 
-			EXISTS (SELECT 1 FROM group_members WHERE group_id = g.id AND user_id = ?)
-		)
-	`, challengeID, userID).Scan(&groupID)
-
+	// Verificar se o usuário tem acesso ao desafio (grupo público ou membro do grupo)
+	challenge, err := store.GetChallenge(userID, challengeID)
+	if err == nil && challenge.Group.Privacy != "public" {
+		_, err = store.GetMemberRole(challenge.GroupID, userID)
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Desafio não encontrado ou acesso negado", http.StatusNotFound)
 			return
 		}
@@ -891,45 +640,18 @@ func getChallengeParticipants(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `
-		SELECT cp.id, cp.challenge_id, cp.user_id, cp.progress, cp.notes, cp.joined_at,
-			   u.id, u.username, u.email
-		FROM challenge_participants cp
-		JOIN users u ON u.id = cp.user_id
-		WHERE cp.challenge_id = ?
-		ORDER BY cp.progress DESC, cp.joined_at ASC
-	`
-	
 	log.Printf("Buscando participantes para o desafio %d", challengeID)
 
-	rows, err := db.Query(query, challengeID)
+	participants, err := store.ListParticipants(challengeID)
 	if err != nil {
 		log.Printf("Erro ao buscar participantes: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var participants []ChallengeParticipant
-	for rows.Next() {
-		var cp ChallengeParticipant
-		var u User
-		err := rows.Scan(&cp.ID, &cp.ChallengeID, &cp.UserID, &cp.Progress, &cp.Notes, &cp.JoinedAt,
-						&u.ID, &u.Username, &u.Email)
-		if err != nil {
-			log.Printf("Erro ao escanear participante: %v", err)
-			continue
-		}
-		cp.User = &u
-		log.Printf("Participante encontrado: ID=%d, UserID=%d, Username=%s", cp.ID, cp.UserID, u.Username)
-		participants = append(participants, cp)
-	}
 
-	// Verificar se houve erro durante a iteração
-	if err := rows.Err(); err != nil {
-		log.Printf("Erro durante iteração dos participantes: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
-		return
+	// Edições e entradas retroativas ficam visíveis para o grupo
+	for i := range participants {
+		participants[i].EditedEntries = editedEntryCount(participants[i].UserID, challenge)
 	}
 
 	log.Printf("Total de participantes encontrados: %d", len(participants))
@@ -947,20 +669,19 @@ func updateChallengeProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Progress int    `json:"progress"`
-		Notes    string `json:"notes"`
-	}
+	var req UpdateProgressRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Dados inválidos", http.StatusBadRequest)
 		return
 	}
+	if writeValidationErrors(w, "Dados inválidos", req.validate()) {
+		return
+	}
 
 	// Verificar se está participando do desafio
-	var existingProgress int
-	err = db.QueryRow("SELECT progress FROM challenge_participants WHERE challenge_id = ? AND user_id = ?", challengeID, userID).Scan(&existingProgress)
+	participant, err := store.GetParticipant(challengeID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.Error(w, "Você não está participando deste desafio", http.StatusNotFound)
 			return
 		}
@@ -968,51 +689,51 @@ func updateChallengeProgress(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
+	existingProgress := participant.Progress
 
 	// Atualizar progresso
-	query := "UPDATE challenge_participants SET progress = ?, notes = ?, updated_at = CURRENT_TIMESTAMP WHERE challenge_id = ? AND user_id = ?"
-	result, err := db.Exec(query, req.Progress, req.Notes, challengeID, userID)
-	if err != nil {
+	participant.Progress = req.Progress
+	participant.Notes = &req.Notes
+	if err := store.UpdateParticipantProgress(participant); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Falha ao atualizar progresso", http.StatusInternalServerError)
+			return
+		}
 		log.Printf("Erro ao atualizar progresso: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Falha ao atualizar progresso", http.StatusInternalServerError)
-		return
-	}
-
 	// Buscar informações do desafio para o feed
-	var challengeName, challengeHabitName string
-	var goalValue int
-	err = db.QueryRow("SELECT name, habit_name, goal_value FROM challenges WHERE id = ?", challengeID).Scan(&challengeName, &challengeHabitName, &goalValue)
+	unit := ""
+	challenge, err := store.GetChallenge(userID, challengeID)
 	if err != nil {
 		log.Printf("Erro ao buscar desafio para feed: %v", err)
 	} else {
+		unit = challenge.Unit
 		// Criar atividade no feed apenas se houve progresso significativo
 		if req.Progress > existingProgress {
-			challengeIDPtr := &challengeID
 			metadata := map[string]interface{}{
-				"challenge_name": challengeName,
-				"habit_name": challengeHabitName,
-				"old_progress": existingProgress,
-				"new_progress": req.Progress,
-				"goal_value": goalValue,
-				"notes": req.Notes,
+				"challenge_name": challenge.Name,
+				"habit_name":     challenge.HabitName,
+				"old_progress":   existingProgress,
+				"new_progress":   req.Progress,
+				"goal_value":     challenge.GoalValue,
+				"unit":           challenge.Unit,
+				"notes":          req.Notes,
 			}
-			
+
 			// Criar atividade no feed
-			createFeedActivity(userID, "challenge_progress", nil, nil, challengeIDPtr, metadata)
+			createFeedActivity(userID, "challenge_progress", nil, nil, &challengeID, metadata)
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Progresso atualizado com sucesso",
+		"message":  "Progresso atualizado com sucesso",
 		"progress": req.Progress,
-		"notes": req.Notes,
+		"unit":     unit,
+		"notes":    req.Notes,
 	})
 }
 
@@ -1027,69 +748,16 @@ func getGroupChallenges(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o usuário tem acesso ao grupo
-	var privacy string
-	var isMember int
-	err = db.QueryRow("SELECT g.privacy, " +
-		"(SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND user_id = ?) as is_member " +
-		"FROM " + "`groups`" + " g WHERE g.id = ?", userID, groupID).Scan(&privacy, &isMember)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Grupo não encontrado", http.StatusNotFound)
-			return
-		}
-		log.Printf("Erro ao verificar grupo: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	if _, ok := visibleGroup(w, userID, groupID); !ok {
 		return
 	}
 
-	if privacy != "public" && isMember == 0 {
-		http.Error(w, "Permissão negada", http.StatusForbidden)
-		return
-	}
-
-	query := `
-		SELECT c.id, c.group_id, c.name, c.description, c.habit_name, c.goal_value, c.goal_type, 
-			   c.start_date, c.end_date, c.status, c.creator_id, c.created_at, c.updated_at,
-			   u.id, u.username, u.email,
-			   g.id, g.name, g.privacy,
-			   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id) as participant_count,
-			   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id AND user_id = ?) as is_participating
-		FROM challenges c
-		JOIN users u ON u.id = c.creator_id
-		JOIN ` + "`groups`" + ` g ON g.id = c.group_id
-		WHERE c.group_id = ?
-		ORDER BY c.created_at DESC
-	`
-
-	rows, err := db.Query(query, userID, groupID)
+	challenges, err := store.ListGroupChallenges(userID, groupID)
 	if err != nil {
 		log.Printf("Erro ao buscar desafios do grupo: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var challenges []Challenge
-	for rows.Next() {
-		var c Challenge
-		var creator User
-		var group Group
-		var isParticipatingInt int
-		err := rows.Scan(&c.ID, &c.GroupID, &c.Name, &c.Description, &c.HabitName, &c.GoalValue, &c.GoalType,
-						&c.StartDate, &c.EndDate, &c.Status, &c.CreatorID, &c.CreatedAt, &c.UpdatedAt,
-						&creator.ID, &creator.Username, &creator.Email,
-						&group.ID, &group.Name, &group.Privacy,
-						&c.ParticipantCount, &isParticipatingInt)
-		if err != nil {
-			log.Printf("Erro ao escanear desafio do grupo: %v", err)
-			continue
-		}
-		c.Creator = &creator
-		c.Group = &group
-		c.IsParticipating = isParticipatingInt > 0
-		challenges = append(challenges, c)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(challenges)
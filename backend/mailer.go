@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Envio de e-mails. Em desenvolvimento as mensagens vão para o log ou para
+// arquivos .eml; em produção para um servidor SMTP.
+
+type Mail struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string // opcional
+}
+
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+var mailer Mailer
+
+func newMailer(c Config) (Mailer, error) {
+	switch c.MailDriver {
+	case "log":
+		return logMailer{}, nil
+	case "file":
+		if err := os.MkdirAll(c.MailDir, 0o755); err != nil {
+			return nil, err
+		}
+		return &fileMailer{dir: c.MailDir, from: c.MailFrom}, nil
+	case "smtp":
+		sender, err := mail.ParseAddress(c.MailFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mail_from %q: %w", c.MailFrom, err)
+		}
+		return &smtpMailer{
+			addr:   net.JoinHostPort(c.SMTPHost, c.SMTPPort),
+			host:   c.SMTPHost,
+			user:   c.SMTPUser,
+			pass:   c.SMTPPassword,
+			from:   c.MailFrom,
+			sender: sender.Address,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", c.MailDriver)
+	}
+}
+
+// Monta a mensagem MIME (texto e, se houver, HTML)
+func buildMessage(from string, mail Mail) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(mail.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if mail.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		b.WriteString(mail.Text)
+		return []byte(b.String())
+	}
+
+	boundary := fmt.Sprintf("habits-%d", time.Now().UnixNano())
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, mail.Text)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", boundary, mail.HTML)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return []byte(b.String())
+}
+
+// Remove quebras de linha que permitiriam injetar cabeçalhos
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(mail Mail) error {
+	log.Printf("Mail to %s: %s\n%s", mail.To, mail.Subject, mail.Text)
+	return nil
+}
+
+// Grava cada mensagem como um arquivo .eml no diretório configurado
+type fileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+func (m *fileMailer) Send(mail Mail) error {
+	name := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102-150405"), m.seq.Add(1)%1000)
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, mail), 0o644)
+}
+
+type smtpMailer struct {
+	addr string
+	host string
+	user string
+	pass string
+	from string // cabeçalho From, com o nome
+	// Só o endereço de from, para o MAIL FROM do envelope
+	sender string
+}
+
+func (m *smtpMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.pass, m.host)
+	}
+	return smtp.SendMail(m.addr, auth, m.sender, []string{headerValue(mail.To)}, buildMessage(m.from, mail))
+}
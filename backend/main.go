@@ -1,17 +1,17 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -24,6 +24,22 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  string    `json:"password,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+
+	EmailVerified    bool `json:"email_verified"`
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarPath  string `json:"-"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Timezone    string `json:"timezone"`
+	Locale      string `json:"locale"`
+	WeekStart   int    `json:"week_start"` // 0 = domingo ... 6 = sábado
+	// Horário de silêncio (HH:MM no fuso do usuário); vazio = desligado
+	QuietHoursStart string `json:"quiet_hours_start"`
+	QuietHoursEnd   string `json:"quiet_hours_end"`
+	// Resumo por e-mail: off, daily ou weekly (digest.go)
+	DigestFrequency string `json:"digest_frequency"`
 }
 
 type Habit struct {
@@ -37,18 +53,52 @@ type Habit struct {
 	Category    string    `json:"category"`
 	Icon        string    `json:"icon"`
 	Goal        int       `json:"goal"`
-	GoalType    string    `json:"goal_type"` // "streak", "count", "weekly", "monthly"
+	GoalType    string    `json:"goal_type"` // "streak", "count", "weekly", "monthly", "yearly", "rolling", "range"
+	GoalWindowDays int    `json:"goal_window_days,omitempty"` // "rolling": N vezes em quaisquer N dias
+	GoalStartDate string  `json:"goal_start_date,omitempty"` // "range": YYYY-MM-DD
+	GoalEndDate   string  `json:"goal_end_date,omitempty"`
 	ReminderEnabled bool  `json:"reminder_enabled"`
 	ReminderTime string   `json:"reminder_time"` // HH:MM format (legacy)
 	ReminderTimes []string `json:"reminder_times"` // Array de horários HH:MM
+	ReminderMode string   `json:"reminder_mode"` // "fixed" ou "adaptive" (horário sugerido pelas conclusões)
 	Visibility  string    `json:"visibility"` // "public", "private", "friends"
+	Schedule    Schedule  `json:"schedule"` // dias em que o hábito é esperado
+	Unit        string    `json:"unit"` // ex.: "L", "km"; vazio = hábito de contagem
+	TargetValue float64   `json:"target_value"` // meta na unidade por período da meta
+	Polarity    string    `json:"polarity"` // "build" ou "quit" (entradas são recaídas)
+	LastGoalReset *time.Time `json:"last_goal_reset,omitempty"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt     *time.Time `json:"purge_at,omitempty"` // fim do prazo para restaurar
+	Tags        []string  `json:"tags"`
+	SortOrder   int       `json:"sort_order"` // posição na lista (PUT /habits/order)
 }
 
 type HabitEntry struct {
 	ID          int       `json:"id"`
 	HabitID     int       `json:"habit_id"`
 	CompletedAt time.Time `json:"completed_at"`
+	Value       float64   `json:"value"` // quantidade na unidade do hábito; 1 sem unidade
 	Notes       string    `json:"notes,omitempty"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"` // última edição (entries.go)
+}
+
+// Alteração no histórico de uma entrada: create, update ou delete. Na
+// criação só os campos new_* vêm preenchidos; na remoção, só os old_*.
+type EntryChange struct {
+	ID             int        `json:"id"`
+	EntryID        int        `json:"entry_id"`
+	HabitID        int        `json:"habit_id"`
+	Action         string     `json:"action"`
+	OldCompletedAt *time.Time `json:"old_completed_at,omitempty"`
+	NewCompletedAt *time.Time `json:"new_completed_at,omitempty"`
+	OldValue       *float64   `json:"old_value,omitempty"`
+	NewValue       *float64   `json:"new_value,omitempty"`
+	OldNotes       *string    `json:"old_notes,omitempty"`
+	NewNotes       *string    `json:"new_notes,omitempty"`
+	ChangedAt      time.Time  `json:"changed_at"`
+	// Registrada num dia local posterior ao da conclusão
+	Backdated      bool       `json:"backdated,omitempty"`
 }
 
 type HabitStats struct {
@@ -56,6 +106,10 @@ type HabitStats struct {
 	TotalCount    int `json:"total_count"`
 	CurrentStreak int `json:"current_streak"`
 	LongestStreak int `json:"longest_streak"`
+	StreakUnit    string `json:"streak_unit"` // "days", "weeks" ou "months", conforme a agenda
+	// Hábitos "quit": o streak atual são os dias limpos e o maior, a maior abstinência
+	Polarity    string     `json:"polarity"`
+	LastRelapse *time.Time `json:"last_relapse,omitempty"`
 }
 
 type GoalCompletion struct {
@@ -66,7 +120,10 @@ type GoalCompletion struct {
 	CompletedAt time.Time `json:"completed_at"`
 	PeriodStart time.Time `json:"period_start"`
 	PeriodEnd   time.Time `json:"period_end"`
+	PeriodDefinition string `json:"period_definition,omitempty"` // ex.: "week:monday", "rolling:7d"
 	ActualCount int       `json:"actual_count"`
+	// Período encerrado sem atingir a meta (gravado pelo job de metas)
+	Missed      bool      `json:"missed,omitempty"`
 	Notes       string    `json:"notes,omitempty"`
 }
 
@@ -82,8 +139,10 @@ type RegisterRequest struct {
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // segundos até o access token expirar
+	User         User   `json:"user"`
 }
 
 // Estruturas para sistema de amigos e feed
@@ -180,7 +239,8 @@ type Challenge struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	HabitName   string    `json:"habit_name"`
-	GoalValue   int       `json:"goal_value"`
+	GoalValue   float64   `json:"goal_value"`
+	Unit        string    `json:"unit"` // unidade do hábito; vazio = dias/vezes
 	GoalType    string    `json:"goal_type"` // "count", "streak", "weekly", "monthly"
 	StartDate   time.Time `json:"start_date"`
 	EndDate     time.Time `json:"end_date"`
@@ -192,7 +252,7 @@ type Challenge struct {
 	Group                 *Group `json:"group,omitempty"`
 	ParticipantCount      int   `json:"participant_count,omitempty"`
 	IsParticipating       bool  `json:"is_participating,omitempty"`
-	UserProgress          int   `json:"user_progress,omitempty"`
+	UserProgress          float64 `json:"user_progress,omitempty"`
 	HasCompletedParticipant bool `json:"has_completed_participant,omitempty"`
 }
 
@@ -200,10 +260,13 @@ type ChallengeParticipant struct {
 	ID          int       `json:"id"`
 	ChallengeID int       `json:"challenge_id"`
 	UserID      int       `json:"user_id"`
-	Progress    int       `json:"progress"`
+	Progress    float64   `json:"progress"`
 	Notes       *string   `json:"notes,omitempty"`
 	JoinedAt    time.Time `json:"joined_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	// Entradas do hábito do desafio editadas, removidas ou registradas
+	// retroativamente durante o desafio
+	EditedEntries int `json:"edited_entries"`
 	// Dados relacionados
 	User      *User      `json:"user,omitempty"`
 	Challenge *Challenge `json:"challenge,omitempty"`
@@ -223,37 +286,90 @@ type CreateChallengeRequest struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	HabitName   string    `json:"habit_name"`
-	GoalValue   int       `json:"goal_value"`
+	GoalValue   float64   `json:"goal_value"`
+	Unit        string    `json:"unit"`
 	GoalType    string    `json:"goal_type"`
 	StartDate   time.Time `json:"start_date"`
 	EndDate     time.Time `json:"end_date"`
 }
 
 type UpdateProgressRequest struct {
-	Progress int    `json:"progress"`
-	Notes    string `json:"notes"`
+	Progress float64 `json:"progress"`
+	Notes    string  `json:"notes"`
 }
 
-var db *sql.DB
-var jwtSecret = []byte("your-secret-key-change-in-production")
+var store Store
+var config Config
+var jwtSecret []byte
 
 func main() {
-	// Initialize database
+	configPath := flag.String("config", "", "path to a JSON config file (or set CONFIG_FILE)")
+	dbDriver := flag.String("db-driver", "", "database driver: mysql or sqlite (overrides DB_DRIVER)")
+	dbDSN := flag.String("db-dsn", "", "database DSN (overrides DB_DSN)")
+	flag.Parse()
+
 	var err error
-	dsn := "root:rootpass123@tcp(localhost:3306)/habit_tracker?parseTime=true"
-	db, err = sql.Open("mysql", dsn)
+	config, err = loadConfig(*configPath)
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	if *dbDriver != "" {
+		config.DBDriver = *dbDriver
+	}
+	if *dbDSN != "" {
+		config.DBDSN = *dbDSN
+	}
+	if err := config.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if config.JWTSecret == defaultJWTSecret {
+		log.Println("Warning: using the default JWT secret, set JWT_SECRET before deploying")
+	}
+	jwtSecret = []byte(config.JWTSecret)
+
+	mailer, err = newMailer(config)
+	if err != nil {
+		log.Fatal("Error configuring mailer: ", err)
+	}
+	notifier, err = newNotifier(config)
+	if err != nil {
+		log.Fatal("Error configuring notifier: ", err)
+	}
+
+	// Initialize database
+	store, err = openStore(config.DBDriver, config.DBDSN)
 	if err != nil {
 		log.Fatal("Error connecting to database:", err)
 	}
-	defer db.Close()
+	defer store.Close()
+	limits = newRateLimits(config, store)
+
+	// Subcomando: track_habits [flags] migrate up|down|status
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrateCommand(flag.Args()[1:]); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		return
+	}
+
+	applied, err := store.MigrateUp()
+	if err != nil {
+		log.Fatal("Error migrating database: ", err)
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+	}
+	fmt.Println("Database schema is up to date")
 
-	// Test database connection
-	if err = db.Ping(); err != nil {
-		log.Fatal("Error pinging database:", err)
+	if err := initWebPush(config); err != nil {
+		log.Fatal("Error configuring Web Push: ", err)
 	}
 
-	// Initialize database tables
-	initDB()
+	// Resultado das metas ao fim de cada período (goal_job.go)
+	startGoalJob(config.GoalJobInterval)
+	startHabitPurgeJob(config.HabitPurgeInterval)
+	startReminderScheduler(config.ReminderInterval)
+	startDigestJob(config.DigestInterval)
 
 	r := mux.NewRouter()
 	
@@ -261,27 +377,93 @@ func main() {
 	api := r.PathPrefix("/api").Subrouter()
 	
 	// Auth routes
-	api.HandleFunc("/auth/register", register).Methods("POST")
-	api.HandleFunc("/login", login).Methods("POST")
+	api.HandleFunc("/auth/register", rateLimited("register", register)).Methods("POST")
+	api.HandleFunc("/login", rateLimited("login", login)).Methods("POST")
+	api.HandleFunc("/auth/refresh", refreshSession).Methods("POST")
+	api.HandleFunc("/auth/forgot-password", rateLimited("forgot-password", forgotPassword)).Methods("POST")
+	api.HandleFunc("/auth/reset-password", rateLimited("reset-password", resetPassword)).Methods("POST")
+	api.HandleFunc("/auth/verify-email", rateLimited("verify-email", verifyEmail)).Methods("POST")
+	api.HandleFunc("/auth/2fa/verify", rateLimited("2fa-verify", verifyTwoFactorLogin)).Methods("POST")
+	api.HandleFunc("/push/public-key", getPushPublicKey).Methods("GET")
+	api.HandleFunc("/digest/unsubscribe", rateLimited("digest-unsubscribe", unsubscribeDigest)).Methods("POST")
 	
 	// Protected routes
 	protected := api.PathPrefix("").Subrouter()
 	protected.Use(authMiddleware)
+
+	// Session routes
+	protected.HandleFunc("/auth/logout", logout).Methods("POST")
+	protected.HandleFunc("/auth/logout-all", logoutAll).Methods("POST")
+	protected.HandleFunc("/auth/sessions", getSessions).Methods("GET")
+	protected.HandleFunc("/auth/sessions/{id}", revokeSession).Methods("DELETE")
+	protected.HandleFunc("/auth/resend-verification", resendVerification).Methods("POST")
+	protected.HandleFunc("/auth/2fa/enroll", enrollTwoFactor).Methods("POST")
+	protected.HandleFunc("/auth/2fa/confirm", confirmTwoFactor).Methods("POST")
+	protected.HandleFunc("/auth/2fa/disable", disableTwoFactor).Methods("POST")
+	protected.HandleFunc("/auth/2fa/recovery-codes", regenerateRecoveryCodes).Methods("POST")
+
+	// Profile routes
+	protected.HandleFunc("/me", getMe).Methods("GET")
+	protected.HandleFunc("/me", updateMe).Methods("PATCH")
+	protected.HandleFunc("/me", deleteMe).Methods("DELETE")
+	protected.HandleFunc("/me/avatar", uploadAvatar).Methods("POST")
+	protected.HandleFunc("/me/avatar", deleteAvatar).Methods("DELETE")
+	protected.HandleFunc("/me/password", changePassword).Methods("POST")
+	protected.HandleFunc("/me/email", changeEmail).Methods("POST")
+	protected.HandleFunc("/me/export", exportData).Methods("GET")
+	protected.HandleFunc("/me/import", importData).Methods("POST")
+	protected.HandleFunc("/me/digest", getDigestPreview).Methods("GET")
+
+	// Personal access token routes
+	protected.HandleFunc("/tokens", getAccessTokens).Methods("GET")
+	protected.HandleFunc("/tokens", createAccessToken).Methods("POST")
+	protected.HandleFunc("/tokens/{id}", revokeAccessToken).Methods("DELETE")
+
+	// Web Push subscription routes
+	protected.HandleFunc("/push/subscriptions", getPushSubscriptions).Methods("GET")
+	protected.HandleFunc("/push/subscriptions", createPushSubscription).Methods("POST")
+	protected.HandleFunc("/push/subscriptions/test", testPushSubscriptions).Methods("POST")
+	protected.HandleFunc("/push/subscriptions/{id}", deletePushSubscription).Methods("DELETE")
 	
 	// Habit routes
 	protected.HandleFunc("/habits", getHabits).Methods("GET")
 	protected.HandleFunc("/habits", createHabit).Methods("POST")
+	protected.HandleFunc("/habits/deleted", getDeletedHabits).Methods("GET")
+	protected.HandleFunc("/habits/order", reorderHabits).Methods("PUT")
 	protected.HandleFunc("/habits/{id}", getHabit).Methods("GET")
 	protected.HandleFunc("/habits/{id}", updateHabit).Methods("PUT")
 	protected.HandleFunc("/habits/{id}", deleteHabit).Methods("DELETE")
+	protected.HandleFunc("/habits/{id}/archive", archiveHabit).Methods("POST")
+	protected.HandleFunc("/habits/{id}/unarchive", unarchiveHabit).Methods("POST")
+	protected.HandleFunc("/habits/{id}/restore", restoreHabit).Methods("POST")
 	
 	// Habit entry routes
 	protected.HandleFunc("/habits/{id}/entries", getHabitEntries).Methods("GET")
 	protected.HandleFunc("/habits/{id}/entries", createHabitEntry).Methods("POST")
+	protected.HandleFunc("/habits/{id}/entries/bulk", createHabitEntries).Methods("POST")
+	protected.HandleFunc("/habits/{id}/entries/history", getHabitEntryHistory).Methods("GET")
+	protected.HandleFunc("/habits/{id}/entries/{entryId}", updateHabitEntry).Methods("PUT")
 	protected.HandleFunc("/habits/{id}/entries/{entryId}", deleteHabitEntry).Methods("DELETE")
+	protected.HandleFunc("/habits/{id}/entries/{entryId}/history", getHabitEntryHistory).Methods("GET")
 	protected.HandleFunc("/habits/{id}/stats", getHabitStats).Methods("GET")
+	protected.HandleFunc("/habits/{id}/reminders/snooze", snoozeHabitReminder).Methods("POST")
+	protected.HandleFunc("/habits/{id}/reminder-suggestion", getReminderSuggestion).Methods("GET")
 	
 	// Goal completion routes
+	protected.HandleFunc("/habits/{id}/skips", getHabitSkips).Methods("GET")
+	protected.HandleFunc("/habits/{id}/skips", createHabitSkip).Methods("POST")
+	protected.HandleFunc("/habits/{id}/skips/{date}", deleteHabitSkip).Methods("DELETE")
+	protected.HandleFunc("/pauses", getPauses).Methods("GET")
+	protected.HandleFunc("/pauses", createPause).Methods("POST")
+	protected.HandleFunc("/pauses/{id}", deletePause).Methods("DELETE")
+	protected.HandleFunc("/tags", getTags).Methods("GET")
+	protected.HandleFunc("/tags/{id}", updateTag).Methods("PUT")
+	protected.HandleFunc("/tags/{id}", deleteTag).Methods("DELETE")
+	protected.HandleFunc("/habit-views", getHabitViews).Methods("GET")
+	protected.HandleFunc("/habit-views", createHabitView).Methods("POST")
+	protected.HandleFunc("/habit-views/{id}", updateHabitView).Methods("PUT")
+	protected.HandleFunc("/habit-views/{id}", deleteHabitView).Methods("DELETE")
+	protected.HandleFunc("/streak-freezes", getStreakFreezes).Methods("GET")
 	protected.HandleFunc("/habits/{id}/goal-completions", getGoalCompletions).Methods("GET")
 	protected.HandleFunc("/habits/{id}/goal-completions", createGoalCompletion).Methods("POST")
 	protected.HandleFunc("/habits/{id}/check-goal", checkGoalCompletion).Methods("GET")
@@ -327,222 +509,27 @@ func main() {
 	// Analytics routes
 	protected.HandleFunc("/analytics", getAnalytics).Methods("GET")
 
+	// Uploaded files
+	r.HandleFunc("/uploads/avatars/{file}", serveAvatar).Methods("GET")
+
+	// Serviço de push local para testes (pushservice.go)
+	if config.isDev() {
+		newPushServiceStandIn().register(r)
+	}
+
 	// Configure CORS
 	c := cors.New(cors.Options{
-	AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+	AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 	AllowedHeaders:   []string{"*"},
 	AllowCredentials: true,
-	AllowOriginFunc: func(origin string) bool {
-		   return strings.HasPrefix(origin, "http://192.168.0.") || origin == "http://localhost:3000"
-	},
+	AllowOriginFunc:  config.allowOrigin,
 })
 
 	handler := c.Handler(r)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	
-	fmt.Printf("Server starting on :%s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
-}
-
-func initDB() {
-	// Create users table
-	createUsersTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		username VARCHAR(50) UNIQUE NOT NULL,
-		email VARCHAR(100) UNIQUE NOT NULL,
-		password VARCHAR(255) NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`
-
-	// Create habits table
-	createHabitsTable := `
-	CREATE TABLE IF NOT EXISTS habits (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		user_id INT NOT NULL,
-		name VARCHAR(100) NOT NULL,
-		description TEXT,
-		is_active BOOLEAN DEFAULT TRUE,
-		multipleUpdate BOOLEAN DEFAULT FALSE,
-		category VARCHAR(50) DEFAULT 'geral',
-		icon VARCHAR(50) DEFAULT 'target',
-		goal INT DEFAULT 0,
-		goal_type VARCHAR(20) DEFAULT 'streak',
-		reminder_enabled BOOLEAN DEFAULT FALSE,
-		reminder_time VARCHAR(5) DEFAULT '09:00',
-		reminder_times TEXT,
-		last_goal_reset TIMESTAMP NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	)`
-
-	// Create habit_entries table
-	createEntriesTable := `
-	CREATE TABLE IF NOT EXISTS habit_entries (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		habit_id INT NOT NULL,
-		completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		notes TEXT,
-		FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
-	)`
-
-	// Create goal_completions table
-	createGoalCompletionsTable := `
-	CREATE TABLE IF NOT EXISTS goal_completions (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		habit_id INT NOT NULL,
-		goal_type VARCHAR(20) NOT NULL,
-		goal_value INT NOT NULL,
-		completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		period_start DATE NOT NULL,
-		period_end DATE NOT NULL,
-		actual_count INT NOT NULL,
-		notes TEXT,
-		FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
-	)`
-
-	// Create friendships table
-	createFriendshipsTable := `
-	CREATE TABLE IF NOT EXISTS friendships (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		user_id INT NOT NULL,
-		friend_id INT NOT NULL,
-		status ENUM('pending', 'accepted', 'declined') DEFAULT 'pending',
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		FOREIGN KEY (friend_id) REFERENCES users(id) ON DELETE CASCADE
-	)`
-
-	// Create activity_feeds table
-	createActivityFeedsTable := `
-	CREATE TABLE IF NOT EXISTS activity_feeds (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		user_id INT NOT NULL,
-		activity_type VARCHAR(50) NOT NULL,
-		habit_id INT,
-		goal_completion_id INT,
-		challenge_id INT,
-		metadata JSON,
-		visibility ENUM('public', 'private', 'friends') DEFAULT 'public',
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
-		FOREIGN KEY (goal_completion_id) REFERENCES goal_completions(id) ON DELETE CASCADE,
-		FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE
-	)`
-
-	createActivityReactionsTable := `
-		CREATE TABLE IF NOT EXISTS activity_reactions (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		activity_id INT NOT NULL,
-		user_id INT NOT NULL,
-		reaction_type ENUM('like', 'celebrate', 'support', 'wow') DEFAULT 'like',
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (activity_id) REFERENCES activity_feeds(id) ON DELETE CASCADE,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE KEY unique_reaction (activity_id, user_id)
-	)`
-
-	createActivityCommentsTable := `
-		CREATE TABLE IF NOT EXISTS activity_comments (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		activity_id INT NOT NULL,
-		user_id INT NOT NULL,
-		comment TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (activity_id) REFERENCES activity_feeds(id) ON DELETE CASCADE,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		INDEX idx_activity_created (activity_id, created_at)
-	);`
-
-	// Create groups table
-	createGroupsTable := `
-	CREATE TABLE IF NOT EXISTS ` + "`groups`" + ` (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		name VARCHAR(100) NOT NULL,
-		description TEXT,
-		privacy ENUM('public', 'private', 'invite_only') DEFAULT 'public',
-		creator_id INT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
-	)`
-
-	// Create group_members table
-	createGroupMembersTable := `
-	CREATE TABLE IF NOT EXISTS group_members (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		group_id INT NOT NULL,
-		user_id INT NOT NULL,
-		role ENUM('admin', 'moderator', 'member') DEFAULT 'member',
-		joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (group_id) REFERENCES ` + "`groups`" + `(id) ON DELETE CASCADE,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE KEY unique_membership (group_id, user_id)
-	)`
-
-	// Create challenges table
-	createChallengesTable := `
-	CREATE TABLE IF NOT EXISTS challenges (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		group_id INT NOT NULL,
-		creator_id INT NOT NULL,
-		name VARCHAR(100) NOT NULL,
-		description TEXT,
-		habit_name VARCHAR(100) NOT NULL,
-		goal_value INT NOT NULL,
-		goal_type ENUM('count', 'streak', 'weekly', 'monthly') DEFAULT 'count',
-		start_date DATE NOT NULL,
-		end_date DATE NOT NULL,
-		status ENUM('upcoming', 'active', 'completed', 'cancelled') DEFAULT 'upcoming',
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (group_id) REFERENCES ` + "`groups`" + `(id) ON DELETE CASCADE,
-		FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
-	)`
-
-	// Create challenge_participants table
-	createChallengeParticipantsTable := `
-	CREATE TABLE IF NOT EXISTS challenge_participants (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		challenge_id INT NOT NULL,
-		user_id INT NOT NULL,
-		progress INT DEFAULT 0,
-		notes TEXT,
-		joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE KEY unique_participation (challenge_id, user_id)
-	)`
-
-	tables := []string{createUsersTable, createHabitsTable, createEntriesTable, createGoalCompletionsTable, createFriendshipsTable, createGroupsTable, createGroupMembersTable, createChallengesTable, createChallengeParticipantsTable, createActivityFeedsTable, createActivityReactionsTable, createActivityCommentsTable}
-	
-	for _, table := range tables {
-		if _, err := db.Exec(table); err != nil {
-			log.Fatal("Error creating table:", err)
-		}
-	}
-
-	// Add last_goal_reset column if it doesn't exist (migration)
-	_, err := db.Exec("ALTER TABLE habits ADD COLUMN last_goal_reset TIMESTAMP NULL")
-	if err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
-		log.Printf("Warning: Could not add last_goal_reset column: %v", err)
-	}
-
-	// Add visibility column if it doesn't exist (migration)
-	_, err = db.Exec("ALTER TABLE habits ADD COLUMN visibility ENUM('public', 'private', 'friends') DEFAULT 'public'")
-	if err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
-		log.Printf("Warning: Could not add visibility column: %v", err)
-	}
-
-	fmt.Println("Database tables initialized successfully")
+	fmt.Printf("Server starting on :%s (%s)\n", config.Port, config.Env)
+	log.Fatal(http.ListenAndServe(":"+config.Port, handler))
 }
 
 func hashPassword(password string) (string, error) {
@@ -564,19 +551,28 @@ func reminderTimesToString(times []string) string {
 	return string(timesJSON)
 }
 
-func stringToReminderTimes(str string) []string {
+// Lê a coluna reminder_times; erro se não for uma lista JSON de HH:MM
+func stringToReminderTimes(str string) ([]string, error) {
 	if str == "" {
-		return []string{}
+		return []string{}, nil
 	}
 	var times []string
-	json.Unmarshal([]byte(str), &times)
-	return times
+	if err := json.Unmarshal([]byte(str), &times); err != nil {
+		return nil, fmt.Errorf("invalid reminder_times %q: %w", str, err)
+	}
+	for _, t := range times {
+		if _, err := parseClock(t); err != nil {
+			return nil, fmt.Errorf("invalid reminder_times %q: %w", str, err)
+		}
+	}
+	return times, nil
 }
 
-func generateJWT(userID int) (string, error) {
+func generateJWT(userID, sessionID int) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		"sid":     sessionID,
+		"exp":     time.Now().Add(config.TokenLifetime).Unix(),
 	})
 
 	return token.SignedString(jwtSecret)
@@ -584,6 +580,10 @@ func generateJWT(userID int) (string, error) {
 
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// These headers are only ever set by this middleware
+		r.Header.Del("user_id")
+		r.Header.Del("session_id")
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
@@ -596,6 +596,17 @@ func authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Personal access tokens (scripts and integrations)
+		if strings.HasPrefix(bearerToken[1], accessTokenPrefix) {
+			userID, ok := authenticateAccessToken(w, r, bearerToken[1])
+			if !ok {
+				return
+			}
+			r.Header.Set("user_id", strconv.Itoa(userID))
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		token, err := jwt.Parse(bearerToken[1], func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -608,13 +619,23 @@ func authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID := int(claims["user_id"].(float64))
-			r.Header.Set("user_id", strconv.Itoa(userID))
-			next.ServeHTTP(w, r)
-		} else {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok || !token.Valid {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
 		}
+
+		// Tokens sem sessão (anteriores aos refresh tokens) não são aceitos
+		userID, okUser := claims["user_id"].(float64)
+		sessionID, okSession := claims["sid"].(float64)
+		if !okUser || !okSession || !checkSession(int(userID), int(sessionID)) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		r.Header.Set("user_id", strconv.Itoa(int(userID)))
+		r.Header.Set("session_id", strconv.Itoa(int(sessionID)))
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -632,6 +653,10 @@ func register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Username, email, and password are required", http.StatusBadRequest)
 		return
 	}
+	if !validEmail(req.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
 
 	// Hash password
 	hashedPassword, err := hashPassword(req.Password)
@@ -641,10 +666,12 @@ func register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert user into database
-	query := "INSERT INTO users (username, email, password) VALUES (?, ?, ?)"
-	result, err := db.Exec(query, req.Username, req.Email, hashedPassword)
-	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
+	user := User{
+		Username: req.Username,
+		Email:    req.Email,
+	}
+	if err := store.CreateUser(&user, hashedPassword); err != nil {
+		if errors.Is(err, ErrDuplicate) {
 			http.Error(w, "Username or email already exists", http.StatusConflict)
 			return
 		}
@@ -652,26 +679,17 @@ func register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, _ := result.LastInsertId()
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Error sending verification to user %d: %v", user.ID, err)
+	}
 
-	// Generate JWT token
-	token, err := generateJWT(int(userID))
+	// Start a session (access + refresh token)
+	response, err := startSession(r, user)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	user := User{
-		ID:       int(userID),
-		Username: req.Username,
-		Email:    req.Email,
-	}
-
-	response := AuthResponse{
-		Token: token,
-		User:  user,
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
@@ -684,13 +702,16 @@ func login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked accounts and IPs are refused before the bcrypt check
+	if !checkLockout(w, r, req.Email) {
+		return
+	}
+
 	// Get user from database
-	var user User
-	var hashedPassword string
-	query := "SELECT id, username, email, password FROM users WHERE email = ?"
-	err := db.QueryRow(query, req.Email).Scan(&user.ID, &user.Username, &user.Email, &hashedPassword)
+	user, hashedPassword, err := store.GetUserByEmail(req.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
+			recordLoginFailure(r, req.Email, nil)
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -700,20 +721,24 @@ func login(w http.ResponseWriter, r *http.Request) {
 
 	// Check password
 	if !checkPasswordHash(req.Password, hashedPassword) {
+		recordLoginFailure(r, req.Email, user)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(user.ID)
-	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+	// With 2FA enabled the session is only created after the code step, which
+	// also clears the failure count
+	if user.TwoFactorEnabled {
+		writeTwoFactorChallenge(w, user, hashedPassword)
 		return
 	}
+	clearLoginFailures(req.Email)
 
-	response := AuthResponse{
-		Token: token,
-		User:  user,
+	// Start a session (access + refresh token)
+	response, err := startSession(r, *user)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -726,148 +751,127 @@ func getUserID(r *http.Request) int {
 	return userID
 }
 
-func getHabits(w http.ResponseWriter, r *http.Request) {
+// Busca o hábito do usuário a partir do {id} da rota, respondendo o erro
+// adequado quando não encontrado
+func habitFromRequest(w http.ResponseWriter, r *http.Request) (*Habit, bool) {
 	userID := getUserID(r)
-	
-	query := "SELECT id, user_id, name, description, is_active, multipleUpdate, category, icon, goal, goal_type, reminder_enabled, reminder_time, reminder_times, visibility, created_at FROM habits WHERE user_id = ? ORDER BY created_at DESC"
-	rows, err := db.Query(query, userID)
+	vars := mux.Vars(r)
+	habitID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	habit, err := store.GetHabit(userID, habitID)
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return nil, false
+		}
 		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return habit, true
+}
+
+// Filtros opcionais: tag, category, archived (true ou all) ou active,
+// due_today, visibility e view (filtro salvo); sem archived, só os ativos
+func getHabits(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	filter, ok := habitFilterFromRequest(w, r)
+	if !ok {
 		return
 	}
-	defer rows.Close()
 
-	var habits []Habit
-	for rows.Next() {
-		var habit Habit
-		var reminderTimesStr sql.NullString
-		var visibility sql.NullString
-		err := rows.Scan(&habit.ID, &habit.UserID, &habit.Name, &habit.Description, &habit.IsActive, &habit.MultipleUpdate, &habit.Category, &habit.Icon, &habit.Goal, &habit.GoalType, &habit.ReminderEnabled, &habit.ReminderTime, &reminderTimesStr, &visibility, &habit.CreatedAt)
-		if err != nil {
-			http.Error(w, "Error scanning habits", http.StatusInternalServerError)
-			return
-		}
-		
-		// Definir visibilidade padrão se estiver vazio
-		if visibility.Valid {
-			habit.Visibility = visibility.String
-		} else {
-			habit.Visibility = "public"
-		}
-		
-		// Converter reminder_times do banco para array
-		if reminderTimesStr.Valid && reminderTimesStr.String != "" {
-			habit.ReminderTimes = stringToReminderTimes(reminderTimesStr.String)
-		} else {
-			// Se não tem reminder_times, usar reminder_time como fallback
-			if habit.ReminderTime != "" {
-				habit.ReminderTimes = []string{habit.ReminderTime}
-			} else {
-				habit.ReminderTimes = []string{}
-			}
-		}
-		
-		fmt.Printf("Habit %d: reminder_time='%s', reminder_times_str='%s', final_reminder_times=%v\n", 
-			habit.ID, habit.ReminderTime, reminderTimesStr.String, habit.ReminderTimes)
-		
-		habits = append(habits, habit)
+	all, err := store.ListHabits(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	habits, err := filter.apply(userID, all)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(habits)
 }
 
-func calculateStreaks(db *sql.DB, habitID int) (int, int, error) {
-    // Buscar todas as datas de conclusão ordenadas
-    query := `
-        SELECT DATE(completed_at) as completion_date 
-        FROM habit_entries 
-        WHERE habit_id = ? 
-        ORDER BY completion_date DESC
-    `
-    
-    rows, err := db.Query(query, habitID)
-    if err != nil {
-        return 0, 0, err
-    }
-    defer rows.Close()
-    
-    var dates []time.Time
-    for rows.Next() {
-        var dateStr string
-        if err := rows.Scan(&dateStr); err != nil {
-            return 0, 0, err
-        }
-        date, _ := time.Parse("2006-01-02", dateStr)
-        dates = append(dates, date)
-    }
-    
-    if len(dates) == 0 {
-        return 0, 0, nil
-    }
-    
-    // Calcular current streak
-    currentStreak := calculateCurrentStreak(dates)
-    
-    // Calcular longest streak - implementação simples local
-    maxStreak := 1
-    currentStreakLocal := 1
-    
-    for i := 1; i < len(dates); i++ {
-        // Verificar se a data atual é consecutiva à anterior
-        expectedDate := dates[i-1].AddDate(0, 0, -1)
-        
-        if dates[i].Equal(expectedDate) {
-            currentStreakLocal++
-            if currentStreakLocal > maxStreak {
-                maxStreak = currentStreakLocal
-            }
-        } else {
-            currentStreakLocal = 1
-        }
-    }
-    
-    longestStreak := maxStreak
-    
-    return currentStreak, longestStreak, nil
+// Datas locais distintas de conclusão, da mais recente para a mais antiga
+func completionDates(times []time.Time, loc *time.Location) []time.Time {
+	var dates []time.Time
+	for _, t := range times {
+		day := entryDay(t, loc)
+		if len(dates) == 0 || !dates[len(dates)-1].Equal(day) {
+			dates = append(dates, day)
+		}
+	}
+	return dates
 }
 
-func calculateCurrentStreak(dates []time.Time) int {
-    if len(dates) == 0 {
-        return 0
-    }
-    
-    today := time.Now().Truncate(24 * time.Hour)
-    yesterday := today.AddDate(0, 0, -1)
-    
-    // Se não foi feito hoje nem ontem, streak = 0
-    if !dates[0].Equal(today) && !dates[0].Equal(yesterday) {
-        return 0
-    }
-    
-    streak := 0
-    expectedDate := today
-    
-    // Se não foi feito hoje, começar de ontem
-    if !dates[0].Equal(today) {
-        expectedDate = yesterday
-    }
-    
-    for _, date := range dates {
-        if date.Equal(expectedDate) {
-            streak++
-            expectedDate = expectedDate.AddDate(0, 0, -1)
-        } else {
-            break
-        }
-    }
-    
-    return streak
+// Streaks do hábito contando só os dias (ou períodos) previstos na agenda,
+// com os dias e semanas do calendário do usuário
+func calculateStreaks(habit *Habit, cal Calendar) (int, int, error) {
+	// Buscar todas as datas de conclusão ordenadas
+	times, err := store.EntryTimes(habit.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Hábito negativo: dias limpos desde a última recaída
+	if habit.isQuit() {
+		current, longest, _ := abstinence(habit, times, time.Now(), cal)
+		return current, longest, nil
+	}
+
+	current, longest := scheduleStreaks(habit.Schedule, completionDates(times, cal.Loc), cal, userExcuses(habit.UserID).habit(habit.ID))
+	return current, longest, nil
+}
+
+// Entradas registradas em [from, to] em dias previstos na agenda e a soma
+// dos seus valores (igual à contagem nos hábitos sem unidade)
+func sumDueEntries(habit *Habit, from, to time.Time, loc *time.Location) (int, float64, error) {
+	entries, err := store.ListEntries(habit.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count, total := 0, 0.0
+	for _, entry := range entries {
+		t := entry.CompletedAt
+		if !t.Before(from) && !t.After(to) && habit.Schedule.isDue(entryDay(t, loc)) {
+			count++
+			total += entry.Value
+		}
+	}
+	return count, total, nil
+}
+
+// Meta do período: target_value nos hábitos com unidade, senão goal (vezes)
+func (h *Habit) goalTarget() float64 {
+	if h.Unit != "" && h.TargetValue > 0 {
+		return h.TargetValue
+	}
+	return float64(h.Goal)
+}
+
+// Unidade e meta de hábitos quantitativos
+func validateHabitAmount(habit *Habit) error {
+	habit.Unit = strings.TrimSpace(habit.Unit)
+	if len(habit.Unit) > 20 {
+		return fieldError("unit", "too_long", "Unidade deve ter no máximo 20 caracteres")
+	}
+	if habit.TargetValue < 0 {
+		return fieldError("target_value", "out_of_range", "Valor da meta não pode ser negativo")
+	}
+	return nil
 }
 
 func createHabit(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	
+
 	var habit Habit
 	if err := json.NewDecoder(r.Body).Decode(&habit); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -890,28 +894,19 @@ func createHabit(w http.ResponseWriter, r *http.Request) {
 	if habit.Visibility == "" {
 		habit.Visibility = "public"
 	}
-	
-	// Processar reminder_times
-	var reminderTimesStr string
-	if len(habit.ReminderTimes) > 0 {
-		reminderTimesStr = reminderTimesToString(habit.ReminderTimes)
-	} else if habit.ReminderTime != "" {
-		// Fallback para reminder_time se reminder_times estiver vazio
-		habit.ReminderTimes = []string{habit.ReminderTime}
-		reminderTimesStr = reminderTimesToString(habit.ReminderTimes)
-	}
-
-	query := "INSERT INTO habits (user_id, name, description, is_active, multipleUpdate, category, icon, goal, goal_type, reminder_enabled, reminder_time, reminder_times, visibility) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	result, err := db.Exec(query, userID, habit.Name, habit.Description, true, habit.MultipleUpdate, habit.Category, habit.Icon, habit.Goal, habit.GoalType, habit.ReminderEnabled, habit.ReminderTime, reminderTimesStr, habit.Visibility)
-	if err != nil {
-		http.Error(w, "Error creating habit", http.StatusInternalServerError)
+	if writeValidationErrors(w, "Dados inválidos", habit.validate()) {
 		return
 	}
+	habit.Schedule.normalize(time.Now().In(userLocation(userID)))
+	habit.normalizeGoalPeriod()
 
-	habitID, _ := result.LastInsertId()
-	habit.ID = int(habitID)
 	habit.UserID = userID
 	habit.IsActive = true
+	habit.ArchivedAt = nil
+	if err := store.CreateHabit(&habit); err != nil {
+		http.Error(w, "Error creating habit", http.StatusInternalServerError)
+		return
+	}
 	habit.CreatedAt = time.Now()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -920,94 +915,106 @@ func createHabit(w http.ResponseWriter, r *http.Request) {
 }
 
 func getHabit(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var habit Habit
-	query := "SELECT id, user_id, name, description, is_active, multipleUpdate, category, icon, goal, goal_type, reminder_enabled, reminder_time, reminder_times, visibility, created_at FROM habits WHERE id = ? AND user_id = ?"
-	var reminderTimesStr sql.NullString
-	var visibility sql.NullString
-	err = db.QueryRow(query, habitID, userID).Scan(&habit.ID, &habit.UserID, &habit.Name, &habit.Description, &habit.IsActive, &habit.MultipleUpdate, &habit.Category, &habit.Icon, &habit.Goal, &habit.GoalType, &habit.ReminderEnabled, &habit.ReminderTime, &reminderTimesStr, &visibility, &habit.CreatedAt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(habit)
+}
+
+// Decodifica o corpo em v e devolve os campos presentes nele, para
+// diferenciar um campo ausente de um enviado com o valor zero
+func decodeWithFields(r *http.Request, v interface{}) (map[string]json.RawMessage, error) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Habit not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	
-	// Definir visibilidade padrão se estiver vazio
-	if visibility.Valid {
-		habit.Visibility = visibility.String
-	} else {
-		habit.Visibility = "public"
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
 	}
-	
-	// Converter reminder_times do banco para array
-	if reminderTimesStr.Valid && reminderTimesStr.String != "" {
-		habit.ReminderTimes = stringToReminderTimes(reminderTimesStr.String)
-	} else {
-		// Se não tem reminder_times, usar reminder_time como fallback
-		if habit.ReminderTime != "" {
-			habit.ReminderTimes = []string{habit.ReminderTime}
-		} else {
-			habit.ReminderTimes = []string{}
-		}
-	}
-	
-	fmt.Printf("Single habit %d: reminder_time='%s', reminder_times_str='%s', final_reminder_times=%v\n", 
-		habit.ID, habit.ReminderTime, reminderTimesStr.String, habit.ReminderTimes)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(habit)
+	return fields, json.Unmarshal(body, v)
 }
 
 func updateHabit(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+	existing, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
+	userID, habitID := existing.UserID, existing.ID
 
 	var habit Habit
-	if err := json.NewDecoder(r.Body).Decode(&habit); err != nil {
+	fields, err := decodeWithFields(r, &habit)
+	if err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Processar reminder_times
-	var reminderTimesStr string
-	if len(habit.ReminderTimes) > 0 {
-		reminderTimesStr = reminderTimesToString(habit.ReminderTimes)
-	} else if habit.ReminderTime != "" {
-		// Fallback para reminder_time se reminder_times estiver vazio
-		habit.ReminderTimes = []string{habit.ReminderTime}
-		reminderTimesStr = reminderTimesToString(habit.ReminderTimes)
+	// Campos ausentes do corpo mantêm os valores atuais (o formulário de
+	// edição não envia todos)
+	if _, ok := fields["schedule"]; !ok {
+		habit.Schedule = existing.Schedule
 	}
-
-	query := "UPDATE habits SET name = ?, description = ?, is_active = ?, multipleUpdate = ?, category = ?, icon = ?, goal = ?, goal_type = ?, reminder_enabled = ?, reminder_time = ?, reminder_times = ?, visibility = ? WHERE id = ? AND user_id = ?"
-	result, err := db.Exec(query, habit.Name, habit.Description, habit.IsActive, habit.MultipleUpdate, habit.Category, habit.Icon, habit.Goal, habit.GoalType, habit.ReminderEnabled, habit.ReminderTime, reminderTimesStr, habit.Visibility, habitID, userID)
-	if err != nil {
-		http.Error(w, "Error updating habit", http.StatusInternalServerError)
-		return
+	if _, ok := fields["unit"]; !ok {
+		habit.Unit = existing.Unit
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Habit not found", http.StatusNotFound)
+	if _, ok := fields["target_value"]; !ok {
+		habit.TargetValue = existing.TargetValue
+	}
+	if _, ok := fields["polarity"]; !ok {
+		habit.Polarity = existing.Polarity
+	}
+	if _, ok := fields["goal_type"]; !ok {
+		habit.GoalType = existing.GoalType
+	}
+	if _, ok := fields["goal_window_days"]; !ok {
+		habit.GoalWindowDays = existing.GoalWindowDays
+	}
+	if _, ok := fields["goal_start_date"]; !ok {
+		habit.GoalStartDate = existing.GoalStartDate
+	}
+	if _, ok := fields["goal_end_date"]; !ok {
+		habit.GoalEndDate = existing.GoalEndDate
+	}
+	// Sem visibilidade ou reminder_mode, o hábito mantém os atuais
+	if habit.Visibility == "" {
+		habit.Visibility = existing.Visibility
+	}
+	if habit.ReminderMode == "" {
+		habit.ReminderMode = existing.ReminderMode
+	}
+	if habit.GoalType == "" {
+		habit.GoalType = "streak"
+	}
+	if writeValidationErrors(w, "Dados inválidos", habit.validate()) {
 		return
 	}
+	habit.normalizeGoalPeriod()
+	if habit.Schedule.Type == scheduleInterval && habit.Schedule.StartDate == "" {
+		// Sem data de início, o intervalo conta a partir da criação do hábito
+		habit.Schedule.normalize(existing.CreatedAt.In(userLocation(userID)))
+	}
+	habit.Schedule.normalize(time.Now().In(userLocation(userID)))
 
 	habit.ID = habitID
 	habit.UserID = userID
+	// Arquivar e desarquivar têm rotas próprias
+	habit.IsActive, habit.ArchivedAt = existing.IsActive, existing.ArchivedAt
+	habit.CreatedAt, habit.LastGoalReset = existing.CreatedAt, existing.LastGoalReset
+	habit.SortOrder = existing.SortOrder
+	if habit.Tags == nil {
+		habit.Tags = existing.Tags
+	}
+	if err := store.UpdateHabit(&habit); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error updating habit", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(habit)
@@ -1022,16 +1029,18 @@ func deleteHabit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := "DELETE FROM habits WHERE id = ? AND user_id = ?"
-	result, err := db.Exec(query, habitID, userID)
-	if err != nil {
-		http.Error(w, "Error deleting habit", http.StatusInternalServerError)
-		return
+	// O hábito pode ser restaurado até o fim do prazo; com ?permanent=true
+	// é apagado na hora, junto com o histórico
+	remove := store.DeleteHabit
+	if r.URL.Query().Get("permanent") == "true" {
+		remove = store.PurgeHabit
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Habit not found", http.StatusNotFound)
+	if err := remove(userID, habitID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting habit", http.StatusInternalServerError)
 		return
 	}
 
@@ -1039,77 +1048,29 @@ func deleteHabit(w http.ResponseWriter, r *http.Request) {
 }
 
 func getHabitEntries(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
-		return
-	}
-
 	// Verify habit belongs to user
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
-	if err != nil || count == 0 {
-		http.Error(w, "Habit not found", http.StatusNotFound)
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	query := "SELECT id, habit_id, completed_at, notes FROM habit_entries WHERE habit_id = ? ORDER BY completed_at DESC"
-	rows, err := db.Query(query, habitID)
+	entries, err := store.ListEntries(habit.ID)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var entries []HabitEntry
-	for rows.Next() {
-		var entry HabitEntry
-		var notes sql.NullString
-		err := rows.Scan(&entry.ID, &entry.HabitID, &entry.CompletedAt, &notes)
-		if err != nil {
-			http.Error(w, "Error scanning entries", http.StatusInternalServerError)
-			return
-		}
-		if notes.Valid {
-			entry.Notes = notes.String
-		}
-		entries = append(entries, entry)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(entries)
 }
 
 func createHabitEntry(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
-		return
-	}
-
 	// Verify habit belongs to user
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
-	if err != nil || count == 0 {
-		http.Error(w, "Habit not found", http.StatusNotFound)
-		return
-	}
-
-	var habit Habit
-	query := "SELECT id, user_id, name, description, is_active, multipleUpdate, created_at FROM habits WHERE id = ? AND user_id = ?"
-	err = db.QueryRow(query, habitID, userID).Scan(&habit.ID, &habit.UserID, &habit.Name, &habit.Description, &habit.IsActive, &habit.MultipleUpdate, &habit.CreatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Habit not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
+	habitID := habit.ID
 
 	var entry HabitEntry
 	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
@@ -1117,62 +1078,45 @@ func createHabitEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if already completed today
+	if err := prepareEntry(habit, &entry, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check if already completed on the entry's day (in the user's time zone)
 	if !habit.MultipleUpdate {
-		today := time.Now().Format("2006-01-02")
-		err = db.QueryRow("SELECT COUNT(*) FROM habit_entries WHERE habit_id = ? AND DATE(completed_at) = ?", habitID, today).Scan(&count)
-		if err == nil && count > 0 {
-			http.Error(w, "Habit already completed today", http.StatusConflict)
+		count, err := entriesOnDay(habitID, entry.CompletedAt, userLocation(getUserID(r)), nil)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, "Habit already completed on that day", http.StatusConflict)
 			return
 		}
 	}
-	if entry.CompletedAt.IsZero() {
-		entry.CompletedAt = time.Now()
-	}
-	
-	query = "INSERT INTO habit_entries (habit_id, completed_at, notes) VALUES (?, ?, ?)"
-	result, err := db.Exec(query, habitID, entry.CompletedAt, entry.Notes)
-	if err != nil {
+
+	entry.HabitID = habitID
+	if err := store.CreateEntry(&entry); err != nil {
 		http.Error(w, "Error creating entry", http.StatusInternalServerError)
 		return
 	}
 
-	entryID, _ := result.LastInsertId()
-	entry.ID = int(entryID)
-	entry.HabitID = habitID
-
 	// Criar atividade no feed quando hábito for completado
 	metadata := map[string]interface{}{
 		"habit_name": habit.Name,
-		"notes": entry.Notes,
+		"notes":      entry.Notes,
 	}
-	
-	// Adicionar informação sobre sequência se necessário
+
+	// Adicionar informação sobre sequência se necessário; cada
+	// streakFreezeEvery dias seguidos rendem um congelamento (skips.go)
+	cal := userCalendar(getUserID(r))
+	streak, _, _ := calculateStreaks(habit, cal)
 	if habit.GoalType == "streak" {
-		// Calcular sequência atual
-		streakQuery := `
-			SELECT COUNT(*) as streak FROM (
-				SELECT DATE(completed_at) as date 
-				FROM habit_entries 
-				WHERE habit_id = ? 
-				ORDER BY completed_at DESC
-			) AS dates 
-			WHERE date >= CURDATE() - INTERVAL (
-				SELECT COUNT(DISTINCT DATE(completed_at)) - 1 
-				FROM habit_entries 
-				WHERE habit_id = ? 
-				AND completed_at >= (
-					SELECT MAX(completed_at) - INTERVAL 30 DAY 
-					FROM habit_entries 
-					WHERE habit_id = ?
-				)
-			) DAY
-		`
-		var streak int
-		db.QueryRow(streakQuery, habitID, habitID, habitID).Scan(&streak)
 		metadata["streak_count"] = streak
 	}
-	
+	awardStreakFreeze(habit, streak, cal)
+
 	// Commented out feed activity creation - not implemented yet
 	// err = createFeedActivity(userID, "habit_completed", &habitID, nil, nil, metadata)
 	// if err != nil {
@@ -1186,133 +1130,86 @@ func createHabitEntry(w http.ResponseWriter, r *http.Request) {
 }
 
 func getHabitStats(w http.ResponseWriter, r *http.Request) {
-    userID := getUserID(r)
-    vars := mux.Vars(r)
-    habitID, err := strconv.Atoi(vars["id"])
-    if err != nil {
-        http.Error(w, "Invalid habit ID", http.StatusBadRequest)
-        return
-    }
-
-    // Verificar se o hábito pertence ao usuário
-    var count int
-    err = db.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
-    if err != nil || count == 0 {
-        http.Error(w, "Habit not found", http.StatusNotFound)
-        return
-    }
-
-    // Contar total de entradas
-    var totalCount int
-    err = db.QueryRow("SELECT COUNT(*) FROM habit_entries WHERE habit_id = ?", habitID).Scan(&totalCount)
-    if err != nil {
-        http.Error(w, "Database error", http.StatusInternalServerError)
-        return
-    }
-
-    // Calcular streaks
-    currentStreak, longestStreak, err := calculateStreaks(db, habitID)
-    if err != nil {
-        http.Error(w, "Error calculating streaks", http.StatusInternalServerError)
-        return
-    }
-
-    stats := HabitStats{
-        HabitID:       habitID,
-        TotalCount:    totalCount,
-        CurrentStreak: currentStreak,
-        LongestStreak: longestStreak,
-    }
-
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(stats)
-}
-
-func deleteHabitEntry(w http.ResponseWriter, r *http.Request) {
-    userID := getUserID(r)
-    vars := mux.Vars(r)
-    habitID, err := strconv.Atoi(vars["id"])
-    if err != nil {
-        http.Error(w, "Invalid habit ID", http.StatusBadRequest)
-        return
-    }
-    
-    entryID, err := strconv.Atoi(vars["entryId"])
-    if err != nil {
-        http.Error(w, "Invalid entry ID", http.StatusBadRequest)
-        return
-    }
-
-    // Verificar se o hábito pertence ao usuário
-    var count int
-    err = db.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
-    if err != nil || count == 0 {
-        http.Error(w, "Habit not found", http.StatusNotFound)
-        return
-    }
-
-    // Verificar se a entrada pertence ao hábito
-    err = db.QueryRow("SELECT COUNT(*) FROM habit_entries WHERE id = ? AND habit_id = ?", entryID, habitID).Scan(&count)
-    if err != nil || count == 0 {
-        http.Error(w, "Entry not found", http.StatusNotFound)
-        return
-    }
-
-    // Deletar a entrada
-    query := "DELETE FROM habit_entries WHERE id = ? AND habit_id = ?"
-    result, err := db.Exec(query, entryID, habitID)
-    if err != nil {
-        http.Error(w, "Error deleting entry", http.StatusInternalServerError)
-        return
-    }
-
-    rowsAffected, _ := result.RowsAffected()
-    if rowsAffected == 0 {
-        http.Error(w, "Entry not found", http.StatusNotFound)
-        return
-    }
-
-    w.WriteHeader(http.StatusNoContent)
-}
+	// Verificar se o hábito pertence ao usuário
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+	habitID := habit.ID
 
-// Funções para gerenciamento de histórico de metas
+	// Contar total de entradas
+	totalCount, err := store.CountEntries(habitID, time.Time{}, time.Time{})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
 
-func getGoalCompletions(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
+	// Calcular streaks
+	cal := userCalendar(getUserID(r))
+	currentStreak, longestStreak, err := calculateStreaks(habit, cal)
 	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		http.Error(w, "Error calculating streaks", http.StatusInternalServerError)
 		return
 	}
 
+	stats := HabitStats{
+		HabitID:       habitID,
+		TotalCount:    totalCount,
+		CurrentStreak: currentStreak,
+		LongestStreak: longestStreak,
+		StreakUnit:    habit.Schedule.streakUnit(),
+		Polarity:      habit.polarity(),
+	}
+	if habit.isQuit() {
+		if quit, err := quitHabitStats(habit, 0, cal); err == nil {
+			stats.LastRelapse = quit.LastRelapse
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func deleteHabitEntry(w http.ResponseWriter, r *http.Request) {
 	// Verificar se o hábito pertence ao usuário
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
-	if err != nil || count == 0 {
-		http.Error(w, "Habit not found", http.StatusNotFound)
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	query := `SELECT id, habit_id, goal_type, goal_value, completed_at, period_start, period_end, actual_count, notes 
-			 FROM goal_completions WHERE habit_id = ? ORDER BY completed_at DESC`
-	rows, err := db.Query(query, habitID)
+	vars := mux.Vars(r)
+	entryID, err := strconv.Atoi(vars["entryId"])
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var completions []GoalCompletion
-	for rows.Next() {
-		var completion GoalCompletion
-		err := rows.Scan(&completion.ID, &completion.HabitID, &completion.GoalType, &completion.GoalValue, 
-			&completion.CompletedAt, &completion.PeriodStart, &completion.PeriodEnd, &completion.ActualCount, &completion.Notes)
-		if err != nil {
-			http.Error(w, "Error scanning completions", http.StatusInternalServerError)
+	// Deletar a entrada, desde que pertença ao hábito
+	if err := store.DeleteEntry(habit.ID, entryID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Entry not found", http.StatusNotFound)
 			return
 		}
-		completions = append(completions, completion)
+		http.Error(w, "Error deleting entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Funções para gerenciamento de histórico de metas
+
+func getGoalCompletions(w http.ResponseWriter, r *http.Request) {
+	// Verificar se o hábito pertence ao usuário
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	completions, err := store.ListGoalCompletions(habit.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1335,48 +1232,28 @@ func createGoalCompletion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar se o hábito pertence ao usuário
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
-	if err != nil || count == 0 {
+	habit, err := store.GetHabit(userID, habitID)
+	if err != nil {
 		http.Error(w, "Habit not found", http.StatusNotFound)
 		return
 	}
 
+	// Registrar com qual definição de período a meta foi calculada
+	if completion.PeriodDefinition == "" {
+		completion.PeriodDefinition = habit.periodSpec().definition(userCalendar(userID))
+	}
+
 	completion.HabitID = habitID
-	
-	query := `INSERT INTO goal_completions (habit_id, goal_type, goal_value, period_start, period_end, actual_count, notes) 
-			 VALUES (?, ?, ?, ?, ?, ?, ?)`
-	result, err := db.Exec(query, completion.HabitID, completion.GoalType, completion.GoalValue, 
-		completion.PeriodStart, completion.PeriodEnd, completion.ActualCount, completion.Notes)
-	if err != nil {
+	completion.CompletedAt = time.Now()
+	if err := store.CreateGoalCompletion(&completion); err != nil {
 		http.Error(w, "Error creating goal completion", http.StatusInternalServerError)
 		return
 	}
 
-	completionID, _ := result.LastInsertId()
-	completion.ID = int(completionID)
-	completion.CompletedAt = time.Now()
-
-	// Buscar nome do hábito para o feed
-	var habitName string
-	db.QueryRow("SELECT name FROM habits WHERE id = ?", habitID).Scan(&habitName)
-
-	// Criar atividade no feed quando meta for completada (commented out - not implemented yet)
-	/*
-	metadata := map[string]interface{}{
-		"habit_name": habitName,
-		"goal_type": completion.GoalType,
-		"goal_value": completion.GoalValue,
-		"actual_count": completion.ActualCount,
-		"notes": completion.Notes,
+	// Criar atividade no feed quando meta for completada
+	if !completion.Missed {
+		goalAchievedActivity(habit, &completion)
 	}
-	
-	err = createFeedActivity(userID, "goal_achieved", &habitID, &completion.ID, nil, metadata)
-	if err != nil {
-		log.Printf("Erro ao criar atividade no feed para meta completada: %v", err)
-		// Não interromper o fluxo por erro no feed
-	}
-	*/
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(completion)
@@ -1384,128 +1261,95 @@ func createGoalCompletion(w http.ResponseWriter, r *http.Request) {
 
 func checkGoalCompletion(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
-		return
-	}
-
-	fmt.Printf("=== CHECK GOAL COMPLETION ===\n")
-	fmt.Printf("User ID: %d, Habit ID: %d\n", userID, habitID)
 
 	// Buscar informações do hábito
-	var habit Habit
-	var lastResetTime sql.NullTime
-	query := "SELECT id, goal, goal_type, last_goal_reset FROM habits WHERE id = ? AND user_id = ?"
-	err = db.QueryRow(query, habitID, userID).Scan(&habit.ID, &habit.Goal, &habit.GoalType, &lastResetTime)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Habit not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
+	habitID := habit.ID
 
-	fmt.Printf("Habit: Goal=%d, GoalType=%s, LastReset=%v\n", habit.Goal, habit.GoalType, lastResetTime)
-
-	if habit.Goal == 0 {
+	if habit.goalTarget() == 0 {
 		// Sem meta definida
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"has_goal": false,
+			"has_goal":       false,
 			"goal_completed": false,
 		})
 		return
 	}
 
-	// Calcular período atual baseado no tipo de meta
-	now := time.Now()
-	var periodStart, periodEnd time.Time
-	var actualCount int
-
-	switch habit.GoalType {
-	case "count":
-		// Meta diária
-		periodStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		periodEnd = periodStart.Add(24 * time.Hour).Add(-time.Second)
-	case "weekly":
-		// Meta semanal (domingo a sábado)
-		weekday := int(now.Weekday())
-		periodStart = now.AddDate(0, 0, -weekday)
-		periodStart = time.Date(periodStart.Year(), periodStart.Month(), periodStart.Day(), 0, 0, 0, 0, now.Location())
-		periodEnd = periodStart.AddDate(0, 0, 7).Add(-time.Second)
-	case "monthly":
-		// Meta mensal
-		periodStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-		periodEnd = periodStart.AddDate(0, 1, 0).Add(-time.Second)
-	default:
+	// Hábito negativo: a meta é ficar goal dias seguidos sem recaída
+	cal := userCalendar(userID)
+	if habit.isQuit() {
+		daysClean, _, err := calculateStreaks(habit, cal)
+		if err != nil {
+			http.Error(w, "Error calculating streaks", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"has_goal":       true,
+			"goal_completed": daysClean >= habit.Goal,
+			"needs_renewal":  false,
+			"days_clean":     daysClean,
+			"target_count":   habit.Goal,
+			"polarity":       habit.Polarity,
+		})
+		return
+	}
+
+	// Calcular período atual baseado no tipo de meta (period.go)
+	period, ok := habit.periodSpec().current(cal)
+	if !ok {
 		// Meta de sequência não precisa de renovação
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"has_goal": true,
+			"has_goal":       true,
 			"goal_completed": false,
-			"needs_renewal": false,
+			"needs_renewal":  false,
 		})
 		return
 	}
 
-	fmt.Printf("Period: %s to %s\n", periodStart.Format("2006-01-02 15:04:05"), periodEnd.Format("2006-01-02 15:04:05"))
+	periodStart, periodEnd := period.Start, period.End
 
-	// Contar entradas do período atual, mas apenas após o último reset (se houver)
-	var countQuery string
-	var queryArgs []interface{}
-	
-	if lastResetTime.Valid {
-		// Se houve reset, contar apenas entradas após o reset
-		countQuery = `SELECT COUNT(*) FROM habit_entries 
-					 WHERE habit_id = ? AND completed_at >= ? AND completed_at <= ? AND completed_at > ?`
-		queryArgs = []interface{}{habitID, periodStart, periodEnd, lastResetTime.Time}
-		fmt.Printf("Counting entries after reset time: %s\n", lastResetTime.Time.Format("2006-01-02 15:04:05"))
-	} else {
-		// Se nunca houve reset, contar todas as entradas do período
-		countQuery = `SELECT COUNT(*) FROM habit_entries 
-					 WHERE habit_id = ? AND completed_at >= ? AND completed_at <= ?`
-		queryArgs = []interface{}{habitID, periodStart, periodEnd}
-		fmt.Printf("Counting all entries in period (no reset)\n")
-	}
-	
-	err = db.QueryRow(countQuery, queryArgs...).Scan(&actualCount)
+	// Entradas do período atual após o último reset, só em dias previstos na
+	// agenda; a meta compara a soma dos valores
+	actualCount, actualValue, err := goalPeriodProgress(habit, period, periodEnd, cal.Loc)
 	if err != nil {
-		fmt.Printf("ERROR: Error counting entries: %v\n", err)
+		log.Printf("Error counting entries for habit %d: %v", habitID, err)
 		http.Error(w, "Error counting entries", http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Printf("Actual count in period: %d (target: %d)\n", actualCount, habit.Goal)
-
 	// Verificar se já existe uma completion para este período
-	var existingCount int
-	existingQuery := `SELECT COUNT(*) FROM goal_completions 
-					 WHERE habit_id = ? AND period_start = ? AND period_end = ?`
-	err = db.QueryRow(existingQuery, habitID, periodStart, periodEnd).Scan(&existingCount)
+	existingCount, err := store.CountGoalCompletions(habitID, periodStart, periodEnd)
 	if err != nil {
-		fmt.Printf("ERROR: Error checking existing completions: %v", err)
+		log.Printf("Error checking existing completions for habit %d: %v", habitID, err)
 		http.Error(w, "Error checking existing completions", http.StatusInternalServerError)
 		return
 	}
 
-	goalCompleted := actualCount >= habit.Goal
+	goalCompleted := actualValue >= habit.goalTarget()
 	alreadyRecorded := existingCount > 0
 
-	fmt.Printf("Goal completed: %t, Already recorded: %t, Needs renewal: %t\n", goalCompleted, alreadyRecorded, goalCompleted && !alreadyRecorded)
-
 	response := map[string]interface{}{
-		"has_goal":        true,
-		"goal_completed":  goalCompleted,
-		"needs_renewal":   goalCompleted && !alreadyRecorded,
-		"actual_count":    actualCount,
-		"target_count":    habit.Goal,
-		"goal_type":       habit.GoalType,
-		"period_start":    periodStart,
-		"period_end":      periodEnd,
-		"already_recorded": alreadyRecorded,
+		"has_goal":          true,
+		"goal_completed":    goalCompleted,
+		"needs_renewal":     goalCompleted && !alreadyRecorded,
+		"actual_count":      actualCount,
+		"target_count":      habit.Goal,
+		"actual_value":      actualValue,
+		"target_value":      habit.goalTarget(),
+		"unit":              habit.Unit,
+		"goal_type":         habit.GoalType,
+		"period_start":      periodStart,
+		"period_end":        periodEnd,
+		"period_definition": period.Definition,
+		"already_recorded":  alreadyRecorded,
+		"due_today":         habit.Schedule.isDue(cal.today()),
+		"due_days":          habit.Schedule.dueDays(period.FirstDay, period.LastDay),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1514,94 +1358,47 @@ func checkGoalCompletion(w http.ResponseWriter, r *http.Request) {
 
 func resetGoal(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	vars := mux.Vars(r)
-	habitID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
-		return
-	}
 
 	fmt.Printf("=== RESET GOAL REQUEST ===\n")
-	fmt.Printf("User ID: %d, Habit ID: %d\n", userID, habitID)
+	fmt.Printf("User ID: %d, Habit ID: %s\n", userID, mux.Vars(r)["id"])
 
 	// Buscar informações do hábito
-	var habit Habit
-	query := "SELECT id, goal, goal_type FROM habits WHERE id = ? AND user_id = ?"
-	err = db.QueryRow(query, habitID, userID).Scan(&habit.ID, &habit.Goal, &habit.GoalType)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Printf("ERROR: Habit not found for ID %d and user %d\n", habitID, userID)
-			http.Error(w, "Habit not found", http.StatusNotFound)
-			return
-		}
-		fmt.Printf("ERROR: Database error: %v\n", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
 		return
 	}
+	habitID := habit.ID
 
 	fmt.Printf("Habit found: ID=%d, Goal=%d, GoalType=%s\n", habit.ID, habit.Goal, habit.GoalType)
 
-	if habit.Goal == 0 {
+	if habit.goalTarget() == 0 {
 		fmt.Printf("ERROR: Habit has no goal set\n")
 		http.Error(w, "Habit has no goal set", http.StatusBadRequest)
 		return
 	}
 
-	// Calcular período atual baseado no tipo de meta
-	now := time.Now()
-	var periodStart, periodEnd time.Time
-
-	switch habit.GoalType {
-	case "count":
-		// Meta diária
-		periodStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		periodEnd = periodStart.Add(24 * time.Hour).Add(-time.Second)
-	case "weekly":
-		// Meta semanal (domingo a sábado)
-		weekday := int(now.Weekday())
-		periodStart = now.AddDate(0, 0, -weekday)
-		periodStart = time.Date(periodStart.Year(), periodStart.Month(), periodStart.Day(), 0, 0, 0, 0, now.Location())
-		periodEnd = periodStart.AddDate(0, 0, 7).Add(-time.Second)
-	case "monthly":
-		// Meta mensal
-		periodStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-		periodEnd = periodStart.AddDate(0, 1, 0).Add(-time.Second)
-	default:
+	period, ok := habit.periodSpec().current(userCalendar(userID))
+	if !ok {
 		fmt.Printf("ERROR: Goal type '%s' does not support reset\n", habit.GoalType)
 		http.Error(w, "Goal type does not support reset", http.StatusBadRequest)
 		return
 	}
 
+	periodStart, periodEnd := period.Start, period.End
 	fmt.Printf("Period calculated: %s to %s\n", periodStart.Format("2006-01-02 15:04:05"), periodEnd.Format("2006-01-02 15:04:05"))
 
-	// Verificar se existem completions para deletar
-	var existingCount int
-	countQuery := "SELECT COUNT(*) FROM goal_completions WHERE habit_id = ? AND period_start = ? AND period_end = ?"
-	err = db.QueryRow(countQuery, habitID, periodStart, periodEnd).Scan(&existingCount)
-	if err != nil {
-		fmt.Printf("ERROR: Error counting existing completions: %v\n", err)
-		http.Error(w, "Error checking existing completions", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Printf("Found %d existing completions for this period\n", existingCount)
-
 	// Deletar completions existentes para o período atual
-	deleteQuery := "DELETE FROM goal_completions WHERE habit_id = ? AND period_start = ? AND period_end = ?"
-	result, err := db.Exec(deleteQuery, habitID, periodStart, periodEnd)
+	deletedRows, err := store.DeleteGoalCompletions(habitID, periodStart, periodEnd)
 	if err != nil {
 		fmt.Printf("ERROR: Error deleting completions: %v\n", err)
 		http.Error(w, "Error resetting goal", http.StatusInternalServerError)
 		return
 	}
 
-	deletedRows, _ := result.RowsAffected()
 	fmt.Printf("Deleted %d completion records\n", deletedRows)
 
 	// Atualizar timestamp de reset do hábito
-	updateQuery := "UPDATE habits SET last_goal_reset = NOW() WHERE id = ?"
-	_, err = db.Exec(updateQuery, habitID)
-	if err != nil {
+	if err := store.SetGoalReset(habitID, time.Now()); err != nil {
 		fmt.Printf("ERROR: Error updating reset timestamp: %v\n", err)
 		http.Error(w, "Error updating reset timestamp", http.StatusInternalServerError)
 		return
@@ -1611,10 +1408,11 @@ func resetGoal(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Goal reset successfully for habit %d, period %s to %s\n", habitID, periodStart.Format("2006-01-02"), periodEnd.Format("2006-01-02"))
 
 	response := map[string]interface{}{
-		"message": "Goal reset successfully",
-		"period_start": periodStart,
-		"period_end": periodEnd,
-		"deleted_records": deletedRows,
+		"message":           "Goal reset successfully",
+		"period_start":      periodStart,
+		"period_end":        periodEnd,
+		"period_definition": period.Definition,
+		"deleted_records":   deletedRows,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrações versionadas do schema. Cada banco tem seu diretório em
+// migrations/<dialect>, com arquivos NNNN_nome.up.sql e NNNN_nome.down.sql.
+// As versões aplicadas ficam na tabela schema_migrations.
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Bancos criados pelo antigo initDB (com os ALTERs e o update_db.sh já
+// aplicados) estão nesta versão, mas não têm schema_migrations
+const legacySchemaVersion = 3
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type migrationStatus struct {
+	migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations(dir string) ([]migration, error) {
+	files, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, f := range files {
+		name := f.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, rest, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{Version: version, Name: strings.TrimSuffix(rest, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Divide um arquivo em statements separados por ";" no fim da linha
+func splitStatements(content string) []string {
+	var statements []string
+	for _, stmt := range strings.Split(content, ";\n") {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+
+		hasSQL := false
+		for _, line := range strings.Split(stmt, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "--") {
+				hasSQL = true
+				break
+			}
+		}
+		if hasSQL {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
+
+func (s *sqlStore) migrations() ([]migration, error) {
+	return loadMigrations(path.Join("migrations", s.dialect.name()))
+}
+
+func (s *sqlStore) ensureMigrationsTable() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var applied int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	// Banco sem histórico: se as tabelas já existem ele veio do initDB
+	var habits int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM habits").Scan(&habits); err != nil {
+		return nil
+	}
+
+	migrations, err := s.migrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version > legacySchemaVersion {
+			break
+		}
+		if _, err := s.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return err
+		}
+	}
+	log.Printf("Existing database detected, marked migrations up to %04d as applied", legacySchemaVersion)
+	return nil
+}
+
+func (s *sqlStore) appliedMigrations() (map[int]time.Time, error) {
+	rows, err := s.query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (s *sqlStore) runMigration(m migration, up bool) error {
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+
+	// No MySQL o DDL faz commit implícito; a transação protege só o SQLite
+	// e o registro em schema_migrations
+	return s.withTx(func(tx *sql.Tx) error {
+		for _, stmt := range splitStatements(script) {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		var err error
+		if up {
+			_, err = s.execOn(tx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+		} else {
+			_, err = s.execOn(tx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		}
+		return err
+	})
+}
+
+// Aplica todas as migrações pendentes, em ordem
+func (s *sqlStore) MigrateUp() ([]migration, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	migrations, err := s.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := s.runMigration(m, true); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Reverte as últimas steps migrações aplicadas
+func (s *sqlStore) MigrateDown(steps int) ([]migration, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	migrations, err := s.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := s.runMigration(m, false); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func (s *sqlStore) MigrationStatus() ([]migrationStatus, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	migrations, err := s.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]migrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i].migration = m
+		if at, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// Subcomando "migrate up|down [n]|status"
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := store.MigrateUp()
+		for _, m := range done {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		done, err := store.MigrateDown(steps)
+		for _, m := range done {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		status, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.AppliedAt != nil {
+				state = "applied " + m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS activity_comments;
+DROP TABLE IF EXISTS activity_reactions;
+DROP TABLE IF EXISTS activity_feeds;
+DROP TABLE IF EXISTS challenge_participants;
+DROP TABLE IF EXISTS challenges;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS `groups`;
+DROP TABLE IF EXISTS friendships;
+DROP TABLE IF EXISTS goal_completions;
+DROP TABLE IF EXISTS habit_entries;
+DROP TABLE IF EXISTS habits;
+DROP TABLE IF EXISTS users;
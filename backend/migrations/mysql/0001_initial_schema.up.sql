@@ -0,0 +1,147 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	username VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS habits (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	is_active BOOLEAN DEFAULT TRUE,
+	multipleUpdate BOOLEAN DEFAULT FALSE,
+	category VARCHAR(50) DEFAULT 'geral',
+	icon VARCHAR(50) DEFAULT 'target',
+	goal INT DEFAULT 0,
+	goal_type VARCHAR(20) DEFAULT 'streak',
+	reminder_enabled BOOLEAN DEFAULT FALSE,
+	reminder_time VARCHAR(5) DEFAULT '09:00',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS habit_entries (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	habit_id INT NOT NULL,
+	completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	notes TEXT,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS goal_completions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	habit_id INT NOT NULL,
+	goal_type VARCHAR(20) NOT NULL,
+	goal_value INT NOT NULL,
+	completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	period_start DATE NOT NULL,
+	period_end DATE NOT NULL,
+	actual_count INT NOT NULL,
+	notes TEXT,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS friendships (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	friend_id INT NOT NULL,
+	status ENUM('pending', 'accepted', 'declined') DEFAULT 'pending',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (friend_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `groups` (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	privacy ENUM('public', 'private', 'invite_only') DEFAULT 'public',
+	creator_id INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	group_id INT NOT NULL,
+	user_id INT NOT NULL,
+	role ENUM('admin', 'moderator', 'member') DEFAULT 'member',
+	joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (group_id) REFERENCES `groups`(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE KEY unique_membership (group_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS challenges (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	group_id INT NOT NULL,
+	creator_id INT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	habit_name VARCHAR(100) NOT NULL,
+	goal_value INT NOT NULL,
+	goal_type ENUM('count', 'streak', 'weekly', 'monthly') DEFAULT 'count',
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	status ENUM('upcoming', 'active', 'completed', 'cancelled') DEFAULT 'upcoming',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	FOREIGN KEY (group_id) REFERENCES `groups`(id) ON DELETE CASCADE,
+	FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS challenge_participants (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	challenge_id INT NOT NULL,
+	user_id INT NOT NULL,
+	progress INT DEFAULT 0,
+	notes TEXT,
+	joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE KEY unique_participation (challenge_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS activity_feeds (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	activity_type VARCHAR(50) NOT NULL,
+	habit_id INT,
+	goal_completion_id INT,
+	challenge_id INT,
+	metadata JSON,
+	visibility ENUM('public', 'private', 'friends') DEFAULT 'public',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+	FOREIGN KEY (goal_completion_id) REFERENCES goal_completions(id) ON DELETE CASCADE,
+	FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS activity_reactions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	activity_id INT NOT NULL,
+	user_id INT NOT NULL,
+	reaction_type ENUM('like', 'celebrate', 'support', 'wow') DEFAULT 'like',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (activity_id) REFERENCES activity_feeds(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE KEY unique_reaction (activity_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS activity_comments (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	activity_id INT NOT NULL,
+	user_id INT NOT NULL,
+	comment TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (activity_id) REFERENCES activity_feeds(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_activity_created (activity_id, created_at)
+);
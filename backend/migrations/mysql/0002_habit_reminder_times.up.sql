@@ -0,0 +1,6 @@
+-- Lista de horários de lembrete (JSON), substitui o reminder_time único
+ALTER TABLE habits ADD COLUMN reminder_times TEXT AFTER reminder_time;
+
+UPDATE habits
+SET reminder_times = CONCAT('["', reminder_time, '"]')
+WHERE reminder_enabled = 1 AND reminder_time IS NOT NULL AND reminder_times IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE habits ADD COLUMN last_goal_reset TIMESTAMP NULL;
+ALTER TABLE habits ADD COLUMN visibility ENUM('public', 'private', 'friends') DEFAULT 'public';
@@ -0,0 +1,15 @@
+CREATE TABLE personal_access_tokens (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	token_hash CHAR(64) NOT NULL,
+	token_prefix VARCHAR(16) NOT NULL,
+	scopes VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NULL,
+	expires_at TIMESTAMP NULL,
+	revoked_at TIMESTAMP NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE KEY unique_token_hash (token_hash),
+	INDEX idx_tokens_user (user_id)
+);
@@ -0,0 +1,17 @@
+-- Contadores do rate limiting quando rate_limit_store = database
+CREATE TABLE rate_limits (
+	bucket VARCHAR(191) NOT NULL PRIMARY KEY,
+	hits INT NOT NULL,
+	reset_at DATETIME NOT NULL
+);
+
+CREATE TABLE audit_log (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NULL,
+	event VARCHAR(50) NOT NULL,
+	ip VARCHAR(45),
+	detail VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+	INDEX idx_audit_log_user (user_id)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN display_name VARCHAR(100) NULL;
+ALTER TABLE users ADD COLUMN bio TEXT NULL;
+-- Nome do arquivo em upload_dir/avatars
+ALTER TABLE users ADD COLUMN avatar_path VARCHAR(255) NULL;
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT 'pt-BR';
@@ -0,0 +1,2 @@
+-- Agenda do hábito em JSON (schedule.go); vazio ou NULL equivale a diário
+ALTER TABLE habits ADD COLUMN schedule TEXT NULL;
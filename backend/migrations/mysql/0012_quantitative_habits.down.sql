@@ -0,0 +1,6 @@
+ALTER TABLE challenge_participants MODIFY progress INT DEFAULT 0;
+ALTER TABLE challenges MODIFY goal_value INT NOT NULL;
+ALTER TABLE challenges DROP COLUMN unit;
+ALTER TABLE habit_entries DROP COLUMN value;
+ALTER TABLE habits DROP COLUMN target_value;
+ALTER TABLE habits DROP COLUMN unit;
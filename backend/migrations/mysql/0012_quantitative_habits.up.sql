@@ -0,0 +1,9 @@
+-- Hábitos quantitativos: unidade e meta por período; cada entrada tem um
+-- valor (1 nos hábitos sem unidade, para a soma equivaler à contagem)
+ALTER TABLE habits ADD COLUMN unit VARCHAR(20) NULL;
+ALTER TABLE habits ADD COLUMN target_value DECIMAL(12,3) NOT NULL DEFAULT 0;
+ALTER TABLE habit_entries ADD COLUMN value DECIMAL(12,3) NOT NULL DEFAULT 1;
+-- Desafios medem o progresso na unidade do hábito
+ALTER TABLE challenges ADD COLUMN unit VARCHAR(20) NULL;
+ALTER TABLE challenges MODIFY goal_value DECIMAL(12,3) NOT NULL;
+ALTER TABLE challenge_participants MODIFY progress DECIMAL(12,3) DEFAULT 0;
@@ -0,0 +1,11 @@
+-- Primeiro dia da semana do usuário (0 = domingo ... 6 = sábado)
+ALTER TABLE users ADD COLUMN week_start TINYINT NOT NULL DEFAULT 0;
+-- Metas por janela móvel ("rolling") e por intervalo fixo ("range")
+ALTER TABLE habits ADD COLUMN goal_window_days INT NOT NULL DEFAULT 0;
+ALTER TABLE habits ADD COLUMN goal_start_date VARCHAR(10) NULL;
+ALTER TABLE habits ADD COLUMN goal_end_date VARCHAR(10) NULL;
+-- Definição do período usada em cada meta cumprida (period.go); os limites
+-- passam a ser instantes no fuso do usuário
+ALTER TABLE goal_completions ADD COLUMN period_definition VARCHAR(64) NULL;
+ALTER TABLE goal_completions MODIFY period_start DATETIME NOT NULL;
+ALTER TABLE goal_completions MODIFY period_end DATETIME NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE goal_completions DROP COLUMN missed;
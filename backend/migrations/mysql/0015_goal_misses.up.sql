@@ -0,0 +1,2 @@
+-- Períodos encerrados sem atingir a meta, gravados pelo job de metas
+ALTER TABLE goal_completions ADD COLUMN missed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS habit_entry_changes;
+ALTER TABLE habit_entries DROP COLUMN edited_at;
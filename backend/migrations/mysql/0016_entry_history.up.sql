@@ -0,0 +1,19 @@
+-- Histórico de alterações das entradas (criação retroativa, edição e
+-- remoção), para que edições que inflam streaks fiquem visíveis
+ALTER TABLE habit_entries ADD COLUMN edited_at DATETIME NULL;
+
+CREATE TABLE habit_entry_changes (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	entry_id INT NOT NULL,
+	habit_id INT NOT NULL,
+	action VARCHAR(10) NOT NULL,
+	old_completed_at DATETIME NULL,
+	new_completed_at DATETIME NULL,
+	old_value DECIMAL(12,3) NULL,
+	new_value DECIMAL(12,3) NULL,
+	old_notes TEXT,
+	new_notes TEXT,
+	changed_at DATETIME NOT NULL,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+	INDEX idx_habit_entry_changes_entry (habit_id, entry_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE habits DROP INDEX idx_habits_deleted_at;
+ALTER TABLE habits DROP COLUMN deleted_at;
+ALTER TABLE habits DROP COLUMN archived_at;
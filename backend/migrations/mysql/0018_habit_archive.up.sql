@@ -0,0 +1,8 @@
+-- Arquivamento de hábitos e remoção reversível: hábitos removidos ficam
+-- com deleted_at até o job de limpeza apagá-los de vez
+ALTER TABLE habits ADD COLUMN archived_at DATETIME NULL;
+ALTER TABLE habits ADD COLUMN deleted_at DATETIME NULL;
+ALTER TABLE habits ADD INDEX idx_habits_deleted_at (deleted_at);
+
+-- Hábitos já inativos passam a ser arquivados
+UPDATE habits SET archived_at = CURRENT_TIMESTAMP WHERE is_active = FALSE;
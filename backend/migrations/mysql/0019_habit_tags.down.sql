@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS habit_views;
+DROP TABLE IF EXISTS habit_tags;
+DROP TABLE IF EXISTS tags;
+ALTER TABLE habits DROP COLUMN sort_order;
@@ -0,0 +1,31 @@
+-- Etiquetas (muitas por hábito), ordem definida pelo usuário e filtros
+-- salvos da lista de hábitos
+ALTER TABLE habits ADD COLUMN sort_order INT NOT NULL DEFAULT 0;
+
+CREATE TABLE tags (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	name VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE habit_tags (
+	habit_id INT NOT NULL,
+	tag_id INT NOT NULL,
+	PRIMARY KEY (habit_id, tag_id),
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+	FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- filters guarda o HabitFilter em JSON
+CREATE TABLE habit_views (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	filters TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+-- Lembretes já enviados pelo agendador, um por hábito, dia local e
+-- horário; a chave impede envios repetidos após reinícios ou entre
+-- instâncias
+CREATE TABLE reminder_deliveries (
+	habit_id INT NOT NULL,
+	day VARCHAR(10) NOT NULL,
+	reminder_time VARCHAR(5) NOT NULL,
+	sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (habit_id, day, reminder_time),
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
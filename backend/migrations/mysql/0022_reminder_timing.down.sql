@@ -0,0 +1,6 @@
+ALTER TABLE reminder_deliveries DROP INDEX idx_reminder_deliveries_snoozed_until;
+ALTER TABLE reminder_deliveries DROP COLUMN snooze_count;
+ALTER TABLE reminder_deliveries DROP COLUMN snoozed_until;
+ALTER TABLE habits DROP COLUMN reminder_mode;
+ALTER TABLE users DROP COLUMN quiet_hours_end;
+ALTER TABLE users DROP COLUMN quiet_hours_start;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS digest_deliveries;
+ALTER TABLE users DROP COLUMN digest_frequency;
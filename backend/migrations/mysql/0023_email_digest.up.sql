@@ -0,0 +1,14 @@
+-- Resumo por e-mail (off, daily ou weekly) escolhido por cada usuário e os
+-- resumos já enviados, um por usuário, frequência e primeiro dia do
+-- período; a chave impede envios repetidos após reinícios ou entre
+-- instâncias
+ALTER TABLE users ADD COLUMN digest_frequency VARCHAR(10) NOT NULL DEFAULT 'off';
+
+CREATE TABLE digest_deliveries (
+	user_id INT NOT NULL,
+	frequency VARCHAR(10) NOT NULL,
+	period_start VARCHAR(10) NOT NULL,
+	sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, frequency, period_start),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,148 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS habits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	is_active BOOLEAN DEFAULT TRUE,
+	multipleUpdate BOOLEAN DEFAULT FALSE,
+	category VARCHAR(50) DEFAULT 'geral',
+	icon VARCHAR(50) DEFAULT 'target',
+	goal INTEGER DEFAULT 0,
+	goal_type VARCHAR(20) DEFAULT 'streak',
+	reminder_enabled BOOLEAN DEFAULT FALSE,
+	reminder_time VARCHAR(5) DEFAULT '09:00',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS habit_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	habit_id INTEGER NOT NULL,
+	completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	notes TEXT,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS goal_completions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	habit_id INTEGER NOT NULL,
+	goal_type VARCHAR(20) NOT NULL,
+	goal_value INTEGER NOT NULL,
+	completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	period_start DATE NOT NULL,
+	period_end DATE NOT NULL,
+	actual_count INTEGER NOT NULL,
+	notes TEXT,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS friendships (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	friend_id INTEGER NOT NULL,
+	status TEXT DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (friend_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `groups` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	privacy TEXT DEFAULT 'public' CHECK (privacy IN ('public', 'private', 'invite_only')),
+	creator_id INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	role TEXT DEFAULT 'member' CHECK (role IN ('admin', 'moderator', 'member')),
+	joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (group_id) REFERENCES `groups`(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE (group_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS challenges (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id INTEGER NOT NULL,
+	creator_id INTEGER NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	habit_name VARCHAR(100) NOT NULL,
+	goal_value INTEGER NOT NULL,
+	goal_type TEXT DEFAULT 'count' CHECK (goal_type IN ('count', 'streak', 'weekly', 'monthly')),
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	status TEXT DEFAULT 'upcoming' CHECK (status IN ('upcoming', 'active', 'completed', 'cancelled')),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (group_id) REFERENCES `groups`(id) ON DELETE CASCADE,
+	FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS challenge_participants (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	challenge_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	progress INTEGER DEFAULT 0,
+	notes TEXT,
+	joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE (challenge_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS activity_feeds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	activity_type VARCHAR(50) NOT NULL,
+	habit_id INTEGER,
+	goal_completion_id INTEGER,
+	challenge_id INTEGER,
+	metadata TEXT,
+	visibility TEXT DEFAULT 'public' CHECK (visibility IN ('public', 'private', 'friends')),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+	FOREIGN KEY (goal_completion_id) REFERENCES goal_completions(id) ON DELETE CASCADE,
+	FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS activity_reactions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	activity_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	reaction_type TEXT DEFAULT 'like' CHECK (reaction_type IN ('like', 'celebrate', 'support', 'wow')),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (activity_id) REFERENCES activity_feeds(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE (activity_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS activity_comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	activity_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	comment TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (activity_id) REFERENCES activity_feeds(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_created ON activity_comments (activity_id, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE habits DROP COLUMN visibility;
+ALTER TABLE habits DROP COLUMN last_goal_reset;
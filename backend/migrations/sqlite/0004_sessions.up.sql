@@ -0,0 +1,17 @@
+-- Sessões de login; cada uma guarda o hash do refresh token atual
+CREATE TABLE sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	refresh_token_hash CHAR(64) NOT NULL UNIQUE,
+	previous_token_hash CHAR(64),
+	user_agent VARCHAR(255),
+	ip VARCHAR(64),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_previous ON sessions (previous_token_hash);
+CREATE INDEX idx_sessions_user ON sessions (user_id, revoked_at);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL;
+
+-- Contas anteriores à verificação são consideradas verificadas
+UPDATE users SET email_verified_at = created_at;
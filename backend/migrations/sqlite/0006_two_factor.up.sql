@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NULL;
+ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN DEFAULT FALSE;
+-- Último passo de 30s aceito, impede reutilizar o mesmo código
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NULL;
+
+CREATE TABLE recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	code_hash CHAR(64) NOT NULL,
+	used_at TIMESTAMP NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recovery_codes_user ON recovery_codes (user_id);
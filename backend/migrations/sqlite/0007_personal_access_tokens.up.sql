@@ -0,0 +1,15 @@
+CREATE TABLE personal_access_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	token_prefix VARCHAR(16) NOT NULL,
+	scopes VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NULL,
+	expires_at TIMESTAMP NULL,
+	revoked_at TIMESTAMP NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_tokens_user ON personal_access_tokens (user_id);
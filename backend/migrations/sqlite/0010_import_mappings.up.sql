@@ -0,0 +1,12 @@
+-- IDs do arquivo de exportação já importados para cada conta, para que
+-- importar o mesmo arquivo de novo não duplique nada
+CREATE TABLE import_mappings (
+	user_id INTEGER NOT NULL,
+	source CHAR(64) NOT NULL,
+	kind VARCHAR(20) NOT NULL,
+	source_id INTEGER NOT NULL,
+	target_id INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, source, kind, source_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE challenges DROP COLUMN unit;
+ALTER TABLE habit_entries DROP COLUMN value;
+ALTER TABLE habits DROP COLUMN target_value;
+ALTER TABLE habits DROP COLUMN unit;
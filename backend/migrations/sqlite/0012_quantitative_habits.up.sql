@@ -0,0 +1,8 @@
+-- Hábitos quantitativos: unidade e meta por período; cada entrada tem um
+-- valor (1 nos hábitos sem unidade, para a soma equivaler à contagem)
+ALTER TABLE habits ADD COLUMN unit VARCHAR(20) NULL;
+ALTER TABLE habits ADD COLUMN target_value REAL NOT NULL DEFAULT 0;
+ALTER TABLE habit_entries ADD COLUMN value REAL NOT NULL DEFAULT 1;
+-- Desafios medem o progresso na unidade do hábito. goal_value e progress
+-- continuam INTEGER: a afinidade do SQLite já guarda valores decimais.
+ALTER TABLE challenges ADD COLUMN unit VARCHAR(20) NULL;
@@ -0,0 +1,3 @@
+-- "build" para hábitos a cultivar, "quit" para hábitos a abandonar (as
+-- entradas passam a ser recaídas)
+ALTER TABLE habits ADD COLUMN polarity VARCHAR(10) NOT NULL DEFAULT 'build';
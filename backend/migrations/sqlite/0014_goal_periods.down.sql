@@ -0,0 +1,5 @@
+ALTER TABLE goal_completions DROP COLUMN period_definition;
+ALTER TABLE habits DROP COLUMN goal_end_date;
+ALTER TABLE habits DROP COLUMN goal_start_date;
+ALTER TABLE habits DROP COLUMN goal_window_days;
+ALTER TABLE users DROP COLUMN week_start;
@@ -0,0 +1,20 @@
+-- Histórico de alterações das entradas (criação retroativa, edição e
+-- remoção), para que edições que inflam streaks fiquem visíveis
+ALTER TABLE habit_entries ADD COLUMN edited_at TIMESTAMP NULL;
+
+CREATE TABLE habit_entry_changes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	entry_id INTEGER NOT NULL,
+	habit_id INTEGER NOT NULL,
+	action VARCHAR(10) NOT NULL,
+	old_completed_at TIMESTAMP NULL,
+	new_completed_at TIMESTAMP NULL,
+	old_value REAL NULL,
+	new_value REAL NULL,
+	old_notes TEXT,
+	new_notes TEXT,
+	changed_at TIMESTAMP NOT NULL,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_habit_entry_changes_entry ON habit_entry_changes (habit_id, entry_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS streak_freeze_awards;
+DROP TABLE IF EXISTS pause_habits;
+DROP TABLE IF EXISTS pauses;
+DROP TABLE IF EXISTS habit_skips;
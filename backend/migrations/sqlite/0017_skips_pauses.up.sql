@@ -0,0 +1,44 @@
+-- Dias que não quebram nem estendem streaks: dias pulados ou congelados
+-- (kind = skip ou freeze) e pausas por intervalo (modo férias), para
+-- todos os hábitos (all_habits) ou para os listados em pause_habits
+CREATE TABLE habit_skips (
+	habit_id INTEGER NOT NULL,
+	day VARCHAR(10) NOT NULL,
+	kind VARCHAR(10) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (habit_id, day),
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE TABLE pauses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	start_date VARCHAR(10) NOT NULL,
+	end_date VARCHAR(10) NOT NULL,
+	all_habits BOOLEAN NOT NULL DEFAULT FALSE,
+	reason VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE pause_habits (
+	pause_id INTEGER NOT NULL,
+	habit_id INTEGER NOT NULL,
+	PRIMARY KEY (pause_id, habit_id),
+	FOREIGN KEY (pause_id) REFERENCES pauses(id) ON DELETE CASCADE,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+-- Congelamentos de streak ganhos ao manter streaks; os usados são os
+-- habit_skips com kind = freeze
+CREATE TABLE streak_freeze_awards (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	habit_id INTEGER NULL,
+	day VARCHAR(10) NOT NULL,
+	streak INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (habit_id, day),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE SET NULL
+);
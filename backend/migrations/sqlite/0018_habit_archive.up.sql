@@ -0,0 +1,9 @@
+-- Arquivamento de hábitos e remoção reversível: hábitos removidos ficam
+-- com deleted_at até o job de limpeza apagá-los de vez
+ALTER TABLE habits ADD COLUMN archived_at TIMESTAMP NULL;
+ALTER TABLE habits ADD COLUMN deleted_at TIMESTAMP NULL;
+
+CREATE INDEX idx_habits_deleted_at ON habits (deleted_at);
+
+-- Hábitos já inativos passam a ser arquivados
+UPDATE habits SET archived_at = CURRENT_TIMESTAMP WHERE is_active = FALSE;
@@ -0,0 +1,20 @@
+-- Inscrições Web Push (uma por navegador ou dispositivo) e o par de chaves
+-- VAPID do servidor, gerado na primeira execução quando não configurado
+CREATE TABLE push_subscriptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	endpoint VARCHAR(500) NOT NULL UNIQUE,
+	p256dh VARCHAR(100) NOT NULL,
+	auth VARCHAR(50) NOT NULL,
+	user_agent VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE vapid_keys (
+	id INTEGER PRIMARY KEY,
+	public_key VARCHAR(100) NOT NULL,
+	private_key VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,12 @@
+-- Horário de silêncio por usuário (HH:MM no fuso do usuário), modo do
+-- lembrete por hábito (fixed ou adaptive) e adiamento dos lembretes já
+-- enviados
+ALTER TABLE users ADD COLUMN quiet_hours_start VARCHAR(5) NULL;
+ALTER TABLE users ADD COLUMN quiet_hours_end VARCHAR(5) NULL;
+
+ALTER TABLE habits ADD COLUMN reminder_mode VARCHAR(10) NOT NULL DEFAULT 'fixed';
+
+ALTER TABLE reminder_deliveries ADD COLUMN snoozed_until TIMESTAMP NULL;
+ALTER TABLE reminder_deliveries ADD COLUMN snooze_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_reminder_deliveries_snoozed_until ON reminder_deliveries (snoozed_until);
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cálculo de períodos compartilhado pelas metas (checkGoalCompletion,
+// resetGoal), pelas agendas por frequência e pelo analytics. Os dias são
+// datas locais representadas como meia-noite UTC (timezone.go); Period
+// converte o primeiro e o último dia em instantes no fuso do usuário.
+
+const (
+	unitDay   = "day"
+	unitWeek  = "week"
+	unitMonth = "month"
+	unitYear  = "year"
+)
+
+// Fuso e primeiro dia da semana escolhidos pelo usuário
+type Calendar struct {
+	Loc       *time.Location
+	WeekStart time.Weekday
+}
+
+func userCalendar(userID int) Calendar {
+	user, err := store.GetUser(userID)
+	if err != nil {
+		return Calendar{Loc: time.UTC}
+	}
+	return Calendar{Loc: loadLocation(user.Timezone), WeekStart: time.Weekday(user.WeekStart)}
+}
+
+func (c Calendar) today() time.Time {
+	return localToday(c.Loc)
+}
+
+func (c Calendar) day(t time.Time) time.Time {
+	return entryDay(t, c.Loc)
+}
+
+// Primeiro dia do período de calendário que contém day e o primeiro dia do
+// período seguinte
+func (c Calendar) bounds(unit string, day time.Time) (first, next time.Time) {
+	switch unit {
+	case unitWeek:
+		first = day.AddDate(0, 0, -((7 + int(day.Weekday()) - int(c.WeekStart)) % 7))
+		return first, first.AddDate(0, 0, 7)
+	case unitMonth:
+		first = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return first, first.AddDate(0, 1, 0)
+	case unitYear:
+		first = time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		return first, first.AddDate(1, 0, 0)
+	}
+	return day, day.AddDate(0, 0, 1)
+}
+
+// Definição do período de uma meta, a partir dos campos do hábito
+type PeriodSpec struct {
+	GoalType   string
+	WindowDays int    // "rolling": janela móvel de N dias terminando hoje
+	StartDate  string // "range": intervalo fixo, YYYY-MM-DD
+	EndDate    string
+}
+
+// Um período concreto: do início do primeiro dia ao último segundo do
+// último dia, no fuso do usuário
+type Period struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	FirstDay   time.Time `json:"-"`
+	LastDay    time.Time `json:"-"`
+	Definition string    `json:"definition"`
+}
+
+var goalTypes = map[string]string{
+	"streak":  "",
+	"count":   unitDay,
+	"weekly":  unitWeek,
+	"monthly": unitMonth,
+	"yearly":  unitYear,
+	"rolling": "",
+	"range":   "",
+}
+
+func (h *Habit) periodSpec() PeriodSpec {
+	return PeriodSpec{
+		GoalType:   h.GoalType,
+		WindowDays: h.GoalWindowDays,
+		StartDate:  h.GoalStartDate,
+		EndDate:    h.GoalEndDate,
+	}
+}
+
+func (p PeriodSpec) validate() error {
+	if _, ok := goalTypes[p.GoalType]; !ok {
+		return fieldError("goal_type", "invalid", "Tipo de meta deve ser streak, count, weekly, monthly, yearly, rolling ou range")
+	}
+	switch p.GoalType {
+	case "rolling":
+		if p.WindowDays < 1 || p.WindowDays > 366 {
+			return fieldError("goal_window_days", "out_of_range", "Janela da meta deve ter entre 1 e 366 dias")
+		}
+	case "range":
+		start, err := time.Parse(dateLayout, p.StartDate)
+		if err != nil {
+			return fieldError("goal_start_date", "invalid", "Data de início da meta deve estar no formato AAAA-MM-DD")
+		}
+		end, err := time.Parse(dateLayout, p.EndDate)
+		if err != nil {
+			return fieldError("goal_end_date", "invalid", "Data de término da meta deve estar no formato AAAA-MM-DD")
+		}
+		if end.Before(start) {
+			return fieldError("goal_end_date", "out_of_range", "Data de término da meta não pode ser anterior à data de início")
+		}
+	}
+	return nil
+}
+
+// Limpa os campos que não se aplicam ao tipo de meta
+func (h *Habit) normalizeGoalPeriod() {
+	if h.GoalType != "rolling" {
+		h.GoalWindowDays = 0
+	}
+	if h.GoalType != "range" {
+		h.GoalStartDate, h.GoalEndDate = "", ""
+	}
+}
+
+// Descrição estável do período, gravada em goal_completions
+func (p PeriodSpec) definition(cal Calendar) string {
+	switch p.GoalType {
+	case "weekly":
+		return unitWeek + ":" + strings.ToLower(cal.WeekStart.String())
+	case "rolling":
+		return fmt.Sprintf("rolling:%dd", p.WindowDays)
+	case "range":
+		return "range:" + p.StartDate + ".." + p.EndDate
+	}
+	return goalTypes[p.GoalType]
+}
+
+// Período da meta que contém o dia; ok é false para metas sem período
+// (streak). Na janela móvel é a janela que termina no dia; no intervalo
+// fixo é sempre o próprio intervalo.
+func (p PeriodSpec) containing(day time.Time, cal Calendar) (Period, bool) {
+	var first, next time.Time
+	switch p.GoalType {
+	case "rolling":
+		if p.WindowDays < 1 {
+			return Period{}, false
+		}
+		first, next = day.AddDate(0, 0, 1-p.WindowDays), day.AddDate(0, 0, 1)
+	case "range":
+		start, err1 := time.Parse(dateLayout, p.StartDate)
+		end, err2 := time.Parse(dateLayout, p.EndDate)
+		if err1 != nil || err2 != nil {
+			return Period{}, false
+		}
+		first, next = start, end.AddDate(0, 0, 1)
+	default:
+		unit := goalTypes[p.GoalType]
+		if unit == "" {
+			return Period{}, false
+		}
+		first, next = cal.bounds(unit, day)
+	}
+
+	return Period{
+		Start:      dayStart(first, cal.Loc),
+		End:        dayStart(next, cal.Loc).Add(-time.Second),
+		FirstDay:   first,
+		LastDay:    next.AddDate(0, 0, -1),
+		Definition: p.definition(cal),
+	}, true
+}
+
+func (p PeriodSpec) current(cal Calendar) (Period, bool) {
+	return p.containing(cal.today(), cal)
+}
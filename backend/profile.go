@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // fusos horários mesmo em imagens sem /usr/share/zoneinfo
+
+	"github.com/gorilla/mux"
+)
+
+// Perfil do próprio usuário (/api/me): dados públicos, avatar, troca de
+// senha e e-mail e exclusão da conta. Os avatares ficam em
+// upload_dir/avatars e são servidos em /uploads/avatars/{arquivo}.
+
+const (
+	defaultTimezone = "UTC"
+	defaultLocale   = "pt-BR"
+
+	maxAvatarSize      = 2 << 20 // 2 MB
+	maxAvatarDimension = 4096
+	maxBioLength       = 500
+)
+
+var supportedLocales = []string{"pt-BR", "en-US"}
+
+var avatarFileName = regexp.MustCompile(`^[0-9]+-[0-9a-f]{16}\.(png|jpg|gif)$`)
+
+// Campos ausentes não são alterados
+type UpdateProfileRequest struct {
+	Username    *string `json:"username"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+	WeekStart   *int    `json:"week_start"`
+	// "" desliga o horário de silêncio
+	QuietHoursStart *string `json:"quiet_hours_start"`
+	QuietHoursEnd   *string `json:"quiet_hours_end"`
+	DigestFrequency *string `json:"digest_frequency"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// Com 2FA ativo a exclusão também pede um código
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func avatarURL(path string) string {
+	if path == "" {
+		return ""
+	}
+	return "/uploads/avatars/" + path
+}
+
+func avatarDir() string {
+	return filepath.Join(config.UploadDir, "avatars")
+}
+
+func validTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func validLocale(locale string) bool {
+	for _, l := range supportedLocales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Horário de silêncio: início e fim HH:MM diferentes, ou os dois vazios
+func setQuietHours(user *User, start, end *string) error {
+	if start != nil {
+		user.QuietHoursStart = strings.TrimSpace(*start)
+	}
+	if end != nil {
+		user.QuietHoursEnd = strings.TrimSpace(*end)
+	}
+	if user.QuietHoursStart == "" && user.QuietHoursEnd == "" {
+		return nil
+	}
+	startMinutes, err := parseClock(user.QuietHoursStart)
+	if err != nil {
+		return errors.New("Quiet hours start must be HH:MM")
+	}
+	endMinutes, err := parseClock(user.QuietHoursEnd)
+	if err != nil {
+		return errors.New("Quiet hours end must be HH:MM")
+	}
+	if startMinutes == endMinutes {
+		return errors.New("Quiet hours start and end must differ")
+	}
+	user.QuietHoursStart, user.QuietHoursEnd = formatClock(startMinutes), formatClock(endMinutes)
+	return nil
+}
+
+// Remove o arquivo do avatar; erros só vão para o log
+func removeAvatarFile(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(avatarDir(), path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing avatar %s: %v", path, err)
+	}
+}
+
+func writeUser(w http.ResponseWriter, user *User) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func getMe(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	writeUser(w, user)
+}
+
+func updateMe(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if username == "" || len(username) > 50 {
+			http.Error(w, "Username is required (up to 50 characters)", http.StatusBadRequest)
+			return
+		}
+		user.Username = username
+	}
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if len(displayName) > 100 {
+			http.Error(w, "Display name must be at most 100 characters", http.StatusBadRequest)
+			return
+		}
+		user.DisplayName = displayName
+	}
+	if req.Bio != nil {
+		if len(*req.Bio) > maxBioLength {
+			http.Error(w, fmt.Sprintf("Bio must be at most %d characters", maxBioLength), http.StatusBadRequest)
+			return
+		}
+		user.Bio = *req.Bio
+	}
+	if req.Timezone != nil {
+		if !validTimezone(*req.Timezone) {
+			http.Error(w, "Unknown timezone", http.StatusBadRequest)
+			return
+		}
+		user.Timezone = *req.Timezone
+	}
+	if req.Locale != nil {
+		if !validLocale(*req.Locale) {
+			http.Error(w, "Unsupported locale (use one of: "+strings.Join(supportedLocales, ", ")+")", http.StatusBadRequest)
+			return
+		}
+		user.Locale = *req.Locale
+	}
+	if req.WeekStart != nil {
+		if *req.WeekStart < 0 || *req.WeekStart > 6 {
+			http.Error(w, "Week start must be between 0 (Sunday) and 6 (Saturday)", http.StatusBadRequest)
+			return
+		}
+		user.WeekStart = *req.WeekStart
+	}
+	if req.QuietHoursStart != nil || req.QuietHoursEnd != nil {
+		if err := setQuietHours(user, req.QuietHoursStart, req.QuietHoursEnd); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.DigestFrequency != nil {
+		if !validDigestFrequency(*req.DigestFrequency) {
+			http.Error(w, "Digest frequency must be off, daily or weekly", http.StatusBadRequest)
+			return
+		}
+		user.DigestFrequency = *req.DigestFrequency
+	}
+
+	if err := store.UpdateProfile(user); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			http.Error(w, "Username already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeUser(w, user)
+}
+
+// Recebe o avatar em multipart (campo "avatar"): PNG, JPEG ou GIF de até 2 MB
+func uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+64<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		http.Error(w, "Missing avatar file (max 2 MB)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+	if err != nil || len(data) > maxAvatarSize {
+		http.Error(w, "Avatar must be at most 2 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// O tipo vem do conteúdo, não do nome ou do Content-Type enviado
+	imgConfig, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Avatar must be a PNG, JPEG or GIF image", http.StatusUnsupportedMediaType)
+		return
+	}
+	if imgConfig.Width > maxAvatarDimension || imgConfig.Height > maxAvatarDimension {
+		http.Error(w, fmt.Sprintf("Avatar must be at most %dx%d pixels", maxAvatarDimension, maxAvatarDimension), http.StatusBadRequest)
+		return
+	}
+	ext := map[string]string{"png": "png", "jpeg": "jpg", "gif": "gif"}[format]
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		http.Error(w, "Error saving avatar", http.StatusInternalServerError)
+		return
+	}
+	name := fmt.Sprintf("%d-%s.%s", user.ID, hex.EncodeToString(suffix), ext)
+
+	if err := os.MkdirAll(avatarDir(), 0o755); err != nil {
+		log.Printf("Error creating avatar directory: %v", err)
+		http.Error(w, "Error saving avatar", http.StatusInternalServerError)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(avatarDir(), name), data, 0o644); err != nil {
+		log.Printf("Error writing avatar: %v", err)
+		http.Error(w, "Error saving avatar", http.StatusInternalServerError)
+		return
+	}
+	if err := store.UpdateAvatar(user.ID, name); err != nil {
+		removeAvatarFile(name)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	removeAvatarFile(user.AvatarPath)
+
+	user.AvatarPath = name
+	user.AvatarURL = avatarURL(name)
+	writeUser(w, user)
+}
+
+func deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := store.UpdateAvatar(user.ID, ""); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	removeAvatarFile(user.AvatarPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Serve apenas arquivos com o nome gerado no upload
+func serveAvatar(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["file"]
+	if !avatarFileName.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filepath.Join(avatarDir(), name))
+}
+
+func changePassword(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	currentHash, err := store.GetPasswordHash(userID)
+	if err != nil || !checkPasswordHash(req.CurrentPassword, currentHash) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+	if err := store.UpdatePassword(userID, hashedPassword); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// A sessão atual continua; as outras precisam da senha nova
+	if err := store.RevokeOtherSessions(userID, getSessionID(r)); err != nil {
+		log.Printf("Error revoking sessions after password change for user %d: %v", userID, err)
+	}
+
+	if user, err := store.GetUser(userID); err == nil {
+		err := mailer.Send(Mail{To: user.Email, Subject: "Sua senha foi alterada",
+			Text: fmt.Sprintf("Olá, %s! A senha da sua conta no Habit Tracker foi alterada. Se não foi você, redefina a senha imediatamente.\n", user.Username)})
+		if err != nil {
+			log.Printf("Error sending password change notice to user %d: %v", userID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated"})
+}
+
+// Troca o e-mail e envia a verificação para o novo endereço
+func changeEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if !validEmail(req.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(req.Email, user.Email) {
+		http.Error(w, "This is already your email address", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := store.GetPasswordHash(user.ID)
+	if err != nil || !checkPasswordHash(req.Password, passwordHash) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if err := store.UpdateEmail(user.ID, req.Email); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			http.Error(w, "Email already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	oldEmail := user.Email
+	user.Email = req.Email
+	user.EmailVerified = false
+
+	if err := sendVerificationEmail(*user); err != nil {
+		log.Printf("Error sending verification to user %d: %v", user.ID, err)
+	}
+	err = mailer.Send(Mail{To: oldEmail, Subject: "Seu e-mail foi alterado",
+		Text: fmt.Sprintf("Olá, %s! O e-mail da sua conta no Habit Tracker foi alterado para %s. Se não foi você, entre em contato imediatamente.\n", user.Username, user.Email)})
+	if err != nil {
+		log.Printf("Error sending email change notice to user %d: %v", user.ID, err)
+	}
+
+	writeUser(w, user)
+}
+
+// Exclui a conta e tudo que pertence a ela, depois confirma por e-mail
+func deleteMe(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := store.GetPasswordHash(user.ID)
+	if err != nil || !checkPasswordHash(req.Password, passwordHash) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if user.TwoFactorEnabled {
+		secret, _, err := store.GetTOTP(user.ID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		ok, err := checkSecondFactor(user.ID, secret, req.Code)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if err := store.DeleteUser(user.ID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	removeAvatarFile(user.AvatarPath)
+	log.Printf("User %d deleted their account", user.ID)
+
+	err = mailer.Send(Mail{To: user.Email, Subject: "Sua conta foi excluída",
+		Text: fmt.Sprintf("Olá, %s! Sua conta no Habit Tracker e todos os seus dados foram excluídos.\n", user.Username)})
+	if err != nil {
+		log.Printf("Error sending account deletion notice: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+}
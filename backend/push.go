@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Notificações Web Push. Cada dispositivo registra a inscrição do navegador
+// (PushManager.subscribe com a chave de /api/push/public-key) em
+// /api/push/subscriptions. O payload vai cifrado (webpush.go) para todas as
+// inscrições do usuário; as que o serviço de push responde com 404 ou 410
+// são removidas. Além dos lembretes (notify_driver "push"), os eventos
+// sociais são sempre enviados por push para quem tem inscrições.
+
+const (
+	pushTTL            = 24 * time.Hour
+	maxPushEndpointLen = 500
+)
+
+var webPush *webPushSender
+
+type PushKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+type PushSubscription struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Endpoint   string     `json:"endpoint"`
+	Keys       PushKeys   `json:"keys"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// Payload entregue ao service worker
+type pushMessage struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// Chaves da configuração ou, sem elas, as guardadas no banco (geradas na
+// primeira execução), para que as inscrições continuem válidas entre
+// reinícios e instâncias
+func initWebPush(c Config) error {
+	keys, err := loadVAPIDKeys(c)
+	if err != nil {
+		return err
+	}
+	// O endpoint vem do cliente: fora do desenvolvimento (onde o serviço de
+	// push local roda em localhost) só conecta em endereços públicos, o que
+	// também vale se o DNS do host mudar depois da inscrição
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !c.isDev() {
+		dialer.Control = publicAddressOnly
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	webPush = &webPushSender{
+		keys:    keys,
+		subject: c.VAPIDSubject,
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+	return nil
+}
+
+// Loopback, redes privadas, link-local (inclusive metadados de nuvem) e
+// afins, que não podem receber pushes
+func privateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// Control do net.Dialer: recusa a conexão com endereços privados
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateAddress(ip) {
+		return fmt.Errorf("push endpoint address %s is not public", host)
+	}
+	return nil
+}
+
+func loadVAPIDKeys(c Config) (*vapidKeys, error) {
+	if c.VAPIDPrivateKey != "" {
+		return parseVAPIDKeys(c.VAPIDPublicKey, c.VAPIDPrivateKey)
+	}
+
+	publicKey, privateKey, err := store.GetVAPIDKeys()
+	if err == nil {
+		return parseVAPIDKeys(publicKey, privateKey)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	keys, err := newVAPIDKeys()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.SaveVAPIDKeys(keys.Public, keys.privateString()); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			// Outra instância gerou as chaves ao mesmo tempo
+			return loadVAPIDKeys(c)
+		}
+		return nil, err
+	}
+	log.Println("Generated VAPID keys for Web Push")
+	return keys, nil
+}
+
+// Envia a notificação para todos os dispositivos inscritos do usuário
+type pushNotifier struct{}
+
+func (pushNotifier) Notify(n Notification) error {
+	_, err := sendPush(n)
+	return err
+}
+
+// Devolve quantos dispositivos receberam a notificação
+func sendPush(n Notification) (int, error) {
+	subs, err := store.ListPushSubscriptions(n.UserID)
+	if err != nil || len(subs) == 0 {
+		return 0, err
+	}
+	payload, err := json.Marshal(pushMessage{Title: n.Title, Body: n.Body, URL: n.URL, Tag: n.Tag})
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	var errs []error
+	for i := range subs {
+		sub := &subs[i]
+		err := webPush.send(sub, payload, pushTTL)
+		switch {
+		case errors.Is(err, errPushGone):
+			if err := store.DeletePushEndpoint(sub.Endpoint); err != nil {
+				errs = append(errs, err)
+			}
+		case err != nil:
+			errs = append(errs, fmt.Errorf("subscription %d: %w", sub.ID, err))
+		default:
+			delivered++
+			if err := store.TouchPushSubscription(sub.ID, time.Now()); err != nil {
+				log.Printf("Web Push: error updating subscription %d: %v", sub.ID, err)
+			}
+		}
+	}
+	// Basta um dispositivo ter recebido para não repetir o lembrete
+	if delivered > 0 {
+		for _, err := range errs {
+			log.Printf("Web Push: user %d: %v", n.UserID, err)
+		}
+		return delivered, nil
+	}
+	return 0, errors.Join(errs...)
+}
+
+// Notificação social em segundo plano; falhas só vão para o log. Durante o
+// horário de silêncio do usuário a notificação é descartada.
+func notifySocial(n Notification) {
+	if webPush == nil {
+		return
+	}
+	go func() {
+		user, err := store.GetUser(n.UserID)
+		if err != nil || userQuietHours(user).contains(time.Now().In(loadLocation(user.Timezone))) {
+			return
+		}
+		if _, err := sendPush(n); err != nil {
+			log.Printf("Web Push: social notification to user %d: %v", n.UserID, err)
+		}
+	}()
+}
+
+func socialNotification(userID int, title, body, path string) Notification {
+	return Notification{
+		UserID: userID,
+		Title:  title,
+		Body:   body,
+		URL:    config.AppURL + path,
+	}
+}
+
+// Nome exibido do usuário nas notificações
+func userDisplayName(userID int) string {
+	user, err := store.GetUser(userID)
+	if err != nil {
+		return "Alguém"
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
+
+// Corta o texto em max caracteres para caber na notificação
+func truncateText(text string, max int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= max {
+		return string(runes)
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+func validPushSubscription(sub *PushSubscription) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Host == "" || len(sub.Endpoint) > maxPushEndpointLen {
+		return errors.New("Invalid endpoint")
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && config.isDev()) {
+		return errors.New("Endpoint must use https")
+	}
+	if !config.isDev() {
+		ips, err := net.LookupIP(u.Hostname())
+		if err != nil || len(ips) == 0 {
+			return errors.New("Endpoint host could not be resolved")
+		}
+		for _, ip := range ips {
+			if privateAddress(ip) {
+				return errors.New("Endpoint must be a public address")
+			}
+		}
+	}
+	if key, err := unb64(sub.Keys.P256dh); err != nil || len(key) != 65 || key[0] != 4 {
+		return errors.New("keys.p256dh must be an uncompressed P-256 public key")
+	}
+	if secret, err := unb64(sub.Keys.Auth); err != nil || len(secret) != 16 {
+		return errors.New("keys.auth must be a 16-byte secret")
+	}
+	return nil
+}
+
+func getPushPublicKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"public_key": webPush.keys.Public})
+}
+
+func createPushSubscription(w http.ResponseWriter, r *http.Request) {
+	var sub PushSubscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validPushSubscription(&sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub.UserID = getUserID(r)
+	sub.UserAgent = r.UserAgent()
+	if len(sub.UserAgent) > 255 {
+		sub.UserAgent = sub.UserAgent[:255]
+	}
+
+	if err := store.SavePushSubscription(&sub); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func getPushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := store.ListPushSubscriptions(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []PushSubscription{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func deletePushSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.DeletePushSubscription(getUserID(r), subscriptionID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Envia uma notificação de teste para os dispositivos do usuário
+func testPushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+	delivered, err := sendPush(socialNotification(userID, "Habit Tracker", "Notificações ativadas neste dispositivo.", "/"))
+	if err != nil {
+		log.Printf("Web Push: test notification to user %d: %v", userID, err)
+		http.Error(w, "Error sending notification", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"delivered": delivered})
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Banco SQLite temporário com as migrações aplicadas, no lugar do store
+// global enquanto o teste roda
+func useTestStore(t *testing.T) {
+	t.Helper()
+	s, err := newSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	if _, err := s.MigrateUp(); err != nil {
+		s.Close()
+		t.Fatalf("migrate: %v", err)
+	}
+	previous := store
+	store = s
+	t.Cleanup(func() {
+		store = previous
+		s.Close()
+	})
+}
+
+func useConfigEnv(t *testing.T, env string) {
+	t.Helper()
+	previous := config
+	config.Env = env
+	t.Cleanup(func() { config = previous })
+}
+
+// Serviço de push local (pushservice.go) num httptest.Server e o envio
+// apontado para ele
+func useStandInPushService(t *testing.T) *httptest.Server {
+	t.Helper()
+	router := mux.NewRouter()
+	newPushServiceStandIn().register(router)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	keys, err := newVAPIDKeys()
+	if err != nil {
+		t.Fatalf("VAPID keys: %v", err)
+	}
+	previous := webPush
+	webPush = &webPushSender{keys: keys, subject: "mailto:test@example.com", client: srv.Client()}
+	t.Cleanup(func() { webPush = previous })
+	return srv
+}
+
+func createTestUser(t *testing.T, name string) *User {
+	t.Helper()
+	user := &User{Username: name, Email: name + "@example.com"}
+	if err := store.CreateUser(user, "hash"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// Inscreve um dispositivo do serviço local para o usuário
+func subscribeStandIn(t *testing.T, srv *httptest.Server, userID int) *PushSubscription {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/push-service/subscriptions", "application/json", nil)
+	if err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var sub PushSubscription
+	if err := json.NewDecoder(resp.Body).Decode(&sub); err != nil {
+		t.Fatalf("decode subscription: %v", err)
+	}
+	if err := validPushSubscription(&sub); err != nil {
+		t.Fatalf("validPushSubscription: %v", err)
+	}
+	sub.UserID = userID
+	if err := store.SavePushSubscription(&sub); err != nil {
+		t.Fatalf("save subscription: %v", err)
+	}
+	return &sub
+}
+
+func standInMessages(t *testing.T, srv *httptest.Server, endpoint string) []standInMessage {
+	t.Helper()
+	id := endpoint[strings.LastIndex(endpoint, "/")+1:]
+	resp, err := http.Get(srv.URL + "/push-service/subscriptions/" + id + "/messages")
+	if err != nil {
+		t.Fatalf("get messages: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var messages []standInMessage
+	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
+		t.Fatalf("decode messages: %v", err)
+	}
+	return messages
+}
+
+func TestSendPushDelivers(t *testing.T) {
+	useTestStore(t)
+	useConfigEnv(t, "development")
+	srv := useStandInPushService(t)
+	user := createTestUser(t, "ana")
+	sub := subscribeStandIn(t, srv, user.ID)
+
+	delivered, err := sendPush(Notification{UserID: user.ID, Title: "Lembrete", Body: "Correr", URL: "/habits/1", Tag: "habit-1"})
+	if err != nil {
+		t.Fatalf("sendPush: %v", err)
+	}
+	if delivered != 1 {
+		t.Fatalf("delivered = %d, want 1", delivered)
+	}
+
+	// O serviço local só guarda a mensagem se o VAPID confere e o payload
+	// decifra com as chaves da inscrição
+	messages := standInMessages(t, srv, sub.Endpoint)
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	if messages[0].Subject != "mailto:test@example.com" {
+		t.Errorf("VAPID subject = %q", messages[0].Subject)
+	}
+	var msg pushMessage
+	if err := json.Unmarshal(messages[0].Payload, &msg); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	want := pushMessage{Title: "Lembrete", Body: "Correr", URL: "/habits/1", Tag: "habit-1"}
+	if msg != want {
+		t.Errorf("payload = %+v, want %+v", msg, want)
+	}
+
+	subs, err := store.ListPushSubscriptions(user.ID)
+	if err != nil {
+		t.Fatalf("list subscriptions: %v", err)
+	}
+	if len(subs) != 1 || subs[0].LastUsedAt == nil {
+		t.Errorf("subscription not marked as used: %+v", subs)
+	}
+}
+
+func TestSendPushRemovesGoneSubscriptions(t *testing.T) {
+	useTestStore(t)
+	useConfigEnv(t, "development")
+	srv := useStandInPushService(t)
+	user := createTestUser(t, "ana")
+
+	// 410: o dispositivo expirou a inscrição
+	expired := subscribeStandIn(t, srv, user.ID)
+	id := expired.Endpoint[strings.LastIndex(expired.Endpoint, "/")+1:]
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/push-service/subscriptions/"+id, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expire device: %v", err)
+	}
+	resp.Body.Close()
+
+	// 404: o serviço não conhece a inscrição
+	unknown := *expired
+	unknown.ID = 0
+	unknown.Endpoint = srv.URL + "/push-service/push/999"
+	if err := store.SavePushSubscription(&unknown); err != nil {
+		t.Fatalf("save subscription: %v", err)
+	}
+
+	active := subscribeStandIn(t, srv, user.ID)
+
+	delivered, err := sendPush(Notification{UserID: user.ID, Title: "Lembrete", Body: "Correr"})
+	if err != nil {
+		t.Fatalf("sendPush: %v", err)
+	}
+	if delivered != 1 {
+		t.Errorf("delivered = %d, want 1", delivered)
+	}
+
+	subs, err := store.ListPushSubscriptions(user.ID)
+	if err != nil {
+		t.Fatalf("list subscriptions: %v", err)
+	}
+	if len(subs) != 1 || subs[0].Endpoint != active.Endpoint {
+		t.Errorf("subscriptions = %+v, want only %s", subs, active.Endpoint)
+	}
+}
+
+func TestValidPushSubscriptionRejectsPrivateAddresses(t *testing.T) {
+	useConfigEnv(t, "production")
+	device, err := newVAPIDKeys()
+	if err != nil {
+		t.Fatalf("device keys: %v", err)
+	}
+	keys := PushKeys{P256dh: device.Public, Auth: b64(make([]byte, 16))}
+
+	for _, endpoint := range []string{
+		"https://127.0.0.1/push/1",
+		"https://localhost/push/1",
+		"https://10.1.2.3/push/1",
+		"https://192.168.0.10:8443/push/1",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/push/1",
+		"https://[fe80::1]/push/1",
+		"https://0.0.0.0/push/1",
+		"http://93.184.216.34/push/1",
+	} {
+		sub := PushSubscription{Endpoint: endpoint, Keys: keys}
+		if err := validPushSubscription(&sub); err == nil {
+			t.Errorf("validPushSubscription(%s) accepted a private or plain http endpoint", endpoint)
+		}
+	}
+
+	sub := PushSubscription{Endpoint: "https://93.184.216.34/push/1", Keys: keys}
+	if err := validPushSubscription(&sub); err != nil {
+		t.Errorf("public endpoint rejected: %v", err)
+	}
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34:443":  true,
+		"[2606:4700::1]:443": true,
+		"127.0.0.1:443":      false,
+		"10.0.0.5:443":       false,
+		"172.16.0.1:443":     false,
+		"169.254.169.254:80": false,
+		"[::1]:443":          false,
+		"[fd00::1]:443":      false,
+	} {
+		err := publicAddressOnly("tcp", address, nil)
+		if public && err != nil {
+			t.Errorf("%s: unexpected error %v", address, err)
+		}
+		if !public && err == nil {
+			t.Errorf("%s: private address accepted", address)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Serviço de push local, montado em /push-service apenas em
+// desenvolvimento, para testar o envio sem navegador. Faz o papel do
+// navegador e do serviço de push ao mesmo tempo:
+//
+//	POST   /push-service/subscriptions               cria um dispositivo e devolve a inscrição
+//	POST   /push-service/push/{id}                   recebe o push (VAPID + aes128gcm)
+//	GET    /push-service/subscriptions/{id}/messages mensagens decifradas
+//	DELETE /push-service/subscriptions/{id}          expira a inscrição (pushes seguintes: 410)
+//
+// Os dispositivos ficam só em memória.
+
+const maxStandInPushBody = 4096
+
+type standInDevice struct {
+	ID       int
+	private  *ecdh.PrivateKey
+	auth     []byte
+	Expired  bool
+	Messages []standInMessage
+}
+
+type standInMessage struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	TTL        int             `json:"ttl"`
+	Urgency    string          `json:"urgency,omitempty"`
+	Subject    string          `json:"subject"` // claim sub do VAPID
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type pushServiceStandIn struct {
+	mu      sync.Mutex
+	nextID  int
+	devices map[int]*standInDevice
+}
+
+func newPushServiceStandIn() *pushServiceStandIn {
+	return &pushServiceStandIn{devices: map[int]*standInDevice{}}
+}
+
+func (p *pushServiceStandIn) register(r *mux.Router) {
+	r.HandleFunc("/push-service/subscriptions", p.createSubscription).Methods("POST")
+	r.HandleFunc("/push-service/subscriptions/{id}", p.expireSubscription).Methods("DELETE")
+	r.HandleFunc("/push-service/subscriptions/{id}/messages", p.getMessages).Methods("GET")
+	r.HandleFunc("/push-service/push/{id}", p.receivePush).Methods("POST")
+}
+
+func (p *pushServiceStandIn) device(r *http.Request) (*standInDevice, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, false
+	}
+	device, ok := p.devices[id]
+	return device, ok
+}
+
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Gera as chaves do "navegador" e devolve o JSON de PushSubscription, pronto
+// para POST /api/push/subscriptions
+func (p *pushServiceStandIn) createSubscription(w http.ResponseWriter, r *http.Request) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		http.Error(w, "Error generating keys", http.StatusInternalServerError)
+		return
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		http.Error(w, "Error generating keys", http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.nextID++
+	device := &standInDevice{ID: p.nextID, private: private, auth: auth}
+	p.devices[device.ID] = device
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoint": fmt.Sprintf("%s/push-service/push/%d", requestOrigin(r), device.ID),
+		"keys": PushKeys{
+			P256dh: b64(private.PublicKey().Bytes()),
+			Auth:   b64(auth),
+		},
+	})
+}
+
+func (p *pushServiceStandIn) expireSubscription(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, ok := p.device(r)
+	if !ok {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	device.Expired = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *pushServiceStandIn) getMessages(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, ok := p.device(r)
+	if !ok {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	messages := device.Messages
+	if messages == nil {
+		messages = []standInMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+// Valida o push como um serviço real: VAPID para a origem do endpoint,
+// TTL, aes128gcm e payload que a inscrição consegue decifrar
+func (p *pushServiceStandIn) receivePush(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, ok := p.device(r)
+	if !ok {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if device.Expired {
+		http.Error(w, "Subscription expired", http.StatusGone)
+		return
+	}
+
+	subject, err := verifyVAPID(r.Header.Get("Authorization"), requestOrigin(r), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	ttl, err := strconv.Atoi(r.Header.Get("TTL"))
+	if err != nil || ttl < 0 {
+		http.Error(w, "Missing or invalid TTL header", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" {
+		http.Error(w, "Content-Encoding must be aes128gcm", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxStandInPushBody+1))
+	if err != nil || len(body) > maxStandInPushBody {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	payload, err := decryptPushPayload(device.private, device.auth, body)
+	if err != nil {
+		http.Error(w, "Invalid encrypted payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(payload))
+	}
+
+	device.Messages = append(device.Messages, standInMessage{
+		ReceivedAt: time.Now(),
+		TTL:        ttl,
+		Urgency:    r.Header.Get("Urgency"),
+		Subject:    subject,
+		Payload:    payload,
+	})
+	w.Header().Set("Location", fmt.Sprintf("%s/push-service/subscriptions/%d/messages", requestOrigin(r), device.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Confere o cabeçalho "vapid t=<jwt>, k=<chave>" e devolve o claim sub
+func verifyVAPID(header, origin string, now time.Time) (string, error) {
+	params, ok := strings.CutPrefix(header, "vapid ")
+	if !ok {
+		return "", errors.New("Missing VAPID authorization")
+	}
+	var token, key string
+	for _, part := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+
+	raw, err := unb64(key)
+	if err != nil || len(raw) != 65 || raw[0] != 4 {
+		return "", errors.New("Invalid VAPID public key")
+	}
+	public := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[1:33]),
+		Y:     new(big.Int).SetBytes(raw[33:65]),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithAudience(origin),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+	)
+	if err != nil {
+		return "", fmt.Errorf("Invalid VAPID token: %w", err)
+	}
+	// RFC 8292: exp no máximo 24 horas no futuro
+	exp, _ := claims.GetExpirationTime()
+	if exp.Sub(now) > 24*time.Hour {
+		return "", errors.New("VAPID token expires too far in the future")
+	}
+	subject, _ := claims["sub"].(string)
+	return subject, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Hábitos negativos ("quit"): coisas que o usuário quer parar de fazer.
+// Cada entrada registra uma recaída; o streak é o tempo desde a última
+// recaída (ou desde a criação do hábito) e a agenda não se aplica.
+
+const (
+	polarityBuild = "build"
+	polarityQuit  = "quit"
+)
+
+type QuitHabitStats struct {
+	HabitID   int    `json:"habit_id"`
+	HabitName string `json:"habit_name"`
+	// Dias de calendário sem recaída até agora
+	DaysClean   int        `json:"days_clean"`
+	CleanSince  time.Time  `json:"clean_since"`
+	LastRelapse *time.Time `json:"last_relapse,omitempty"`
+	// Recaídas no período do analytics e a média por semana
+	Relapses        int     `json:"relapses"`
+	RelapsesPerWeek float64 `json:"relapses_per_week"`
+	// Maior intervalo sem recaída, em dias
+	LongestAbstinence int `json:"longest_abstinence"`
+}
+
+func validatePolarity(habit *Habit) error {
+	switch habit.Polarity {
+	case "":
+		habit.Polarity = polarityBuild
+	case polarityBuild:
+	case polarityQuit:
+		// Recaídas podem acontecer em qualquer dia
+		habit.Schedule = Schedule{}
+	default:
+		return errors.New("Polaridade deve ser build ou quit")
+	}
+	return nil
+}
+
+// Polaridade a gravar; vazio (hábitos antigos ou importados) é "build"
+func (h *Habit) polarity() string {
+	if h.Polarity == "" {
+		return polarityBuild
+	}
+	return h.Polarity
+}
+
+func (h *Habit) isQuit() bool {
+	return h.Polarity == polarityQuit
+}
+
+// Dias de calendário entre from e to, no fuso do usuário; contar pelas
+// datas, e não por blocos de 24 horas, acompanha as trocas de horário
+func calendarDays(from, to time.Time, cal Calendar) int {
+	days := int(cal.day(to).Sub(cal.day(from)).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// Dias limpos (desde a última recaída) e maior abstinência, em dias de
+// calendário. A contagem começa na criação do hábito ou na primeira
+// recaída, se for anterior (entradas retroativas). relapses pode vir em
+// qualquer ordem.
+func abstinence(habit *Habit, relapses []time.Time, now time.Time, cal Calendar) (current, longest int, cleanSince time.Time) {
+	sorted := append([]time.Time(nil), relapses...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	cleanSince = habit.CreatedAt
+	if len(sorted) > 0 && sorted[0].Before(cleanSince) {
+		cleanSince = sorted[0]
+	}
+	for _, t := range sorted {
+		if gap := calendarDays(cleanSince, t, cal); gap > longest {
+			longest = gap
+		}
+		cleanSince = t
+	}
+
+	current = calendarDays(cleanSince, now, cal)
+	if current > longest {
+		longest = current
+	}
+	return current, longest, cleanSince
+}
+
+// Dias sem recaída em [from, to] (meia-noite UTC), para a taxa de
+// conclusão, sem os dias dispensados
+func quitCompletion(relapseDays []time.Time, from, to time.Time, excused excusedFunc) (done, expected float64) {
+	relapsed := completedDays(relapseDays)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if excused.has(day) {
+			continue
+		}
+		expected++
+		if !relapsed[day] {
+			done++
+		}
+	}
+	return done, expected
+}
+
+// Estatísticas de abstinência de um hábito negativo; days é o período
+// do analytics usado na frequência de recaídas
+func quitHabitStats(habit *Habit, days int, cal Calendar) (QuitHabitStats, error) {
+	stats := QuitHabitStats{HabitID: habit.ID, HabitName: habit.Name}
+
+	relapses, err := store.EntryTimes(habit.ID)
+	if err != nil {
+		return stats, err
+	}
+
+	now := time.Now()
+	stats.DaysClean, stats.LongestAbstinence, stats.CleanSince = abstinence(habit, relapses, now, cal)
+	if len(relapses) > 0 {
+		// EntryTimes vem da mais recente para a mais antiga
+		stats.LastRelapse = &relapses[0]
+	}
+
+	since := now.AddDate(0, 0, -days)
+	for _, t := range relapses {
+		if !t.Before(since) {
+			stats.Relapses++
+		}
+	}
+	if days > 0 {
+		stats.RelapsesPerWeek = float64(stats.Relapses) / (float64(days) / 7)
+	}
+	return stats, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAbstinence(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	cal := Calendar{Loc: berlin, WeekStart: time.Monday}
+	habit := &Habit{CreatedAt: utc("2024-03-20T12:00:00Z")}
+
+	tests := []struct {
+		name     string
+		relapses []string
+		now      string
+		current  int
+		longest  int
+	}{
+		{
+			name:    "no relapses since creation",
+			now:     "2024-03-25T12:00:00Z",
+			current: 5,
+			longest: 5,
+		},
+		{
+			// 30/03 23:30 +01 até 31/03 23:30 +02: 23 horas, mas um dia
+			name:     "spring forward day counts as a day",
+			relapses: []string{"2024-03-30T22:30:00Z"},
+			now:      "2024-03-31T21:30:00Z",
+			current:  1,
+			longest:  10,
+		},
+		{
+			// Recaída registrada com data anterior à criação do hábito
+			name:     "backdated relapse before creation",
+			relapses: []string{"2024-03-22T08:00:00Z", "2024-03-01T08:00:00Z"},
+			now:      "2024-03-24T08:00:00Z",
+			current:  2,
+			longest:  21,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var relapses []time.Time
+			for _, s := range tt.relapses {
+				relapses = append(relapses, utc(s))
+			}
+			current, longest, _ := abstinence(habit, relapses, utc(tt.now), cal)
+			if current != tt.current || longest != tt.longest {
+				t.Errorf("abstinence = (%d, %d), want (%d, %d)", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limiting das rotas públicas de autenticação e bloqueio progressivo
+// de login. Os contadores são janelas fixas identificadas por chave:
+//
+//	req:<rota>:<ip>   pedidos por IP em cada rota limitada
+//	fail:<alvo>       falhas de login na janela LoginFailureWindow
+//	lock:<alvo>       bloqueio ativo; a janela é a duração do bloqueio
+//	lockouts:<alvo>   bloqueios nas últimas 24h, para dobrar a duração
+//
+// onde <alvo> é "acct:<hash do e-mail>" ou "ip:<ip>".
+
+const lockoutMemory = 24 * time.Hour
+
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id"`
+	Event     string    `json:"event"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Contadores em memória, para uma única instância
+type memoryRateLimits struct {
+	mu        sync.Mutex
+	counters  map[string]*rateCounter
+	lastSweep time.Time
+}
+
+type rateCounter struct {
+	hits    int
+	resetAt time.Time
+}
+
+var limits RateLimitStore
+
+func newRateLimits(c Config, s Store) RateLimitStore {
+	if c.RateLimitStore == "database" {
+		return s
+	}
+	return &memoryRateLimits{counters: map[string]*rateCounter{}}
+}
+
+func (m *memoryRateLimits) HitRateLimit(key string, window time.Duration) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, c := range m.counters {
+			if !now.Before(c.resetAt) {
+				delete(m.counters, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	c := m.counters[key]
+	if c == nil || !now.Before(c.resetAt) {
+		c = &rateCounter{resetAt: now.Add(window)}
+		m.counters[key] = c
+	}
+	c.hits++
+	return c.hits, c.resetAt, nil
+}
+
+func (m *memoryRateLimits) PeekRateLimit(key string) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.counters[key]
+	if c == nil || !time.Now().Before(c.resetAt) {
+		return 0, time.Time{}, nil
+	}
+	return c.hits, c.resetAt, nil
+}
+
+func (m *memoryRateLimits) ClearRateLimit(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.counters, key)
+	return nil
+}
+
+func writeTooManyRequests(w http.ResponseWriter, resetAt time.Time, message string) {
+	seconds := int(math.Ceil(time.Until(resetAt).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// Limita os pedidos por IP a AuthRateLimit a cada AuthRateWindow
+func rateLimited(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hits, resetAt, err := limits.HitRateLimit("req:"+name+":"+clientIP(r), config.AuthRateWindow)
+		if err != nil {
+			// Sem contador o pedido segue; o bloqueio de login continua valendo
+			log.Printf("Error updating rate limit: %v", err)
+		} else if hits > config.AuthRateLimit {
+			writeTooManyRequests(w, resetAt, "Too many requests, try again later")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func accountKey(email string) string {
+	return "acct:" + hashToken(strings.ToLower(strings.TrimSpace(email)))[:32]
+}
+
+// Responde 429 se a conta ou o IP estiverem bloqueados
+func checkLockout(w http.ResponseWriter, r *http.Request, email string) bool {
+	for _, target := range []string{accountKey(email), "ip:" + clientIP(r)} {
+		hits, resetAt, err := limits.PeekRateLimit("lock:" + target)
+		if err != nil {
+			log.Printf("Error reading lockout: %v", err)
+			continue
+		}
+		if hits > 0 {
+			writeTooManyRequests(w, resetAt, "Too many failed attempts, try again later")
+			return false
+		}
+	}
+	return true
+}
+
+// Conta uma falha de login para a conta e para o IP, bloqueando quem
+// passar do limite. user é nil quando o e-mail não tem conta.
+func recordLoginFailure(r *http.Request, email string, user *User) {
+	ip := clientIP(r)
+	targets := []struct {
+		key, event string
+		max        int
+	}{
+		{accountKey(email), "account_locked", config.LoginMaxFailures},
+		{"ip:" + ip, "ip_locked", config.LoginMaxFailuresIP},
+	}
+
+	for _, t := range targets {
+		failures, _, err := limits.HitRateLimit("fail:"+t.key, config.LoginFailureWindow)
+		if err != nil {
+			log.Printf("Error counting login failure: %v", err)
+			continue
+		}
+		if failures < t.max {
+			continue
+		}
+
+		duration, err := lock(t.key)
+		if err != nil {
+			log.Printf("Error locking %s: %v", t.key, err)
+			continue
+		}
+
+		event := AuditEvent{Event: t.event, IP: ip,
+			Detail: fmt.Sprintf("locked for %s after %d failed attempts", duration, failures)}
+		if user != nil && t.event == "account_locked" {
+			event.UserID = &user.ID
+		}
+		if err := store.RecordAuditEvent(&event); err != nil {
+			log.Printf("Error recording audit event: %v", err)
+		}
+		log.Printf("Login %s (%s): %s", t.event, ip, event.Detail)
+	}
+}
+
+// Bloqueia o alvo; a duração dobra a cada bloqueio nas últimas 24h
+func lock(target string) (time.Duration, error) {
+	lockouts, _, err := limits.HitRateLimit("lockouts:"+target, lockoutMemory)
+	if err != nil {
+		return 0, err
+	}
+
+	duration := config.LockoutDuration
+	for i := 1; i < lockouts && duration < config.LockoutMaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > config.LockoutMaxDuration {
+		duration = config.LockoutMaxDuration
+	}
+
+	if _, _, err := limits.HitRateLimit("lock:"+target, duration); err != nil {
+		return 0, err
+	}
+	return duration, limits.ClearRateLimit("fail:" + target)
+}
+
+// Login bem-sucedido zera as falhas da conta. As do IP continuam, senão
+// quem tem uma conta válida poderia zerá-las entre tentativas em outras.
+func clearLoginFailures(email string) {
+	if err := limits.ClearRateLimit("fail:" + accountKey(email)); err != nil {
+		log.Printf("Error clearing login failures: %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Ajustes do horário dos lembretes, aplicados pelo agendador
+// (reminders.go):
+//   - horário de silêncio do usuário: o lembrete que cairia dentro dele sai
+//     quando o silêncio termina, ou é descartado se isso já for outro dia;
+//   - adiamento: POST /habits/{id}/reminders/snooze reagenda o último
+//     lembrete enviado, que é reenviado se o hábito continuar pendente;
+//   - modo adaptativo: o hábito usa um horário calculado a partir das
+//     conclusões recentes em vez de reminder_times.
+
+const (
+	reminderModeFixed    = "fixed"
+	reminderModeAdaptive = "adaptive"
+
+	defaultSnoozeMinutes = 10
+	maxSnoozeMinutes     = 240
+	maxSnoozes           = 3 // por lembrete enviado
+
+	adaptiveLookbackDays  = 60
+	adaptiveMinSamples    = 5  // dias com conclusão
+	adaptiveWindowMinutes = 60 // janela em que as conclusões se concentram
+	adaptiveLeadMinutes   = 15 // antecedência do lembrete
+)
+
+// Lembrete enviado pelo agendador
+type ReminderDelivery struct {
+	HabitID      int        `json:"habit_id"`
+	Day          string     `json:"day"`           // YYYY-MM-DD local
+	ReminderTime string     `json:"reminder_time"` // HH:MM
+	SentAt       time.Time  `json:"sent_at"`
+	SnoozedUntil *time.Time `json:"snoozed_until"`
+	SnoozeCount  int        `json:"snooze_count"`
+}
+
+type SnoozeReminderRequest struct {
+	ReminderTime string `json:"reminder_time"` // vazio = último lembrete enviado hoje
+	Minutes      int    `json:"minutes"`
+}
+
+// Horário sugerido para o modo adaptativo
+type ReminderSuggestion struct {
+	Time        string  `json:"time"`                   // vazio sem conclusões suficientes
+	TypicalTime string  `json:"typical_time,omitempty"` // mediana das conclusões na janela
+	WindowStart string  `json:"window_start,omitempty"`
+	WindowEnd   string  `json:"window_end,omitempty"`
+	Share       float64 `json:"share"`       // fração dos dias concluídos dentro da janela
+	SampleSize  int     `json:"sample_size"` // dias com conclusão no período analisado
+	MinSamples  int     `json:"min_samples"`
+	LeadMinutes int     `json:"lead_minutes"`
+	Mode        string  `json:"mode"` // modo atual do hábito
+}
+
+func validateReminderMode(habit *Habit) error {
+	switch habit.ReminderMode {
+	case "":
+		habit.ReminderMode = reminderModeFixed
+	case reminderModeFixed, reminderModeAdaptive:
+	default:
+		return errors.New("Modo de lembrete deve ser fixed ou adaptive")
+	}
+	return nil
+}
+
+// Modo a gravar; vazio (hábitos antigos ou importados) é "fixed"
+func (h *Habit) reminderMode() string {
+	if h.ReminderMode == "" {
+		return reminderModeFixed
+	}
+	return h.ReminderMode
+}
+
+// Minutos desde a meia-noite de um horário HH:MM
+func parseClock(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	minutes = (minutes%1440 + 1440) % 1440
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// Horário de silêncio em minutos do dia; pode atravessar a meia-noite
+type quietHours struct {
+	enabled    bool
+	start, end int
+}
+
+func userQuietHours(user *User) quietHours {
+	start, err := parseClock(user.QuietHoursStart)
+	if err != nil {
+		return quietHours{}
+	}
+	end, err := parseClock(user.QuietHoursEnd)
+	if err != nil || start == end {
+		return quietHours{}
+	}
+	return quietHours{enabled: true, start: start, end: end}
+}
+
+// t no fuso do usuário
+func (q quietHours) contains(t time.Time) bool {
+	if !q.enabled {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+// Momento de entrega de um lembrete marcado para at: o próprio at fora do
+// silêncio, senão o fim do silêncio; false se isso já cai no dia seguinte
+func (q quietHours) deferAt(at time.Time) (time.Time, bool) {
+	if !q.contains(at) {
+		return at, true
+	}
+	end := time.Date(at.Year(), at.Month(), at.Day(), q.end/60, q.end%60, 0, 0, at.Location())
+	if !end.After(at) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, end.Day() == at.Day()
+}
+
+// Propõe o horário do lembrete a partir dos horários de conclusão (minutos
+// do dia, um por dia): acha a janela de adaptiveWindowMinutes com mais
+// conclusões, considerando a virada do dia, e sugere a mediana dela menos
+// a antecedência, arredondada para 5 minutos
+func suggestReminderTime(minutes []int) ReminderSuggestion {
+	suggestion := ReminderSuggestion{
+		SampleSize:  len(minutes),
+		MinSamples:  adaptiveMinSamples,
+		LeadMinutes: adaptiveLeadMinutes,
+	}
+	n := len(minutes)
+	if n < adaptiveMinSamples {
+		return suggestion
+	}
+
+	sorted := append([]int{}, minutes...)
+	sort.Ints(sorted)
+	// Segunda volta com +24h para as janelas que passam da meia-noite
+	extended := append(sorted, make([]int, n)...)
+	for i, m := range sorted {
+		extended[n+i] = m + 1440
+	}
+
+	best, bestCount := 0, 0
+	j := 0
+	for i := 0; i < n; i++ {
+		for j < i+n && extended[j]-extended[i] < adaptiveWindowMinutes {
+			j++
+		}
+		if j-i > bestCount {
+			best, bestCount = i, j-i
+		}
+	}
+	window := extended[best : best+bestCount]
+	typical := window[(len(window)-1)/2]
+
+	suggested := ((typical-adaptiveLeadMinutes)%1440 + 1440) % 1440
+	suggestion.Time = formatClock(suggested / 5 * 5)
+	suggestion.TypicalTime = formatClock(typical)
+	suggestion.WindowStart = formatClock(window[0])
+	suggestion.WindowEnd = formatClock(window[0] + adaptiveWindowMinutes)
+	suggestion.Share = math.Round(float64(bestCount)/float64(n)*100) / 100
+	return suggestion
+}
+
+// Sugestão para o hábito com as conclusões dos últimos adaptiveLookbackDays
+// dias; conta só a primeira conclusão de cada dia local
+func habitReminderSuggestion(habit *Habit, loc *time.Location, now time.Time) (ReminderSuggestion, error) {
+	since := dayStart(entryDay(now, loc).AddDate(0, 0, -adaptiveLookbackDays), loc)
+	times, err := store.EntryTimes(habit.ID)
+	if err != nil {
+		return ReminderSuggestion{}, err
+	}
+
+	// EntryTimes vem da mais recente para a mais antiga
+	seen := map[time.Time]bool{}
+	var minutes []int
+	for i := len(times) - 1; i >= 0; i-- {
+		t := times[i]
+		if t.Before(since) {
+			continue
+		}
+		day := entryDay(t, loc)
+		if seen[day] {
+			continue
+		}
+		seen[day] = true
+		local := t.In(loc)
+		minutes = append(minutes, local.Hour()*60+local.Minute())
+	}
+
+	suggestion := suggestReminderTime(minutes)
+	suggestion.Mode = habit.reminderMode()
+	return suggestion, nil
+}
+
+// Horário adaptativo por hábito, calculado uma vez por dia local; usado só
+// pelo agendador
+type adaptiveTime struct {
+	day  string
+	time string // vazio: sem dados, valem os horários fixos
+}
+
+var adaptiveTimes = map[int]adaptiveTime{}
+
+// Horários de lembrete do hábito no dia de now
+func habitReminderTimes(habit *Habit, loc *time.Location, now time.Time) []string {
+	if habit.ReminderMode != reminderModeAdaptive {
+		return habit.ReminderTimes
+	}
+
+	day := entryDay(now, loc).Format(dateLayout)
+	cached, ok := adaptiveTimes[habit.ID]
+	if !ok || cached.day != day {
+		suggestion, err := habitReminderSuggestion(habit, loc, now)
+		if err != nil {
+			log.Printf("Reminder scheduler: habit %d: error computing adaptive time: %v", habit.ID, err)
+			return habit.ReminderTimes
+		}
+		cached = adaptiveTime{day: day, time: suggestion.Time}
+		adaptiveTimes[habit.ID] = cached
+	}
+	if cached.time == "" {
+		return habit.ReminderTimes
+	}
+	return []string{cached.time}
+}
+
+// Reenvia os lembretes adiados que venceram; devolve quantos foram enviados
+func sendDueSnoozes(now time.Time, habits map[int]*Habit, users reminderUsers) int {
+	snoozes, err := store.ListDueSnoozes(now)
+	if err != nil {
+		log.Printf("Reminder scheduler: error listing snoozed reminders: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for i := range snoozes {
+		snooze := &snoozes[i]
+		if err := store.ClaimSnooze(snooze.HabitID, snooze.Day, snooze.ReminderTime, now); err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Reminder scheduler: error claiming snoozed reminder: %v", err)
+			}
+			continue
+		}
+		// Lembrete desligado, hábito arquivado ou removido: só descarta
+		habit, ok := habits[snooze.HabitID]
+		if !ok {
+			continue
+		}
+
+		loc := users.get(habit.UserID).cal.Loc
+		day, err := time.Parse(dateLayout, snooze.Day)
+		if err != nil {
+			continue
+		}
+		done, err := dayGoalMet(habit, day, loc)
+		if err != nil || done {
+			if err != nil {
+				log.Printf("Reminder scheduler: habit %d: %v", habit.ID, err)
+			}
+			continue
+		}
+
+		if err := notifier.Notify(reminderNotification(habit, reminderSlot{Day: day, Time: snooze.ReminderTime})); err != nil {
+			log.Printf("Reminder scheduler: habit %d snoozed reminder: %v", habit.ID, err)
+			// Devolve o adiamento para a próxima rodada tentar de novo
+			snooze.SnoozedUntil = &now
+			if err := store.SnoozeReminder(snooze); err != nil {
+				log.Printf("Reminder scheduler: error restoring snoozed reminder: %v", err)
+			}
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+func snoozeHabitReminder(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req SnoozeReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes == 0 {
+		req.Minutes = defaultSnoozeMinutes
+	}
+	if req.Minutes < 1 || req.Minutes > maxSnoozeMinutes {
+		http.Error(w, fmt.Sprintf("Minutes must be between 1 and %d", maxSnoozeMinutes), http.StatusBadRequest)
+		return
+	}
+
+	user, err := store.GetUser(habit.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	loc := loadLocation(user.Timezone)
+	now := time.Now()
+	day := entryDay(now, loc).Format(dateLayout)
+
+	var delivery *ReminderDelivery
+	if req.ReminderTime != "" {
+		minutes, err := parseClock(req.ReminderTime)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		delivery, err = store.GetReminderDelivery(habit.ID, day, formatClock(minutes))
+	} else {
+		delivery, err = store.LatestReminderDelivery(habit.ID, day)
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "No reminder was sent for this habit today", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if delivery.SnoozeCount >= maxSnoozes {
+		http.Error(w, fmt.Sprintf("Reminder was already snoozed %d times", maxSnoozes), http.StatusConflict)
+		return
+	}
+
+	until, sameDay := userQuietHours(user).deferAt(now.Add(time.Duration(req.Minutes) * time.Minute).In(loc))
+	if !sameDay {
+		http.Error(w, "Snooze would end in quiet hours after the end of the day", http.StatusConflict)
+		return
+	}
+	delivery.SnoozedUntil = &until
+	delivery.SnoozeCount++
+	if err := store.SnoozeReminder(delivery); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+func getReminderSuggestion(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	suggestion, err := habitReminderSuggestion(habit, userLocation(habit.UserID), time.Now())
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestion)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Agendador de lembretes: a cada config.ReminderInterval procura os
+// horários de reminder_times (HH:MM no fuso do usuário) que já passaram há
+// no máximo config.ReminderCatchUp e envia o lembrete pelo Notifier
+// configurado, exceto se o hábito não está previsto no dia, foi dispensado
+// ou já foi concluído. Cada envio é reservado antes em reminder_deliveries,
+// então reinícios e várias instâncias não repetem lembretes; horários
+// perdidos há mais tempo que a tolerância são descartados. Silêncio,
+// adiamentos e o modo adaptativo ficam em reminder_timing.go.
+
+const reminderRetentionDays = 7
+
+type Notification struct {
+	UserID  int
+	HabitID int
+	Title   string
+	Body    string
+	URL     string
+	Tag     string // notificações com a mesma tag se substituem
+}
+
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+var notifier Notifier
+
+func newNotifier(c Config) (Notifier, error) {
+	switch c.NotifyDriver {
+	case "log":
+		return logNotifier{}, nil
+	case "mail":
+		return mailNotifier{}, nil
+	case "push":
+		return pushNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported notify driver %q", c.NotifyDriver)
+	}
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(n Notification) error {
+	log.Printf("Notification to user %d: %s - %s", n.UserID, n.Title, n.Body)
+	return nil
+}
+
+// Envia o lembrete por e-mail pelo mailer configurado
+type mailNotifier struct{}
+
+func (mailNotifier) Notify(n Notification) error {
+	user, err := store.GetUser(n.UserID)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(Mail{
+		To:      user.Email,
+		Subject: n.Title,
+		Text:    n.Body + "\n\n" + n.URL,
+	})
+}
+
+func startReminderScheduler(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sendDueReminders(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// Horário de lembrete de um hábito num dia local
+type reminderSlot struct {
+	Day       time.Time // meia-noite UTC
+	Time      string    // HH:MM
+	At        time.Time
+	DeliverAt time.Time // At adiado para depois do horário de silêncio
+}
+
+// Calendário e silêncio de cada usuário, carregados uma vez por rodada
+type reminderUser struct {
+	cal     Calendar
+	quiet   quietHours
+	excuses *Excuses
+}
+
+type reminderUsers map[int]*reminderUser
+
+func (u reminderUsers) get(userID int) *reminderUser {
+	if cached, ok := u[userID]; ok {
+		return cached
+	}
+	settings := &reminderUser{cal: Calendar{Loc: time.UTC}}
+	if user, err := store.GetUser(userID); err == nil {
+		settings.cal = Calendar{Loc: loadLocation(user.Timezone), WeekStart: time.Weekday(user.WeekStart)}
+		settings.quiet = userQuietHours(user)
+	}
+	u[userID] = settings
+	return settings
+}
+
+// Horários entre now-catchUp e now, no fuso loc, com a entrega adiada para
+// depois do silêncio; olha também ontem para os lembretes perto da
+// meia-noite
+func dueReminderSlots(times []string, loc *time.Location, quiet quietHours, now time.Time, catchUp time.Duration) []reminderSlot {
+	today := entryDay(now, loc)
+	var slots []reminderSlot
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		for _, hhmm := range times {
+			clock, err := time.Parse("15:04", hhmm)
+			if err != nil {
+				continue
+			}
+			at := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+			deliverAt, ok := quiet.deferAt(at)
+			if ok && !deliverAt.After(now) && now.Sub(deliverAt) <= catchUp {
+				slots = append(slots, reminderSlot{Day: day, Time: clock.Format("15:04"), At: at, DeliverAt: deliverAt})
+			}
+		}
+	}
+	return slots
+}
+
+// Uma rodada do agendador; devolve quantos lembretes foram enviados
+func sendDueReminders(now time.Time) int {
+	habits, err := store.ListReminderHabits()
+	if err != nil {
+		log.Printf("Reminder scheduler: error listing habits: %v", err)
+		return 0
+	}
+
+	users := reminderUsers{}
+	byID := map[int]*Habit{}
+	sent := 0
+	for i := range habits {
+		habit := &habits[i]
+		byID[habit.ID] = habit
+		user := users.get(habit.UserID)
+
+		times := habitReminderTimes(habit, user.cal.Loc, now)
+		for _, slot := range dueReminderSlots(times, user.cal.Loc, user.quiet, now, config.ReminderCatchUp) {
+			if user.excuses == nil {
+				user.excuses = userExcuses(habit.UserID)
+			}
+			ok, err := sendReminder(habit, slot, user.cal, user.excuses)
+			if err != nil {
+				log.Printf("Reminder scheduler: habit %d at %s %s: %v", habit.ID, slot.Day.Format(dateLayout), slot.Time, err)
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+
+	sent += sendDueSnoozes(now, byID, users)
+
+	before := localToday(time.UTC).AddDate(0, 0, -reminderRetentionDays).Format(dateLayout)
+	if _, err := store.PruneReminderDeliveries(before); err != nil {
+		log.Printf("Reminder scheduler: error pruning deliveries: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Reminder scheduler: sent %d reminder(s)", sent)
+	}
+	return sent
+}
+
+// Envia o lembrete do horário se ele ainda é devido; false se foi pulado
+// ou já tinha sido enviado
+func sendReminder(habit *Habit, slot reminderSlot, cal Calendar, ex *Excuses) (bool, error) {
+	due, err := habitDueOn(habit, slot.Day, cal, ex)
+	if err != nil || !due {
+		return false, err
+	}
+	done, err := dayGoalMet(habit, slot.Day, cal.Loc)
+	if err != nil || done {
+		return false, err
+	}
+
+	day := slot.Day.Format(dateLayout)
+	if err := store.ClaimReminder(habit.ID, day, slot.Time); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := notifier.Notify(reminderNotification(habit, slot)); err != nil {
+		// Libera o horário para a próxima rodada tentar de novo
+		if releaseErr := store.ReleaseReminder(habit.ID, day, slot.Time); releaseErr != nil {
+			log.Printf("Reminder scheduler: error releasing reminder: %v", releaseErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Se o hábito já está cumprido no dia local: nas metas diárias (count) de
+// hábitos com várias atualizações ou com unidade, a soma do dia precisa
+// alcançar a meta, como em recordGoalPeriod; nos demais basta uma entrada
+func dayGoalMet(habit *Habit, day time.Time, loc *time.Location) (bool, error) {
+	count, value, err := sumDueEntries(habit, dayStart(day, loc), dayStart(day.AddDate(0, 0, 1), loc).Add(-time.Second), loc)
+	if err != nil {
+		return false, err
+	}
+	if habit.GoalType == "count" && (habit.MultipleUpdate || habit.Unit != "") && habit.goalTarget() > 0 {
+		return value >= habit.goalTarget(), nil
+	}
+	return count > 0, nil
+}
+
+func reminderNotification(habit *Habit, slot reminderSlot) Notification {
+	return Notification{
+		UserID:  habit.UserID,
+		HabitID: habit.ID,
+		Title:   "Lembrete: " + habit.Name,
+		Body:    fmt.Sprintf("Hora de %s! Não se esqueça de completar seu hábito.", strings.ToLower(habit.Name)),
+		URL:     fmt.Sprintf("%s/habit/%d", config.AppURL, habit.ID),
+		Tag:     fmt.Sprintf("habit-%d-%s", habit.ID, slot.Time),
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// O lembrete continua enquanto o progresso do dia não alcança a meta diária
+func TestDayGoalMet(t *testing.T) {
+	useTestStore(t)
+	user := createTestUser(t, "ana")
+	day := date("2026-09-10")
+
+	tests := []struct {
+		name   string
+		habit  Habit
+		values []float64
+		want   bool
+	}{
+		{"single entry habit", Habit{Goal: 3, GoalType: "weekly"}, []float64{1}, true},
+		{"no entries", Habit{Goal: 1, GoalType: "count"}, nil, false},
+		{"multiple updates below target", Habit{Goal: 3, GoalType: "count", MultipleUpdate: true}, []float64{1, 1}, false},
+		{"multiple updates at target", Habit{Goal: 3, GoalType: "count", MultipleUpdate: true}, []float64{1, 1, 1}, true},
+		{"quantity below target", Habit{Goal: 1, GoalType: "count", Unit: "L", TargetValue: 2}, []float64{0.5, 1}, false},
+		{"quantity at target", Habit{Goal: 1, GoalType: "count", Unit: "L", TargetValue: 2}, []float64{0.5, 1.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			habit := tt.habit
+			habit.UserID, habit.Name, habit.Visibility, habit.IsActive = user.ID, tt.name, "private", true
+			if err := store.CreateHabit(&habit); err != nil {
+				t.Fatalf("create habit: %v", err)
+			}
+			for i, value := range tt.values {
+				entry := HabitEntry{HabitID: habit.ID, CompletedAt: dayStart(day, time.UTC).Add(time.Duration(i+8) * time.Hour), Value: value}
+				if err := store.CreateEntry(&entry); err != nil {
+					t.Fatalf("create entry: %v", err)
+				}
+			}
+
+			got, err := dayGoalMet(&habit, day, time.UTC)
+			if err != nil {
+				t.Fatalf("dayGoalMet: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("dayGoalMet = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Agenda do hábito: em quais dias ele é esperado. Streaks, taxa de
+// conclusão e metas só consideram os dias devidos; nos tipos por
+// frequência (N vezes por semana ou mês) qualquer dia serve e a unidade
+// do streak passa a ser o período cumprido.
+
+const (
+	scheduleDaily    = "daily"
+	scheduleWeekdays = "weekdays" // dias da semana escolhidos
+	scheduleInterval = "interval" // a cada N dias a partir de start_date
+	scheduleWeekly   = "weekly"   // N vezes por semana
+	scheduleMonthly  = "monthly"  // N vezes por mês
+
+	dateLayout = "2006-01-02"
+)
+
+type Schedule struct {
+	Type      string `json:"type"`
+	Weekdays  []int  `json:"weekdays,omitempty"`   // 0 = domingo ... 6 = sábado
+	Interval  int    `json:"interval,omitempty"`   // dias entre ocorrências
+	StartDate string `json:"start_date,omitempty"` // YYYY-MM-DD; padrão: criação do hábito
+	Times     int    `json:"times,omitempty"`      // vezes por período
+}
+
+func (s Schedule) validate() error {
+	switch s.Type {
+	case "", scheduleDaily:
+	case scheduleWeekdays:
+		if len(s.Weekdays) == 0 {
+			return errors.New("schedule.weekdays deve ter ao menos um dia")
+		}
+		for _, d := range s.Weekdays {
+			if d < 0 || d > 6 {
+				return errors.New("schedule.weekdays deve estar entre 0 (domingo) e 6 (sábado)")
+			}
+		}
+	case scheduleInterval:
+		if s.Interval < 1 {
+			return errors.New("schedule.interval deve ser pelo menos 1")
+		}
+		if s.StartDate != "" {
+			if _, err := time.Parse(dateLayout, s.StartDate); err != nil {
+				return errors.New("schedule.start_date deve estar no formato AAAA-MM-DD")
+			}
+		}
+	case scheduleWeekly, scheduleMonthly:
+		if s.Times < 1 {
+			return errors.New("schedule.times deve ser pelo menos 1")
+		}
+		if s.Type == scheduleWeekly && s.Times > 7 {
+			return errors.New("schedule.times deve ser no máximo 7 na agenda semanal")
+		}
+		if s.Type == scheduleMonthly && s.Times > 31 {
+			return errors.New("schedule.times deve ser no máximo 31 na agenda mensal")
+		}
+	default:
+		return errors.New("schedule.type deve ser daily, weekdays, interval, weekly ou monthly")
+	}
+	return nil
+}
+
+// Completa os valores padrão antes de gravar; createdAt vem no fuso do
+// usuário, para que start_date seja a data local de criação
+func (s *Schedule) normalize(createdAt time.Time) {
+	if s.Type == "" {
+		s.Type = scheduleDaily
+	}
+	if s.Type == scheduleInterval && s.StartDate == "" {
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		s.StartDate = createdAt.Format(dateLayout)
+	}
+	if s.Type != scheduleWeekdays {
+		s.Weekdays = nil
+	}
+	if s.Type != scheduleInterval {
+		s.Interval, s.StartDate = 0, ""
+	}
+	if s.Type != scheduleWeekly && s.Type != scheduleMonthly {
+		s.Times = 0
+	}
+}
+
+func scheduleToString(s Schedule) string {
+	if s.Type == "" || s.Type == scheduleDaily {
+		return ""
+	}
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Coluna vazia (hábitos antigos) equivale a diário
+func stringToSchedule(str string) Schedule {
+	var s Schedule
+	if str != "" {
+		json.Unmarshal([]byte(str), &s)
+	}
+	if s.Type == "" {
+		s.Type = scheduleDaily
+	}
+	return s
+}
+
+func (s Schedule) isFrequency() bool {
+	return s.Type == scheduleWeekly || s.Type == scheduleMonthly
+}
+
+// Unidade do streak: dias devidos ou períodos com a frequência cumprida
+func (s Schedule) streakUnit() string {
+	switch s.Type {
+	case scheduleWeekly:
+		return "weeks"
+	case scheduleMonthly:
+		return "months"
+	}
+	return "days"
+}
+
+// Se o hábito é esperado no dia (meia-noite UTC). Nos tipos por
+// frequência todos os dias contam.
+func (s Schedule) isDue(day time.Time) bool {
+	switch s.Type {
+	case scheduleWeekdays:
+		for _, d := range s.Weekdays {
+			if int(day.Weekday()) == d {
+				return true
+			}
+		}
+		return false
+	case scheduleInterval:
+		start, err := time.Parse(dateLayout, s.StartDate)
+		if err != nil || s.Interval < 1 {
+			return true
+		}
+		if day.Before(start) {
+			return false
+		}
+		return daysBetween(start, day)%s.Interval == 0
+	}
+	return true
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24 + 0.5)
+}
+
+// Número de dias devidos em [from, to], ambos meia-noite UTC
+func (s Schedule) dueDays(from, to time.Time) int {
+	count := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if s.isDue(day) {
+			count++
+		}
+	}
+	return count
+}
+
+// Unidade de calendário do período das agendas por frequência
+func (s Schedule) periodUnit() string {
+	if s.Type == scheduleMonthly {
+		return unitMonth
+	}
+	return unitWeek
+}
+
+// Streak atual e maior streak a partir dos dias distintos de conclusão
+// (do mais recente para o mais antigo). O dia ou período corrente ainda
+// não cumprido não quebra o streak, nem os dias dispensados (excused).
+func scheduleStreaks(s Schedule, dates []time.Time, cal Calendar, excused excusedFunc) (int, int) {
+	today := cal.today()
+	if !s.isFrequency() {
+		return dueDayStreaks(dates, today, func(day time.Time) bool {
+			return s.isDue(day) && !excused.has(day)
+		})
+	}
+	if len(dates) == 0 {
+		return 0, 0
+	}
+	done := completedDays(dates)
+
+	// Um passo por período, cumprido se atingiu a frequência. Dias
+	// dispensados não contam e limitam a frequência exigida aos dias que
+	// restam; um período todo dispensado não é um passo.
+	var steps []bool
+	start, next := cal.bounds(s.periodUnit(), dates[len(dates)-1])
+	for ; !start.After(today); start, next = cal.bounds(s.periodUnit(), next) {
+		count, available := 0, 0
+		for day := start; day.Before(next); day = day.AddDate(0, 0, 1) {
+			if excused.has(day) {
+				continue
+			}
+			available++
+			if done[day] {
+				count++
+			}
+		}
+		if available > 0 {
+			steps = append(steps, count >= min(s.Times, available))
+		}
+	}
+	return stepStreaks(steps, true)
+}
+
+// Streaks contando só os dias em que isDue é verdadeiro; dias não devidos
+// não somam nem quebram a sequência
+func dueDayStreaks(dates []time.Time, today time.Time, isDue func(time.Time) bool) (int, int) {
+	if len(dates) == 0 {
+		return 0, 0
+	}
+	done := completedDays(dates)
+
+	var steps []bool
+	for day := dates[len(dates)-1]; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if isDue(day) {
+			steps = append(steps, done[day])
+		}
+	}
+	return stepStreaks(steps, isDue(today))
+}
+
+func completedDays(dates []time.Time) map[time.Time]bool {
+	done := make(map[time.Time]bool, len(dates))
+	for _, d := range dates {
+		done[d] = true
+	}
+	return done
+}
+
+// Maior sequência de passos cumpridos e a sequência que termina no último
+// passo; se open, o último passo ainda está em andamento e, se não foi
+// cumprido, é ignorado
+func stepStreaks(steps []bool, open bool) (int, int) {
+	longest, run := 0, 0
+	for _, ok := range steps {
+		if ok {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	current := 0
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i] {
+			current++
+		} else if i != len(steps)-1 || !open {
+			break
+		}
+	}
+	return current, longest
+}
+
+// Conclusões esperadas e efetivas em [from, to], para a taxa de conclusão,
+// sem os dias dispensados. Nos tipos por frequência a meta de cada período
+// é proporcional aos dias do período que caem na janela.
+func (s Schedule) completion(dates []time.Time, from, to time.Time, cal Calendar, excused excusedFunc) (done, expected float64) {
+	doneDays := map[time.Time]bool{}
+	for _, d := range dates {
+		if !d.Before(from) && !d.After(to) {
+			doneDays[d] = true
+		}
+	}
+
+	if !s.isFrequency() {
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			if s.isDue(day) && !excused.has(day) {
+				expected++
+				if doneDays[day] {
+					done++
+				}
+			}
+		}
+		return done, expected
+	}
+
+	start, next := cal.bounds(s.periodUnit(), from)
+	for ; !start.After(to); start, next = cal.bounds(s.periodUnit(), next) {
+		end := next.AddDate(0, 0, -1)
+		periodDays, inWindow, count := 0, 0, 0
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			if excused.has(day) {
+				continue
+			}
+			periodDays++
+			if day.Before(from) || day.After(to) {
+				continue
+			}
+			inWindow++
+			if doneDays[day] {
+				count++
+			}
+		}
+		if periodDays == 0 {
+			continue
+		}
+		target := float64(min(s.Times, periodDays)) * float64(inWindow) / float64(periodDays)
+		expected += target
+		if float64(count) < target {
+			done += float64(count)
+		} else {
+			done += target
+		}
+	}
+	return done, expected
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Dias dispensados: um dia pulado num hábito (doença, imprevisto), pausas
+// por intervalo para todos ou alguns hábitos (modo férias) e congelamentos
+// de streak, ganhos a cada streakFreezeEvery dias seguidos cumpridos. Esses
+// dias não quebram nem estendem streaks e ficam fora dos denominadores da
+// taxa de conclusão.
+
+const (
+	skipSkip   = "skip"
+	skipFreeze = "freeze"
+
+	streakFreezeEvery = 7 // dias (ou períodos) seguidos por congelamento ganho
+	maxStreakFreezes  = 3 // congelamentos disponíveis ao mesmo tempo
+	maxPauseDays      = 366
+	skipGraceDays     = 2  // dias passados que ainda podem ser pulados
+	maxSkipAheadDays  = 30 // até quantos dias à frente se pode pular
+	maxSkipsPerMonth  = 4  // dias pulados (kind skip) por hábito e mês
+)
+
+type HabitSkip struct {
+	HabitID   int       `json:"habit_id"`
+	Date      string    `json:"date"` // YYYY-MM-DD, dia local
+	Kind      string    `json:"kind"` // "skip" ou "freeze"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Pause struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	StartDate string    `json:"start_date"` // YYYY-MM-DD, inclusive
+	EndDate   string    `json:"end_date"`
+	AllHabits bool      `json:"all_habits"`
+	HabitIDs  []int     `json:"habit_ids"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type StreakFreezes struct {
+	Available int `json:"available"`
+	Earned    int `json:"earned"`
+	Used      int `json:"used"`
+	Max       int `json:"max"`
+	Every     int `json:"every"` // streak necessário para ganhar um
+}
+
+// Se o dia (meia-noite UTC) está dispensado; nil dispensa nenhum dia
+type excusedFunc func(day time.Time) bool
+
+func (f excusedFunc) has(day time.Time) bool {
+	return f != nil && f(day)
+}
+
+func (p Pause) covers(habitID int, day time.Time) bool {
+	start, err1 := time.Parse(dateLayout, p.StartDate)
+	end, err2 := time.Parse(dateLayout, p.EndDate)
+	if err1 != nil || err2 != nil || day.Before(start) || day.After(end) {
+		return false
+	}
+	if p.AllHabits {
+		return true
+	}
+	for _, id := range p.HabitIDs {
+		if id == habitID {
+			return true
+		}
+	}
+	return false
+}
+
+// Dias pulados, congelados e pausas de um usuário
+type Excuses struct {
+	days   map[int]map[time.Time]bool
+	pauses []Pause
+}
+
+// Em caso de erro nenhum dia é dispensado
+func userExcuses(userID int) *Excuses {
+	e := &Excuses{days: map[int]map[time.Time]bool{}}
+	skips, err := store.ListUserSkips(userID)
+	if err != nil {
+		log.Printf("Error loading skipped days: %v", err)
+	}
+	for _, skip := range skips {
+		day, err := time.Parse(dateLayout, skip.Date)
+		if err != nil {
+			continue
+		}
+		if e.days[skip.HabitID] == nil {
+			e.days[skip.HabitID] = map[time.Time]bool{}
+		}
+		e.days[skip.HabitID][day] = true
+	}
+
+	if e.pauses, err = store.ListPauses(userID); err != nil {
+		log.Printf("Error loading pauses: %v", err)
+	}
+	return e
+}
+
+func (e *Excuses) habit(habitID int) excusedFunc {
+	return func(day time.Time) bool {
+		if e.days[habitID][day] {
+			return true
+		}
+		for _, pause := range e.pauses {
+			if pause.covers(habitID, day) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func streakFreezes(userID int) (StreakFreezes, error) {
+	freezes := StreakFreezes{Max: maxStreakFreezes, Every: streakFreezeEvery}
+	earned, used, err := store.StreakFreezeCounts(userID)
+	if err != nil {
+		return freezes, err
+	}
+	freezes.Earned, freezes.Used = earned, used
+	freezes.Available = earned - used
+	if freezes.Available < 0 {
+		freezes.Available = 0
+	}
+	return freezes, nil
+}
+
+// Um congelamento a cada streakFreezeEvery de streak, se o usuário ainda
+// não tem o máximo; cada hábito rende no máximo um por dia
+func awardStreakFreeze(habit *Habit, streak int, cal Calendar) {
+	if habit.isQuit() || streak == 0 || streak%streakFreezeEvery != 0 {
+		return
+	}
+	freezes, err := streakFreezes(habit.UserID)
+	if err != nil || freezes.Available >= maxStreakFreezes {
+		return
+	}
+	day := cal.today().Format(dateLayout)
+	if err := store.AwardStreakFreeze(habit.UserID, habit.ID, day, streak); err != nil && !errors.Is(err, ErrDuplicate) {
+		log.Printf("Error awarding streak freeze: %v", err)
+	}
+}
+
+func getHabitSkips(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	skips, err := store.ListSkips(habit.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if skips == nil {
+		skips = []HabitSkip{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(skips)
+}
+
+// Pula um dia do hábito. Kind "skip" vale de skipGraceDays atrás até
+// maxSkipAheadDays à frente, no máximo maxSkipsPerMonth por mês; "freeze"
+// gasta um congelamento e só vale para hoje ou dias passados
+func createHabitSkip(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var skip HabitSkip
+	if err := json.NewDecoder(r.Body).Decode(&skip); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	day, err := time.Parse(dateLayout, skip.Date)
+	if err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if skip.Kind == "" {
+		skip.Kind = skipSkip
+	}
+
+	today := userCalendar(habit.UserID).today()
+	switch skip.Kind {
+	case skipSkip:
+		if day.Before(today.AddDate(0, 0, -skipGraceDays)) || day.After(today.AddDate(0, 0, maxSkipAheadDays)) {
+			http.Error(w, fmt.Sprintf("Only days from %d days ago to %d days ahead can be skipped", skipGraceDays, maxSkipAheadDays), http.StatusBadRequest)
+			return
+		}
+	case skipFreeze:
+		if day.After(today) {
+			http.Error(w, "Only today or past days can be frozen", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "kind must be skip or freeze", http.StatusBadRequest)
+		return
+	}
+
+	skip.HabitID = habit.ID
+	skip.Date = day.Format(dateLayout)
+	if err := store.CreateSkip(habit.UserID, &skip); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			http.Error(w, "Day already skipped", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrLimit) {
+			if skip.Kind == skipFreeze {
+				http.Error(w, "No streak freezes available", http.StatusConflict)
+			} else {
+				http.Error(w, fmt.Sprintf("At most %d days can be skipped per month", maxSkipsPerMonth), http.StatusConflict)
+			}
+			return
+		}
+		http.Error(w, "Error skipping day", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(skip)
+}
+
+// Desfaz o dia pulado; um congelamento desfeito volta a ficar disponível
+func deleteHabitSkip(w http.ResponseWriter, r *http.Request) {
+	habit, ok := habitFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := store.DeleteSkip(habit.ID, mux.Vars(r)["date"]); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Skipped day not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting skipped day", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getPauses(w http.ResponseWriter, r *http.Request) {
+	pauses, err := store.ListPauses(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if pauses == nil {
+		pauses = []Pause{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pauses)
+}
+
+// Modo férias: pausa todos os hábitos ou os de habit_ids num intervalo
+func createPause(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	var pause Pause
+	if err := json.NewDecoder(r.Body).Decode(&pause); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	start, err := time.Parse(dateLayout, pause.StartDate)
+	if err != nil {
+		http.Error(w, "start_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	end, err := time.Parse(dateLayout, pause.EndDate)
+	if err != nil {
+		http.Error(w, "end_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "end_date must not be before start_date", http.StatusBadRequest)
+		return
+	}
+	// Como nos dias pulados, dias passados além da tolerância já foram avaliados
+	if start.Before(pauseCutoff(userID)) {
+		http.Error(w, fmt.Sprintf("A pause can start at most %d days ago", skipGraceDays), http.StatusBadRequest)
+		return
+	}
+	if daysBetween(start, end) >= maxPauseDays {
+		http.Error(w, fmt.Sprintf("A pause can last at most %d days", maxPauseDays), http.StatusBadRequest)
+		return
+	}
+	if len(pause.Reason) > 255 {
+		http.Error(w, "Reason must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	// Sem habit_ids, a pausa vale para todos os hábitos
+	pause.AllHabits = len(pause.HabitIDs) == 0
+	seen := map[int]bool{}
+	habitIDs := []int{}
+	for _, habitID := range pause.HabitIDs {
+		if seen[habitID] {
+			continue
+		}
+		if _, err := store.GetHabit(userID, habitID); err != nil {
+			http.Error(w, fmt.Sprintf("Habit %d not found", habitID), http.StatusBadRequest)
+			return
+		}
+		seen[habitID] = true
+		habitIDs = append(habitIDs, habitID)
+	}
+	pause.HabitIDs = habitIDs
+
+	pause.UserID = userID
+	if err := store.CreatePause(&pause); err != nil {
+		http.Error(w, "Error creating pause", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pause)
+}
+
+func deletePause(w http.ResponseWriter, r *http.Request) {
+	pauseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid pause ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := getUserID(r)
+	pauses, err := store.ListPauses(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	var pause *Pause
+	for i := range pauses {
+		if pauses[i].ID == pauseID {
+			pause = &pauses[i]
+		}
+	}
+	if pause == nil {
+		http.Error(w, "Pause not found", http.StatusNotFound)
+		return
+	}
+
+	// Dias antes da tolerância já foram avaliados (streaks, metas, resumos)
+	// e continuam dispensados: a pausa que começou antes deles só é
+	// encerrada, e a que terminou antes deles fica como está
+	cutoff := pauseCutoff(userID)
+	start, _ := time.Parse(dateLayout, pause.StartDate)
+	end, _ := time.Parse(dateLayout, pause.EndDate)
+	switch {
+	case !start.Before(cutoff):
+		err = store.DeletePause(userID, pauseID)
+	case end.Before(cutoff):
+		http.Error(w, "A pause that has already ended cannot be removed", http.StatusConflict)
+		return
+	default:
+		err = store.EndPause(userID, pauseID, cutoff.AddDate(0, 0, -1).Format(dateLayout))
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Pause not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting pause", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Primeiro dia que uma pausa ainda pode cobrir ou deixar de cobrir
+func pauseCutoff(userID int) time.Time {
+	return userCalendar(userID).today().AddDate(0, 0, -skipGraceDays)
+}
+
+func getStreakFreezes(w http.ResponseWriter, r *http.Request) {
+	freezes, err := streakFreezes(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(freezes)
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Camada de persistência. Os handlers só conversam com Store; o SQL fica
+// em sqlStore e as diferenças entre bancos ficam no dialect de cada um
+// (store_mysql.go e store_sqlite.go).
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("duplicate record")
+	ErrLimit     = errors.New("limit reached")
+)
+
+type Store interface {
+	UserStore
+	SessionStore
+	TwoFactorStore
+	AccessTokenStore
+	RateLimitStore
+	AuditStore
+	ExportStore
+	HabitStore
+	TagStore
+	HabitViewStore
+	EntryStore
+	GoalStore
+	SkipStore
+	ReminderStore
+	PushStore
+	DigestStore
+	FriendStore
+	FeedStore
+	GroupStore
+	ChallengeStore
+	AnalyticsStore
+	Migrator
+	Close() error
+}
+
+// Migrações do schema (migrate.go)
+type Migrator interface {
+	MigrateUp() ([]migration, error)
+	MigrateDown(steps int) ([]migration, error)
+	MigrationStatus() ([]migrationStatus, error)
+}
+
+type UserStore interface {
+	CreateUser(user *User, passwordHash string) error
+	GetUser(userID int) (*User, error)
+	GetUserByEmail(email string) (*User, string, error)
+	GetPasswordHash(userID int) (string, error)
+	UpdatePassword(userID int, passwordHash string) error
+	MarkEmailVerified(userID int, email string) error
+	UpdateProfile(user *User) error
+	UpdateAvatar(userID int, avatarPath string) error
+	UpdateEmail(userID int, email string) error
+	DeleteUser(userID int) error
+}
+
+type TwoFactorStore interface {
+	GetTOTP(userID int) (secret string, enabled bool, err error)
+	SetPendingTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int, recoveryCodeHashes []string) error
+	DisableTOTP(userID int) error
+	UseTOTPStep(userID int, step int64) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) error
+}
+
+type SessionStore interface {
+	CreateSession(session *Session, refreshHash string) error
+	GetSession(sessionID int) (*Session, error)
+	FindSessionByRefreshHash(hash string) (*Session, bool, error)
+	RotateSessionToken(sessionID int, oldHash, newHash string, expiresAt time.Time) error
+	TouchSession(sessionID int, at time.Time) error
+	RevokeSession(userID, sessionID int) error
+	RevokeUserSessions(userID int) error
+	RevokeOtherSessions(userID, keepSessionID int) error
+	ListSessions(userID int) ([]Session, error)
+}
+
+type AccessTokenStore interface {
+	CreateAccessToken(token *AccessToken, tokenHash string) error
+	FindAccessToken(tokenHash string) (*AccessToken, error)
+	ListAccessTokens(userID int) ([]AccessToken, error)
+	RevokeAccessToken(userID, tokenID int) error
+	TouchAccessToken(tokenID int, at time.Time) error
+}
+
+// Contadores de janela fixa do rate limiting (ratelimit.go)
+type RateLimitStore interface {
+	// Soma um ao contador; a janela começa no primeiro hit após a anterior expirar
+	HitRateLimit(key string, window time.Duration) (hits int, resetAt time.Time, err error)
+	// Valor atual sem incrementar; zero se não houver janela ativa
+	PeekRateLimit(key string) (hits int, resetAt time.Time, err error)
+	ClearRateLimit(key string) error
+}
+
+type AuditStore interface {
+	RecordAuditEvent(event *AuditEvent) error
+}
+
+type ExportStore interface {
+	ExportUserData(userID int) (*ExportArchive, error)
+	// source identifica a conta de origem do arquivo (hash de archive.Source)
+	ImportArchive(userID int, source string, archive *ExportArchive) (*ImportResult, error)
+}
+
+// Hábitos removidos (deleted_at) ficam fora de todas as consultas, exceto
+// ListDeletedHabits, até serem restaurados ou apagados de vez
+type HabitStore interface {
+	// Ativos e arquivados, na ordem definida pelo usuário
+	ListHabits(userID int) ([]Habit, error)
+	GetHabit(userID, habitID int) (*Habit, error)
+	CreateHabit(habit *Habit) error
+	// Tags nil mantém as etiquetas do hábito
+	UpdateHabit(habit *Habit) error
+	// Grava a posição de cada hábito na lista; ErrNotFound se algum não é do usuário
+	ReorderHabits(userID int, habitIDs []int) error
+	ArchiveHabit(userID, habitID int, archived bool) error
+	// Remoção reversível
+	DeleteHabit(userID, habitID int) error
+	ListDeletedHabits(userID int) ([]Habit, error)
+	// ErrNotFound se o hábito não foi removido depois de deletedSince
+	RestoreHabit(userID, habitID int, deletedSince time.Time) error
+	PurgeHabit(userID, habitID int) error
+	// Apaga os hábitos removidos antes de deletedBefore
+	PurgeDeletedHabits(deletedBefore time.Time) (int64, error)
+	SetGoalReset(habitID int, at time.Time) error
+	// Hábitos ativos com meta por período (count, weekly...), de todos os usuários
+	ListGoalHabits() ([]Habit, error)
+}
+
+// Etiquetas; as de cada hábito são gravadas com o hábito (Habit.Tags)
+type TagStore interface {
+	ListTags(userID int) ([]Tag, error)
+	// ErrDuplicate se o usuário já tem uma etiqueta com o nome
+	RenameTag(userID, tagID int, name string) error
+	DeleteTag(userID, tagID int) error
+}
+
+// Filtros salvos da lista de hábitos
+type HabitViewStore interface {
+	ListHabitViews(userID int) ([]HabitView, error)
+	GetHabitView(userID, viewID int) (*HabitView, error)
+	// ErrDuplicate se o usuário já tem um filtro com o nome
+	CreateHabitView(view *HabitView) error
+	UpdateHabitView(view *HabitView) error
+	DeleteHabitView(userID, viewID int) error
+}
+
+// Criação, edição e remoção de entradas gravam também o histórico
+// (habit_entry_changes)
+type EntryStore interface {
+	ListEntries(habitID int) ([]HabitEntry, error)
+	GetEntry(habitID, entryID int) (*HabitEntry, error)
+	CreateEntry(entry *HabitEntry) error
+	// Cria todas as entradas numa transação
+	CreateEntries(entries []HabitEntry) error
+	UpdateEntry(entry *HabitEntry) error
+	DeleteEntry(habitID, entryID int) error
+	// Histórico do hábito, do mais recente para o mais antigo; entryID zero
+	// lista todas as entradas
+	ListEntryChanges(habitID, entryID int) ([]EntryChange, error)
+	// Alterações nas entradas dos hábitos do usuário com o nome dado
+	// (sem diferenciar maiúsculas) cuja conclusão, antiga ou nova, cai em
+	// [from, to]
+	ListUserEntryChanges(userID int, habitName string, from, to time.Time) ([]EntryChange, error)
+	// Conta entradas com completed_at em [from, to]; zero em from/to não limita
+	CountEntries(habitID int, from, to time.Time) (int, error)
+	EntryTimes(habitID int) ([]time.Time, error)
+	ListUserEntries(userID int, since time.Time) ([]HabitEntry, error)
+}
+
+type GoalStore interface {
+	ListGoalCompletions(habitID int) ([]GoalCompletion, error)
+	CreateGoalCompletion(completion *GoalCompletion) error
+	CountGoalCompletions(habitID int, periodStart, periodEnd time.Time) (int, error)
+	DeleteGoalCompletions(habitID int, periodStart, periodEnd time.Time) (int64, error)
+}
+
+// Dias pulados, pausas e congelamentos de streak (skips.go)
+type SkipStore interface {
+	ListSkips(habitID int) ([]HabitSkip, error)
+	// Dias pulados e congelados de todos os hábitos do usuário
+	ListUserSkips(userID int) ([]HabitSkip, error)
+	// ErrDuplicate se o dia já foi pulado ou congelado; ErrLimit se o
+	// usuário não tem congelamento disponível (freeze) ou o hábito já tem
+	// maxSkipsPerMonth dias pulados no mês (skip)
+	CreateSkip(userID int, skip *HabitSkip) error
+	DeleteSkip(habitID int, day string) error
+	ListPauses(userID int) ([]Pause, error)
+	CreatePause(pause *Pause) error
+	DeletePause(userID, pauseID int) error
+	EndPause(userID, pauseID int, endDate string) error
+	// ErrDuplicate se o hábito já rendeu um congelamento no dia
+	AwardStreakFreeze(userID, habitID int, day string, streak int) error
+	// Congelamentos ganhos e usados pelo usuário
+	StreakFreezeCounts(userID int) (earned, used int, err error)
+}
+
+// Lembretes do agendador (reminders.go)
+type ReminderStore interface {
+	// Hábitos ativos com lembrete ligado, de todos os usuários
+	ListReminderHabits() ([]Habit, error)
+	// Reserva o envio do lembrete do dia (YYYY-MM-DD) e horário (HH:MM);
+	// ErrDuplicate se já foi enviado
+	ClaimReminder(habitID int, day, at string) error
+	// Desfaz a reserva de um envio que falhou
+	ReleaseReminder(habitID int, day, at string) error
+	// Apaga os registros de dias anteriores a before
+	PruneReminderDeliveries(before string) (int64, error)
+	// Envio do lembrete; ErrNotFound se ainda não foi enviado
+	GetReminderDelivery(habitID int, day, at string) (*ReminderDelivery, error)
+	// Último lembrete enviado do hábito no dia
+	LatestReminderDelivery(habitID int, day string) (*ReminderDelivery, error)
+	// Agenda o reenvio do lembrete (until nil cancela o adiamento)
+	SnoozeReminder(delivery *ReminderDelivery) error
+	// Adiamentos vencidos até now
+	ListDueSnoozes(now time.Time) ([]ReminderDelivery, error)
+	// Reserva o reenvio de um adiamento vencido; ErrNotFound se outra
+	// instância já o reservou
+	ClaimSnooze(habitID int, day, at string, now time.Time) error
+}
+
+// Web Push (push.go)
+type PushStore interface {
+	SavePushSubscription(sub *PushSubscription) error
+	ListPushSubscriptions(userID int) ([]PushSubscription, error)
+	DeletePushSubscription(userID, subscriptionID int) error
+	// Remove a inscrição que o serviço de push informou como expirada
+	DeletePushEndpoint(endpoint string) error
+	TouchPushSubscription(subscriptionID int, at time.Time) error
+	// ErrNotFound se as chaves ainda não foram geradas
+	GetVAPIDKeys() (publicKey, privateKey string, err error)
+	// ErrDuplicate se outra instância gravou as chaves antes
+	SaveVAPIDKeys(publicKey, privateKey string) error
+}
+
+// Resumo por e-mail (digest.go)
+type DigestStore interface {
+	// Usuários com resumo daily ou weekly e e-mail verificado
+	ListDigestUsers() ([]User, error)
+	// Reserva o envio do resumo do período que começa em periodStart
+	// (YYYY-MM-DD); ErrDuplicate se já foi enviado
+	ClaimDigest(userID int, frequency, periodStart string) error
+	// Desfaz a reserva de um envio que falhou
+	ReleaseDigest(userID int, frequency, periodStart string) error
+	// Apaga os registros de períodos anteriores a before
+	PruneDigestDeliveries(before string) (int64, error)
+	// Atividades dos amigos do usuário criadas em [from, to], da mais
+	// recente para a mais antiga
+	ListFriendActivity(userID int, from, to time.Time, limit int) ([]ActivityFeed, error)
+}
+
+type FriendStore interface {
+	GetFriendship(id int) (*Friendship, error)
+	FindFriendship(userID, otherID int) (*Friendship, error)
+	CreateFriendship(friendship *Friendship) error
+	UpdateFriendshipStatus(id int, status string) error
+	DeleteFriendship(id int) error
+	ListFriends(userID int) ([]Friendship, error)
+	ListFriendRequests(userID int) ([]PendingFriendRequest, error)
+}
+
+type FeedStore interface {
+	CreateActivity(activity *ActivityFeed) error
+	GetActivity(id int) (*ActivityFeed, error)
+	ListFeed(userID, limit, offset int) ([]ActivityFeed, error)
+	SetReaction(activityID, userID int, reactionType string) error
+	DeleteReaction(activityID, userID int) error
+	CreateComment(comment *ActivityComment) error
+	ListComments(activityID int) ([]ActivityComment, error)
+}
+
+type GroupStore interface {
+	ListGroups(userID int) ([]Group, error)
+	GetGroup(userID, groupID int) (*Group, error)
+	CreateGroup(group *Group) error
+	UpdateGroup(group *Group) error
+	DeleteGroup(groupID int) error
+	GetMemberRole(groupID, userID int) (string, error)
+	AddGroupMember(groupID, userID int, role string) error
+	RemoveGroupMember(groupID, userID int) error
+	ListGroupMembers(groupID int) ([]GroupMember, error)
+}
+
+type ChallengeStore interface {
+	ListChallenges(userID int) ([]Challenge, error)
+	ListGroupChallenges(userID, groupID int) ([]Challenge, error)
+	GetChallenge(userID, challengeID int) (*Challenge, error)
+	CreateChallenge(challenge *Challenge) error
+	UpdateChallenge(challenge *Challenge) error
+	DeleteChallenge(challengeID int) error
+	HasCompletedParticipant(challengeID int) (bool, error)
+	GetParticipant(challengeID, userID int) (*ChallengeParticipant, error)
+	AddParticipant(challengeID, userID int) error
+	RemoveParticipant(challengeID, userID int) error
+	ListParticipants(challengeID int) ([]ChallengeParticipant, error)
+	UpdateParticipantProgress(participant *ChallengeParticipant) error
+}
+
+type AnalyticsStore interface {
+	CountHabits(userID int) (int, error)
+	CountHabitsWithEntriesSince(userID int, since time.Time) (int, error)
+	ListHabitTrends(userID int, since, weekSince time.Time) ([]HabitTrend, error)
+	ListCategoryStats(userID int, since time.Time) ([]CategoryStats, error)
+	ListTagStats(userID int, since time.Time) ([]CategoryStats, error)
+}
+
+// Solicitação de amizade pendente, recebida ou enviada pelo usuário
+type PendingFriendRequest struct {
+	Friendship
+	Type string // "received" ou "sent"
+}
+
+// Diferenças de SQL entre os bancos suportados
+type dialect interface {
+	// Diretório das migrações em migrations/
+	name() string
+	// INSERT que atualiza as colunas update quando a chave única keys já existe
+	upsert(table string, cols, keys, update []string) string
+	isDuplicate(err error) bool
+	// Converte argumentos para o formato que o driver grava
+	bindArg(arg interface{}) interface{}
+}
+
+func openStore(driver, dsn string) (Store, error) {
+	switch driver {
+	case "mysql":
+		return newMySQLStore(dsn)
+	case "sqlite", "sqlite3":
+		return newSQLiteStore(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Executa ou consulta através de *sql.DB ou *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) bind(args []interface{}) []interface{} {
+	bound := make([]interface{}, len(args))
+	for i, arg := range args {
+		bound[i] = s.dialect.bindArg(arg)
+	}
+	return bound
+}
+
+func (s *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.execOn(s.db, query, args...)
+}
+
+func (s *sqlStore) execOn(ex sqlExecutor, query string, args ...interface{}) (sql.Result, error) {
+	result, err := ex.Exec(query, s.bind(args)...)
+	if err != nil && s.dialect.isDuplicate(err) {
+		return nil, fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return result, err
+}
+
+func (s *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(query, s.bind(args)...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(query, s.bind(args)...)
+}
+
+// Executa um INSERT e devolve o id gerado
+func (s *sqlStore) insert(ex sqlExecutor, query string, args ...interface{}) (int, error) {
+	result, err := s.execOn(ex, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// Converte "nenhuma linha afetada" em ErrNotFound
+func requireAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *sqlStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Consultas agregadas usadas pelo analytics
+
+// Hábitos não removidos, inclusive os arquivados, cujo histórico continua
+// no analytics; é o mesmo conjunto de CountHabitsWithEntriesSince
+func (s *sqlStore) CountHabits(userID int) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM habits WHERE user_id = ? AND deleted_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) CountHabitsWithEntriesSince(userID int, since time.Time) (int, error) {
+	var count int
+	err := s.queryRow(`
+		SELECT COUNT(DISTINCT h.id)
+		FROM habits h
+		JOIN habit_entries he ON h.id = he.habit_id
+		WHERE h.user_id = ? AND h.deleted_at IS NULL AND he.completed_at >= ?
+	`, userID, since).Scan(&count)
+	return count, err
+}
+
+// Hábitos com mais entradas desde since, inclusive os arquivados, com a
+// contagem da última semana e as somas dos valores na unidade de cada hábito
+func (s *sqlStore) ListHabitTrends(userID int, since, weekSince time.Time) ([]HabitTrend, error) {
+	query := `
+		SELECT h.id, h.name, h.category, h.polarity, h.unit,
+			   COUNT(he.id) as total_count,
+			   COUNT(CASE WHEN he.completed_at >= ? THEN 1 END) as weekly_count,
+			   COALESCE(SUM(he.value), 0) as total_value,
+			   COALESCE(SUM(CASE WHEN he.completed_at >= ? THEN he.value ELSE 0 END), 0) as weekly_value
+		FROM habits h
+		LEFT JOIN habit_entries he ON h.id = he.habit_id AND he.completed_at >= ?
+		WHERE h.user_id = ? AND h.deleted_at IS NULL
+		GROUP BY h.id, h.name, h.category, h.polarity, h.unit
+		ORDER BY total_count DESC
+		LIMIT 10
+	`
+	rows, err := s.query(query, weekSince, weekSince, since, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trends []HabitTrend
+	for rows.Next() {
+		var trend HabitTrend
+		var unit sql.NullString
+		err := rows.Scan(&trend.HabitID, &trend.HabitName, &trend.Category, &trend.Polarity, &unit, &trend.TotalCount, &trend.WeeklyCount,
+			&trend.TotalValue, &trend.WeeklyValue)
+		if err != nil {
+			return nil, err
+		}
+		trend.Unit = unit.String
+		trends = append(trends, trend)
+	}
+	return trends, rows.Err()
+}
+
+// Quantidade de hábitos e entradas desde since, por categoria; recaídas
+// de hábitos negativos não contam como conclusões
+func (s *sqlStore) ListCategoryStats(userID int, since time.Time) ([]CategoryStats, error) {
+	query := `
+		SELECT
+			h.category,
+			COUNT(DISTINCT h.id) as habit_count,
+			COUNT(he.id) as completed
+		FROM habits h
+		LEFT JOIN habit_entries he ON h.id = he.habit_id AND he.completed_at >= ?
+		WHERE h.user_id = ? AND h.is_active = 1 AND h.deleted_at IS NULL AND h.polarity <> 'quit'
+		GROUP BY h.category
+		ORDER BY completed DESC
+	`
+	return s.listCategoryStats(query, since, userID)
+}
+
+// Como ListCategoryStats, agrupando pelas etiquetas; um hábito com várias
+// etiquetas conta em cada uma e os sem etiqueta ficam de fora
+func (s *sqlStore) ListTagStats(userID int, since time.Time) ([]CategoryStats, error) {
+	query := `
+		SELECT
+			t.name,
+			COUNT(DISTINCT h.id) as habit_count,
+			COUNT(he.id) as completed
+		FROM tags t
+		JOIN habit_tags ht ON ht.tag_id = t.id
+		JOIN habits h ON h.id = ht.habit_id
+		LEFT JOIN habit_entries he ON h.id = he.habit_id AND he.completed_at >= ?
+		WHERE t.user_id = ? AND h.is_active = 1 AND h.deleted_at IS NULL AND h.polarity <> 'quit'
+		GROUP BY t.name
+		ORDER BY completed DESC
+	`
+	return s.listCategoryStats(query, since, userID)
+}
+
+func (s *sqlStore) listCategoryStats(query string, args ...interface{}) ([]CategoryStats, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []CategoryStats
+	for rows.Next() {
+		var category CategoryStats
+		if err := rows.Scan(&category.Category, &category.HabitCount, &category.Completed); err != nil {
+			return nil, err
+		}
+		stats = append(stats, category)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Sessões de login e refresh tokens
+
+const sessionColumns = "id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at"
+
+func scanSession(row rowScanner) (*Session, error) {
+	var session Session
+	var userAgent, ip sql.NullString
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &userAgent, &ip, &session.CreatedAt,
+		&session.LastUsedAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	session.UserAgent = userAgent.String
+	session.IP = ip.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+func (s *sqlStore) CreateSession(session *Session, refreshHash string) error {
+	now := time.Now()
+	id, err := s.insert(s.db, `INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, refreshHash, session.UserAgent, session.IP, now, now, session.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	session.ID = id
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	return nil
+}
+
+func (s *sqlStore) GetSession(sessionID int) (*Session, error) {
+	session, err := scanSession(s.queryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", sessionID))
+	return session, notFound(err)
+}
+
+// Busca a sessão pelo refresh token atual ou pelo anterior; reused indica
+// que o token já tinha sido trocado (possível roubo)
+func (s *sqlStore) FindSessionByRefreshHash(hash string) (*Session, bool, error) {
+	session, err := scanSession(s.queryRow("SELECT "+sessionColumns+" FROM sessions WHERE refresh_token_hash = ?", hash))
+	if err == nil {
+		return session, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	session, err = scanSession(s.queryRow("SELECT "+sessionColumns+" FROM sessions WHERE previous_token_hash = ?", hash))
+	if err != nil {
+		return nil, false, notFound(err)
+	}
+	return session, true, nil
+}
+
+// Troca o refresh token; falha com ErrNotFound se outro pedido já trocou
+func (s *sqlStore) RotateSessionToken(sessionID int, oldHash, newHash string, expiresAt time.Time) error {
+	return requireAffected(s.exec(`UPDATE sessions
+		SET previous_token_hash = refresh_token_hash, refresh_token_hash = ?, last_used_at = ?, expires_at = ?
+		WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL`,
+		newHash, time.Now(), expiresAt, sessionID, oldHash))
+}
+
+func (s *sqlStore) TouchSession(sessionID int, at time.Time) error {
+	_, err := s.exec("UPDATE sessions SET last_used_at = ? WHERE id = ?", at, sessionID)
+	return err
+}
+
+func (s *sqlStore) RevokeSession(userID, sessionID int) error {
+	return requireAffected(s.exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), sessionID, userID))
+}
+
+func (s *sqlStore) RevokeUserSessions(userID int) error {
+	_, err := s.exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), userID)
+	return err
+}
+
+// Revoga todas as sessões do usuário menos a atual
+func (s *sqlStore) RevokeOtherSessions(userID, keepSessionID int) error {
+	_, err := s.exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		time.Now(), userID, keepSessionID)
+	return err
+}
+
+// Sessões não revogadas e não expiradas, da mais recente para a mais antiga
+func (s *sqlStore) ListSessions(userID int) ([]Session, error) {
+	rows, err := s.query("SELECT "+sessionColumns+` FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// Segundo fator (TOTP) e códigos de recuperação
+
+func (s *sqlStore) GetTOTP(userID int) (string, bool, error) {
+	var secret sql.NullString
+	var enabled sql.NullBool
+	err := s.queryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ?", userID).Scan(&secret, &enabled)
+	if err != nil {
+		return "", false, notFound(err)
+	}
+	return secret.String, enabled.Bool, nil
+}
+
+// Guarda um segredo ainda não confirmado; não sobrescreve um 2FA ativo
+func (s *sqlStore) SetPendingTOTPSecret(userID int, secret string) error {
+	return requireAffected(s.exec(`UPDATE users SET totp_secret = ?, totp_last_step = NULL
+		WHERE id = ? AND (totp_enabled IS NULL OR totp_enabled = ?)`, secret, userID, false))
+}
+
+func (s *sqlStore) EnableTOTP(userID int, recoveryCodeHashes []string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		err := requireAffected(s.execOn(tx, "UPDATE users SET totp_enabled = ? WHERE id = ? AND totp_secret IS NOT NULL", true, userID))
+		if err != nil {
+			return err
+		}
+		return s.replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	})
+}
+
+func (s *sqlStore) DisableTOTP(userID int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		_, err := s.execOn(tx, "UPDATE users SET totp_secret = NULL, totp_enabled = ?, totp_last_step = NULL WHERE id = ?", false, userID)
+		if err != nil {
+			return err
+		}
+		_, err = s.execOn(tx, "DELETE FROM recovery_codes WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+// Registra o passo usado; falha com ErrNotFound se ele (ou um posterior)
+// já foi aceito, o que bloqueia a reutilização do código
+func (s *sqlStore) UseTOTPStep(userID int, step int64) error {
+	return requireAffected(s.exec(`UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`, step, userID, step))
+}
+
+func (s *sqlStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return s.replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (s *sqlStore) replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := s.execOn(tx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := s.execOn(tx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) UseRecoveryCode(userID int, codeHash string) error {
+	return requireAffected(s.exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, codeHash))
+}
+
+// Tokens de acesso pessoal
+
+const accessTokenColumns = "id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at, revoked_at"
+
+func scanAccessToken(row rowScanner) (*AccessToken, error) {
+	var token AccessToken
+	var scopes string
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &scopes, &token.CreatedAt,
+		&lastUsedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = strings.Fields(scopes)
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+func (s *sqlStore) CreateAccessToken(token *AccessToken, tokenHash string) error {
+	now := time.Now()
+	id, err := s.insert(s.db, `INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.UserID, token.Name, tokenHash, token.Prefix, strings.Join(token.Scopes, " "), now, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	token.CreatedAt = now
+	return nil
+}
+
+func (s *sqlStore) FindAccessToken(tokenHash string) (*AccessToken, error) {
+	token, err := scanAccessToken(s.queryRow("SELECT "+accessTokenColumns+" FROM personal_access_tokens WHERE token_hash = ?", tokenHash))
+	return token, notFound(err)
+}
+
+// Tokens não revogados do usuário
+func (s *sqlStore) ListAccessTokens(userID int) ([]AccessToken, error) {
+	rows, err := s.query("SELECT "+accessTokenColumns+` FROM personal_access_tokens
+		WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []AccessToken
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) RevokeAccessToken(userID, tokenID int) error {
+	return requireAffected(s.exec("UPDATE personal_access_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), tokenID, userID))
+}
+
+func (s *sqlStore) TouchAccessToken(tokenID int, at time.Time) error {
+	_, err := s.exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?", at, tokenID)
+	return err
+}
+
+// Rate limiting compartilhado entre instâncias (rate_limit_store = database)
+
+func (s *sqlStore) HitRateLimit(key string, window time.Duration) (int, time.Time, error) {
+	var hits int
+	var resetAt time.Time
+	err := s.withTx(func(tx *sql.Tx) error {
+		now := time.Now()
+		err := requireAffected(s.execOn(tx, "UPDATE rate_limits SET hits = hits + 1 WHERE bucket = ? AND reset_at > ?", key, now))
+		if err == ErrNotFound {
+			_, err = s.execOn(tx, s.dialect.upsert("rate_limits",
+				[]string{"bucket", "hits", "reset_at"}, []string{"bucket"}, []string{"hits", "reset_at"}),
+				key, 1, now.Add(window))
+		}
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow("SELECT hits, reset_at FROM rate_limits WHERE bucket = ?", key).Scan(&hits, &resetAt)
+	})
+	return hits, resetAt, err
+}
+
+func (s *sqlStore) PeekRateLimit(key string) (int, time.Time, error) {
+	var hits int
+	var resetAt time.Time
+	err := s.queryRow("SELECT hits, reset_at FROM rate_limits WHERE bucket = ? AND reset_at > ?", key, time.Now()).Scan(&hits, &resetAt)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	return hits, resetAt, err
+}
+
+func (s *sqlStore) ClearRateLimit(key string) error {
+	_, err := s.exec("DELETE FROM rate_limits WHERE bucket = ?", key)
+	return err
+}
+
+func (s *sqlStore) RecordAuditEvent(event *AuditEvent) error {
+	now := time.Now()
+	id, err := s.insert(s.db, "INSERT INTO audit_log (user_id, event, ip, detail, created_at) VALUES (?, ?, ?, ?, ?)",
+		event.UserID, event.Event, event.IP, event.Detail, now)
+	if err != nil {
+		return err
+	}
+	event.ID = id
+	event.CreatedAt = now
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Resumo por e-mail: destinatários, envios já feitos e atividade dos amigos
+
+func (s *sqlStore) ListDigestUsers() ([]User, error) {
+	rows, err := s.query("SELECT " + userColumns + " FROM users WHERE digest_frequency IN ('daily', 'weekly') AND email_verified_at IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) ClaimDigest(userID int, frequency, periodStart string) error {
+	_, err := s.exec("INSERT INTO digest_deliveries (user_id, frequency, period_start, sent_at) VALUES (?, ?, ?, ?)",
+		userID, frequency, periodStart, time.Now())
+	return err
+}
+
+func (s *sqlStore) ReleaseDigest(userID int, frequency, periodStart string) error {
+	_, err := s.exec("DELETE FROM digest_deliveries WHERE user_id = ? AND frequency = ? AND period_start = ?",
+		userID, frequency, periodStart)
+	return err
+}
+
+func (s *sqlStore) PruneDigestDeliveries(before string) (int64, error) {
+	result, err := s.exec("DELETE FROM digest_deliveries WHERE period_start < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Mesmas regras de visibilidade do feed (ListFeed), sem as atividades do
+// próprio usuário
+func (s *sqlStore) ListFriendActivity(userID int, from, to time.Time, limit int) ([]ActivityFeed, error) {
+	query := `
+		SELECT af.id, af.user_id, af.activity_type, af.habit_id, af.challenge_id, af.metadata, af.visibility, af.created_at,
+			   u.id, u.username, u.display_name,
+			   h.id, h.name, h.icon,
+			   c.id, c.name, c.habit_name
+		FROM activity_feeds af
+		JOIN users u ON u.id = af.user_id
+		LEFT JOIN habits h ON h.id = af.habit_id
+		LEFT JOIN challenges c ON c.id = af.challenge_id
+		WHERE af.user_id IN (
+			SELECT CASE WHEN f.user_id = ? THEN f.friend_id ELSE f.user_id END
+			FROM friendships f
+			WHERE (f.user_id = ? OR f.friend_id = ?) AND f.status = 'accepted'
+		) AND af.visibility IN ('public', 'friends')
+		AND (af.habit_id IS NULL OR (h.visibility != 'private' AND h.deleted_at IS NULL))
+		AND af.created_at >= ? AND af.created_at <= ?
+		ORDER BY af.created_at DESC
+		LIMIT ?
+	`
+	rows, err := s.query(query, userID, userID, userID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []ActivityFeed
+	for rows.Next() {
+		var af ActivityFeed
+		var u User
+		var metadataJSON []byte
+		var displayName sql.NullString
+		var habitID, challengeID sql.NullInt64
+		var habitName, habitIcon, challengeName, challengeHabitName sql.NullString
+
+		err := rows.Scan(&af.ID, &af.UserID, &af.ActivityType, &af.HabitID, &af.ChallengeID, &metadataJSON, &af.Visibility, &af.CreatedAt,
+			&u.ID, &u.Username, &displayName,
+			&habitID, &habitName, &habitIcon,
+			&challengeID, &challengeName, &challengeHabitName)
+		if err != nil {
+			return nil, err
+		}
+		if len(metadataJSON) > 0 {
+			json.Unmarshal(metadataJSON, &af.Metadata)
+		}
+		u.DisplayName = displayName.String
+		af.User = &u
+		if habitID.Valid {
+			af.Habit = &Habit{ID: int(habitID.Int64), Name: habitName.String, Icon: habitIcon.String}
+		}
+		if challengeID.Valid {
+			af.Challenge = &Challenge{ID: int(challengeID.Int64), Name: challengeName.String, HabitName: challengeHabitName.String}
+		}
+		activities = append(activities, af)
+	}
+	return activities, rows.Err()
+}
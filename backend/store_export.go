@@ -0,0 +1,585 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Exportação e importação dos dados do usuário (export.go)
+
+// Tabela de destino de cada tipo de registro importado
+var importKinds = map[string]string{
+	"habit":           "habits",
+	"entry":           "habit_entries",
+	"goal_completion": "goal_completions",
+	"activity":        "activity_feeds",
+	"comment":         "activity_comments",
+	"pause":           "pauses",
+	"freeze_award":    "streak_freeze_awards",
+	"entry_change":    "habit_entry_changes",
+	"view":            "habit_views",
+}
+
+func (s *sqlStore) ExportUserData(userID int) (*ExportArchive, error) {
+	// Listas vazias saem como [] no JSON
+	archive := &ExportArchive{
+		Habits:                  []Habit{},
+		Entries:                 []HabitEntry{},
+		GoalCompletions:         []GoalCompletion{},
+		Activities:              []ActivityFeed{},
+		Comments:                []ExportComment{},
+		Reactions:               []ExportReaction{},
+		Skips:                   []HabitSkip{},
+		Pauses:                  []Pause{},
+		StreakFreezeAwards:      []ExportFreezeAward{},
+		EntryChanges:            []EntryChange{},
+		Views:                   []HabitView{},
+		Friendships:             []ExportFriendship{},
+		GroupMemberships:        []ExportGroupMembership{},
+		ChallengeParticipations: []ExportChallengeParticipation{},
+	}
+
+	habits, err := s.ListHabits(userID)
+	if err != nil {
+		return nil, err
+	}
+	archive.Habits = append(archive.Habits, habits...)
+
+	entries, err := s.ListUserEntries(userID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	archive.Entries = append(archive.Entries, entries...)
+	for _, habit := range habits {
+		completions, err := s.ListGoalCompletions(habit.ID)
+		if err != nil {
+			return nil, err
+		}
+		archive.GoalCompletions = append(archive.GoalCompletions, completions...)
+	}
+
+	if err := s.exportExcuses(userID, archive); err != nil {
+		return nil, err
+	}
+	if err := s.exportEntryChanges(userID, archive); err != nil {
+		return nil, err
+	}
+	views, err := s.ListHabitViews(userID)
+	if err != nil {
+		return nil, err
+	}
+	archive.Views = append(archive.Views, views...)
+
+	if err := s.exportFriendships(userID, archive); err != nil {
+		return nil, err
+	}
+	if err := s.exportActivities(userID, archive); err != nil {
+		return nil, err
+	}
+	if err := s.exportGroups(userID, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// Dias pulados e congelados, pausas e congelamentos ganhos
+func (s *sqlStore) exportExcuses(userID int, archive *ExportArchive) error {
+	skips, err := s.ListUserSkips(userID)
+	if err != nil {
+		return err
+	}
+	archive.Skips = append(archive.Skips, skips...)
+
+	pauses, err := s.ListPauses(userID)
+	if err != nil {
+		return err
+	}
+	archive.Pauses = append(archive.Pauses, pauses...)
+
+	rows, err := s.query("SELECT id, habit_id, day, streak, created_at FROM streak_freeze_awards WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var award ExportFreezeAward
+		var habitID sql.NullInt64
+		if err := rows.Scan(&award.ID, &habitID, &award.Day, &award.Streak, &award.CreatedAt); err != nil {
+			return err
+		}
+		award.HabitID = nullIntPtr(habitID)
+		archive.StreakFreezeAwards = append(archive.StreakFreezeAwards, award)
+	}
+	return rows.Err()
+}
+
+// Histórico das entradas dos hábitos exportados, inclusive das removidas
+func (s *sqlStore) exportEntryChanges(userID int, archive *ExportArchive) error {
+	rows, err := s.query(`SELECT `+entryChangeColumns+`
+		FROM habit_entry_changes c
+		JOIN habits h ON h.id = c.habit_id
+		WHERE h.user_id = ? AND h.deleted_at IS NULL
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return err
+	}
+	changes, err := scanEntryChanges(rows)
+	if err != nil {
+		return err
+	}
+	archive.EntryChanges = append(archive.EntryChanges, changes...)
+	return nil
+}
+
+func (s *sqlStore) exportFriendships(userID int, archive *ExportArchive) error {
+	rows, err := s.query(`
+		SELECT f.user_id, f.status, f.created_at, u.username
+		FROM friendships f
+		JOIN users u ON u.id = CASE WHEN f.user_id = ? THEN f.friend_id ELSE f.user_id END
+		WHERE f.user_id = ? OR f.friend_id = ?
+		ORDER BY f.created_at`, userID, userID, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f ExportFriendship
+		var requesterID int
+		if err := rows.Scan(&requesterID, &f.Status, &f.CreatedAt, &f.Username); err != nil {
+			return err
+		}
+		f.Direction = "received"
+		if requesterID == userID {
+			f.Direction = "sent"
+		}
+		archive.Friendships = append(archive.Friendships, f)
+	}
+	return rows.Err()
+}
+
+func (s *sqlStore) exportActivities(userID int, archive *ExportArchive) error {
+	rows, err := s.query(`SELECT id, activity_type, habit_id, goal_completion_id, challenge_id, metadata, visibility, created_at
+		FROM activity_feeds WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var af ActivityFeed
+		var habitID, goalCompletionID, challengeID sql.NullInt64
+		var metadata, visibility sql.NullString
+		err := rows.Scan(&af.ID, &af.ActivityType, &habitID, &goalCompletionID, &challengeID, &metadata, &visibility, &af.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		af.UserID = userID
+		af.HabitID = nullIntPtr(habitID)
+		af.GoalCompletionID = nullIntPtr(goalCompletionID)
+		af.ChallengeID = nullIntPtr(challengeID)
+		af.Visibility = visibility.String
+		if metadata.Valid && metadata.String != "" {
+			json.Unmarshal([]byte(metadata.String), &af.Metadata)
+		}
+		archive.Activities = append(archive.Activities, af)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Comentários e reações feitos pelo usuário, em qualquer atividade
+	rows, err = s.query("SELECT id, activity_id, comment, created_at FROM activity_comments WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c ExportComment
+		if err := rows.Scan(&c.ID, &c.ActivityID, &c.Comment, &c.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		archive.Comments = append(archive.Comments, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = s.query("SELECT activity_id, reaction_type, created_at FROM activity_reactions WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ExportReaction
+		if err := rows.Scan(&r.ActivityID, &r.ReactionType, &r.CreatedAt); err != nil {
+			return err
+		}
+		archive.Reactions = append(archive.Reactions, r)
+	}
+	return rows.Err()
+}
+
+func (s *sqlStore) exportGroups(userID int, archive *ExportArchive) error {
+	rows, err := s.query(`
+		SELECT g.id, g.name, gm.role, gm.joined_at
+		FROM group_members gm
+		JOIN `+"`groups`"+` g ON g.id = gm.group_id
+		WHERE gm.user_id = ?
+		ORDER BY gm.joined_at`, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var m ExportGroupMembership
+		if err := rows.Scan(&m.GroupID, &m.GroupName, &m.Role, &m.JoinedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		archive.GroupMemberships = append(archive.GroupMemberships, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = s.query(`
+		SELECT c.id, c.name, c.habit_name, c.goal_type, c.goal_value, c.unit, cp.progress, cp.notes, cp.joined_at
+		FROM challenge_participants cp
+		JOIN challenges c ON c.id = cp.challenge_id
+		WHERE cp.user_id = ?
+		ORDER BY cp.joined_at`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p ExportChallengeParticipation
+		var notes, unit sql.NullString
+		err := rows.Scan(&p.ChallengeID, &p.ChallengeName, &p.HabitName, &p.GoalType, &p.GoalValue, &unit, &p.Progress, &notes, &p.JoinedAt)
+		if err != nil {
+			return err
+		}
+		p.Notes = notes.String
+		p.Unit = unit.String
+		archive.ChallengeParticipations = append(archive.ChallengeParticipations, p)
+	}
+	return rows.Err()
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	id := int(v.Int64)
+	return &id
+}
+
+// Importa o arquivo numa única transação. Cada registro criado é anotado
+// em import_mappings (origem, tipo, id original) e é pulado se aparecer
+// de novo; os ids do arquivo são trocados pelos ids novos.
+func (s *sqlStore) ImportArchive(userID int, source string, archive *ExportArchive) (*ImportResult, error) {
+	result := &ImportResult{}
+	err := s.withTx(func(tx *sql.Tx) error {
+		// Registros apagados depois da última importação podem voltar
+		for kind, table := range importKinds {
+			_, err := s.execOn(tx, "DELETE FROM import_mappings WHERE user_id = ? AND kind = ? AND target_id NOT IN (SELECT id FROM "+table+")",
+				userID, kind)
+			if err != nil {
+				return err
+			}
+		}
+
+		ids, err := s.loadImportMappings(tx, userID, source)
+		if err != nil {
+			return err
+		}
+		mapped := func(kind string, sourceID int, create func() (int, error)) (bool, error) {
+			if _, ok := ids[kind][sourceID]; ok {
+				return false, nil
+			}
+			targetID, err := create()
+			if err != nil {
+				return false, err
+			}
+			_, err = s.execOn(tx, "INSERT INTO import_mappings (user_id, source, kind, source_id, target_id) VALUES (?, ?, ?, ?, ?)",
+				userID, source, kind, sourceID, targetID)
+			if ids[kind] == nil {
+				ids[kind] = map[int]int{}
+			}
+			ids[kind][sourceID] = targetID
+			return true, err
+		}
+
+		newHabits := map[int]bool{}
+		for _, habit := range archive.Habits {
+			habit, sourceID := habit, habit.ID
+			created, err := mapped("habit", sourceID, func() (int, error) {
+				habit.UserID = userID
+				err := s.insertHabit(tx, &habit)
+				return habit.ID, err
+			})
+			if err != nil {
+				return err
+			}
+			result.Habits.count(created)
+			newHabits[sourceID] = created
+		}
+
+		for _, entry := range archive.Entries {
+			habitID, ok := ids["habit"][entry.HabitID]
+			if !ok {
+				result.Entries.Skipped++
+				continue
+			}
+			entry := entry
+			created, err := mapped("entry", entry.ID, func() (int, error) {
+				entry.HabitID = habitID
+				err := s.insertEntry(tx, &entry)
+				return entry.ID, err
+			})
+			if err != nil {
+				return err
+			}
+			result.Entries.count(created)
+		}
+
+		for _, completion := range archive.GoalCompletions {
+			habitID, ok := ids["habit"][completion.HabitID]
+			if !ok {
+				result.GoalCompletions.Skipped++
+				continue
+			}
+			completion := completion
+			created, err := mapped("goal_completion", completion.ID, func() (int, error) {
+				completion.HabitID = habitID
+				err := s.insertGoalCompletion(tx, &completion)
+				return completion.ID, err
+			})
+			if err != nil {
+				return err
+			}
+			result.GoalCompletions.count(created)
+		}
+
+		// Entradas removidas não estão no arquivo; o histórico delas fica com
+		// o id original negativo, que não colide com entradas existentes
+		for _, change := range archive.EntryChanges {
+			habitID, ok := ids["habit"][change.HabitID]
+			if !ok {
+				result.EntryChanges.Skipped++
+				continue
+			}
+			change := change
+			created, err := mapped("entry_change", change.ID, func() (int, error) {
+				entryID, ok := ids["entry"][change.EntryID]
+				if !ok {
+					entryID = -change.EntryID
+				}
+				return s.insert(tx, `INSERT INTO habit_entry_changes (entry_id, habit_id, action, old_completed_at, new_completed_at,
+						old_value, new_value, old_notes, new_notes, changed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					entryID, habitID, change.Action, change.OldCompletedAt, change.NewCompletedAt,
+					change.OldValue, change.NewValue, change.OldNotes, change.NewNotes, change.ChangedAt)
+			})
+			if err != nil {
+				return err
+			}
+			result.EntryChanges.count(created)
+		}
+
+		// Dias pulados não têm id próprio; vão junto com o hábito novo
+		skipped := map[HabitSkip]bool{}
+		for _, skip := range archive.Skips {
+			key := HabitSkip{HabitID: skip.HabitID, Date: skip.Date}
+			if !newHabits[skip.HabitID] || skipped[key] {
+				result.Skips.Skipped++
+				continue
+			}
+			skipped[key] = true
+			_, err := s.execOn(tx, "INSERT INTO habit_skips (habit_id, day, kind, created_at) VALUES (?, ?, ?, ?)",
+				ids["habit"][skip.HabitID], skip.Date, skip.Kind, skip.CreatedAt)
+			if err != nil {
+				return err
+			}
+			result.Skips.Imported++
+		}
+
+		for _, award := range archive.StreakFreezeAwards {
+			award := award
+			created, err := mapped("freeze_award", award.ID, func() (int, error) {
+				return s.insert(tx, "INSERT INTO streak_freeze_awards (user_id, habit_id, day, streak, created_at) VALUES (?, ?, ?, ?, ?)",
+					userID, remapID(ids["habit"], award.HabitID), award.Day, award.Streak, award.CreatedAt)
+			})
+			if err != nil {
+				return err
+			}
+			result.StreakFreezeAwards.count(created)
+		}
+
+		// Pausas de hábitos específicos só valem para os que foram importados
+		for _, pause := range archive.Pauses {
+			pause := pause
+			habitIDs := []int{}
+			for _, habitID := range pause.HabitIDs {
+				if id, ok := ids["habit"][habitID]; ok {
+					habitIDs = append(habitIDs, id)
+				}
+			}
+			if !pause.AllHabits && len(habitIDs) == 0 {
+				result.Pauses.Skipped++
+				continue
+			}
+			created, err := mapped("pause", pause.ID, func() (int, error) {
+				pause.UserID, pause.HabitIDs = userID, habitIDs
+				err := s.insertPause(tx, &pause)
+				return pause.ID, err
+			})
+			if err != nil {
+				return err
+			}
+			result.Pauses.count(created)
+		}
+
+		// Filtros salvos com o nome de um que a conta já tem ficam de fora
+		viewNames, err := s.habitViewNames(tx, userID)
+		if err != nil {
+			return err
+		}
+		for _, view := range archive.Views {
+			if viewNames[strings.ToLower(view.Name)] {
+				if _, ok := ids["view"][view.ID]; !ok {
+					result.Views.Skipped++
+					continue
+				}
+			}
+			view := view
+			created, err := mapped("view", view.ID, func() (int, error) {
+				filters, err := json.Marshal(view.Filters)
+				if err != nil {
+					return 0, err
+				}
+				return s.insert(tx, "INSERT INTO habit_views (user_id, name, filters, created_at) VALUES (?, ?, ?, ?)",
+					userID, view.Name, string(filters), view.CreatedAt)
+			})
+			if err != nil {
+				return err
+			}
+			result.Views.count(created)
+			viewNames[strings.ToLower(view.Name)] = true
+		}
+
+		newActivities := map[int]bool{}
+		for _, activity := range archive.Activities {
+			activity, sourceID := activity, activity.ID
+			created, err := mapped("activity", sourceID, func() (int, error) {
+				activity.UserID = userID
+				activity.HabitID = remapID(ids["habit"], activity.HabitID)
+				activity.GoalCompletionID = remapID(ids["goal_completion"], activity.GoalCompletionID)
+				// Desafios pertencem à instância de origem
+				activity.ChallengeID = nil
+				err := s.insertActivity(tx, &activity)
+				return activity.ID, err
+			})
+			if err != nil {
+				return err
+			}
+			result.Activities.count(created)
+			newActivities[sourceID] = created
+		}
+
+		// Só comentários e reações em atividades importadas têm para onde ir
+		for _, comment := range archive.Comments {
+			activityID, ok := ids["activity"][comment.ActivityID]
+			if !ok {
+				result.Comments.Skipped++
+				continue
+			}
+			comment := comment
+			created, err := mapped("comment", comment.ID, func() (int, error) {
+				return s.insert(tx, "INSERT INTO activity_comments (activity_id, user_id, comment, created_at) VALUES (?, ?, ?, ?)",
+					activityID, userID, comment.Comment, comment.CreatedAt)
+			})
+			if err != nil {
+				return err
+			}
+			result.Comments.count(created)
+		}
+
+		// Reações não têm id próprio; vão junto com a atividade nova
+		for _, reaction := range archive.Reactions {
+			if !newActivities[reaction.ActivityID] {
+				result.Reactions.Skipped++
+				continue
+			}
+			activityID := ids["activity"][reaction.ActivityID]
+			query := s.dialect.upsert("activity_reactions",
+				[]string{"activity_id", "user_id", "reaction_type", "created_at"},
+				[]string{"activity_id", "user_id"},
+				[]string{"reaction_type"})
+			if _, err := s.execOn(tx, query, activityID, userID, reaction.ReactionType, reaction.CreatedAt); err != nil {
+				return err
+			}
+			result.Reactions.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *sqlStore) habitViewNames(tx *sql.Tx, userID int) (map[string]bool, error) {
+	rows, err := tx.Query("SELECT name FROM habit_views WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names, rows.Err()
+}
+
+func (s *sqlStore) loadImportMappings(tx *sql.Tx, userID int, source string) (map[string]map[int]int, error) {
+	rows, err := tx.Query("SELECT kind, source_id, target_id FROM import_mappings WHERE user_id = ? AND source = ?", userID, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]map[int]int{}
+	for rows.Next() {
+		var kind string
+		var sourceID, targetID int
+		if err := rows.Scan(&kind, &sourceID, &targetID); err != nil {
+			return nil, err
+		}
+		if ids[kind] == nil {
+			ids[kind] = map[int]int{}
+		}
+		ids[kind][sourceID] = targetID
+	}
+	return ids, rows.Err()
+}
+
+// Troca um id opcional do arquivo pelo id importado; nil se não houver
+func remapID(ids map[int]int, id *int) *int {
+	if id == nil {
+		return nil
+	}
+	target, ok := ids[*id]
+	if !ok {
+		return nil
+	}
+	return &target
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Grupos, membros, desafios e participantes
+
+const groupQuery = `
+	SELECT g.id, g.name, g.description, g.privacy, g.creator_id, g.created_at, g.updated_at,
+		   u.id, u.username, u.email,
+		   (SELECT COUNT(*) FROM group_members WHERE group_id = g.id) as member_count,
+		   (SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND user_id = ?) as is_joined
+	FROM ` + "`groups`" + ` g
+	JOIN users u ON u.id = g.creator_id
+`
+
+func scanGroup(row rowScanner) (*Group, error) {
+	var g Group
+	var creator User
+	var description sql.NullString
+	var isJoinedInt int
+	err := row.Scan(&g.ID, &g.Name, &description, &g.Privacy, &g.CreatorID, &g.CreatedAt, &g.UpdatedAt,
+		&creator.ID, &creator.Username, &creator.Email, &g.MemberCount, &isJoinedInt)
+	if err != nil {
+		return nil, err
+	}
+	g.Description = description.String
+	g.Creator = &creator
+	g.IsJoined = isJoinedInt > 0
+	return &g, nil
+}
+
+// Grupos públicos e grupos dos quais o usuário é membro
+func (s *sqlStore) ListGroups(userID int) ([]Group, error) {
+	query := groupQuery + `
+		WHERE g.privacy = 'public' OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ?)
+		ORDER BY g.created_at DESC
+	`
+	rows, err := s.query(query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	return groups, rows.Err()
+}
+
+func (s *sqlStore) GetGroup(userID, groupID int) (*Group, error) {
+	g, err := scanGroup(s.queryRow(groupQuery+"WHERE g.id = ?", userID, groupID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return g, nil
+}
+
+// Cria o grupo com o criador como admin
+func (s *sqlStore) CreateGroup(group *Group) error {
+	now := time.Now()
+	return s.withTx(func(tx *sql.Tx) error {
+		id, err := s.insert(tx, "INSERT INTO `groups` (name, description, privacy, creator_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			group.Name, group.Description, group.Privacy, group.CreatorID, now, now)
+		if err != nil {
+			return err
+		}
+		if _, err := s.execOn(tx, "INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES (?, ?, 'admin', ?)",
+			id, group.CreatorID, now); err != nil {
+			return err
+		}
+		group.ID = id
+		group.CreatedAt = now
+		group.UpdatedAt = now
+		return nil
+	})
+}
+
+func (s *sqlStore) UpdateGroup(group *Group) error {
+	return requireAffected(s.exec("UPDATE `groups` SET name = ?, description = ?, privacy = ?, updated_at = ? WHERE id = ?",
+		group.Name, group.Description, group.Privacy, time.Now(), group.ID))
+}
+
+// Remove o grupo; o cascade remove membros e desafios
+func (s *sqlStore) DeleteGroup(groupID int) error {
+	return requireAffected(s.exec("DELETE FROM `groups` WHERE id = ?", groupID))
+}
+
+func (s *sqlStore) GetMemberRole(groupID, userID int) (string, error) {
+	var role string
+	err := s.queryRow("SELECT role FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&role)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return role, nil
+}
+
+func (s *sqlStore) AddGroupMember(groupID, userID int, role string) error {
+	_, err := s.exec("INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)",
+		groupID, userID, role, time.Now())
+	return err
+}
+
+func (s *sqlStore) RemoveGroupMember(groupID, userID int) error {
+	return requireAffected(s.exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID))
+}
+
+func (s *sqlStore) ListGroupMembers(groupID int) ([]GroupMember, error) {
+	query := `
+		SELECT gm.id, gm.group_id, gm.user_id, gm.role, gm.joined_at,
+			   u.id, u.username, u.email
+		FROM group_members gm
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ?
+		ORDER BY gm.role DESC, gm.joined_at ASC
+	`
+	rows, err := s.query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []GroupMember
+	for rows.Next() {
+		var gm GroupMember
+		var u User
+		err := rows.Scan(&gm.ID, &gm.GroupID, &gm.UserID, &gm.Role, &gm.JoinedAt,
+			&u.ID, &u.Username, &u.Email)
+		if err != nil {
+			return nil, err
+		}
+		gm.User = &u
+		members = append(members, gm)
+	}
+	return members, rows.Err()
+}
+
+const challengeQuery = `
+	SELECT c.id, c.group_id, c.name, c.description, c.habit_name, c.goal_value, c.unit, c.goal_type,
+		   c.start_date, c.end_date, c.status, c.creator_id, c.created_at, c.updated_at,
+		   u.id, u.username, u.email,
+		   g.id, g.name, g.privacy,
+		   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id) as participant_count,
+		   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id AND user_id = ?) as is_participating,
+		   COALESCE((SELECT progress FROM challenge_participants WHERE challenge_id = c.id AND user_id = ?), 0) as user_progress,
+		   (SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id AND progress >= c.goal_value) as completed_count
+	FROM challenges c
+	JOIN users u ON u.id = c.creator_id
+	JOIN ` + "`groups`" + ` g ON g.id = c.group_id
+`
+
+func scanChallenge(row rowScanner) (*Challenge, error) {
+	var c Challenge
+	var creator User
+	var group Group
+	var description, unit sql.NullString
+	var isParticipatingInt, completedCount int
+	err := row.Scan(&c.ID, &c.GroupID, &c.Name, &description, &c.HabitName, &c.GoalValue, &unit, &c.GoalType,
+		&c.StartDate, &c.EndDate, &c.Status, &c.CreatorID, &c.CreatedAt, &c.UpdatedAt,
+		&creator.ID, &creator.Username, &creator.Email,
+		&group.ID, &group.Name, &group.Privacy,
+		&c.ParticipantCount, &isParticipatingInt, &c.UserProgress, &completedCount)
+	if err != nil {
+		return nil, err
+	}
+	c.Description = description.String
+	c.Unit = unit.String
+	c.Creator = &creator
+	c.Group = &group
+	c.IsParticipating = isParticipatingInt > 0
+	c.HasCompletedParticipant = completedCount > 0
+	return &c, nil
+}
+
+func (s *sqlStore) listChallenges(query string, args ...interface{}) ([]Challenge, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var challenges []Challenge
+	for rows.Next() {
+		c, err := scanChallenge(rows)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, *c)
+	}
+	return challenges, rows.Err()
+}
+
+// Desafios de grupos públicos e dos grupos do usuário
+func (s *sqlStore) ListChallenges(userID int) ([]Challenge, error) {
+	return s.listChallenges(challengeQuery+`
+		WHERE g.privacy = 'public' OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ?)
+		ORDER BY c.created_at DESC
+	`, userID, userID, userID)
+}
+
+func (s *sqlStore) ListGroupChallenges(userID, groupID int) ([]Challenge, error) {
+	return s.listChallenges(challengeQuery+"WHERE c.group_id = ? ORDER BY c.created_at DESC", userID, userID, groupID)
+}
+
+func (s *sqlStore) GetChallenge(userID, challengeID int) (*Challenge, error) {
+	c, err := scanChallenge(s.queryRow(challengeQuery+"WHERE c.id = ?", userID, userID, challengeID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+// Cria o desafio já com o criador participando
+func (s *sqlStore) CreateChallenge(challenge *Challenge) error {
+	now := time.Now()
+	return s.withTx(func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO challenges (group_id, name, description, habit_name, goal_value, unit, goal_type,
+									start_date, end_date, status, creator_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+		id, err := s.insert(tx, query, challenge.GroupID, challenge.Name, challenge.Description, challenge.HabitName,
+			challenge.GoalValue, challenge.Unit, challenge.GoalType, challenge.StartDate, challenge.EndDate, challenge.Status,
+			challenge.CreatorID, now, now)
+		if err != nil {
+			return err
+		}
+		if _, err := s.execOn(tx, "INSERT INTO challenge_participants (challenge_id, user_id, joined_at, updated_at) VALUES (?, ?, ?, ?)",
+			id, challenge.CreatorID, now, now); err != nil {
+			return err
+		}
+		challenge.ID = id
+		challenge.CreatedAt = now
+		challenge.UpdatedAt = now
+		return nil
+	})
+}
+
+func (s *sqlStore) UpdateChallenge(challenge *Challenge) error {
+	query := `
+		UPDATE challenges
+		SET name = ?, description = ?, habit_name = ?, goal_value = ?, unit = ?, goal_type = ?,
+			start_date = ?, end_date = ?, updated_at = ?
+		WHERE id = ?
+	`
+	return requireAffected(s.exec(query, challenge.Name, challenge.Description, challenge.HabitName, challenge.GoalValue,
+		challenge.Unit, challenge.GoalType, challenge.StartDate, challenge.EndDate, time.Now(), challenge.ID))
+}
+
+// Remove o desafio, as participações e as atividades do feed relacionadas
+func (s *sqlStore) DeleteChallenge(challengeID int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := s.execOn(tx, "DELETE FROM challenge_participants WHERE challenge_id = ?", challengeID); err != nil {
+			return err
+		}
+		if _, err := s.execOn(tx, "DELETE FROM activity_feeds WHERE challenge_id = ?", challengeID); err != nil {
+			return err
+		}
+		return requireAffected(s.execOn(tx, "DELETE FROM challenges WHERE id = ?", challengeID))
+	})
+}
+
+func (s *sqlStore) HasCompletedParticipant(challengeID int) (bool, error) {
+	var completed bool
+	err := s.queryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM challenge_participants cp
+			JOIN challenges c ON c.id = cp.challenge_id
+			WHERE cp.challenge_id = ? AND cp.progress >= c.goal_value
+		)
+	`, challengeID).Scan(&completed)
+	return completed, err
+}
+
+const participantQuery = `
+	SELECT cp.id, cp.challenge_id, cp.user_id, cp.progress, cp.notes, cp.joined_at, cp.updated_at,
+		   u.id, u.username, u.email
+	FROM challenge_participants cp
+	JOIN users u ON u.id = cp.user_id
+`
+
+func scanParticipant(row rowScanner) (*ChallengeParticipant, error) {
+	var cp ChallengeParticipant
+	var u User
+	var notes sql.NullString
+	err := row.Scan(&cp.ID, &cp.ChallengeID, &cp.UserID, &cp.Progress, &notes, &cp.JoinedAt, &cp.UpdatedAt,
+		&u.ID, &u.Username, &u.Email)
+	if err != nil {
+		return nil, err
+	}
+	if notes.Valid {
+		cp.Notes = &notes.String
+	}
+	cp.User = &u
+	return &cp, nil
+}
+
+func (s *sqlStore) GetParticipant(challengeID, userID int) (*ChallengeParticipant, error) {
+	cp, err := scanParticipant(s.queryRow(participantQuery+"WHERE cp.challenge_id = ? AND cp.user_id = ?", challengeID, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return cp, nil
+}
+
+func (s *sqlStore) AddParticipant(challengeID, userID int) error {
+	now := time.Now()
+	_, err := s.exec("INSERT INTO challenge_participants (challenge_id, user_id, joined_at, updated_at) VALUES (?, ?, ?, ?)",
+		challengeID, userID, now, now)
+	return err
+}
+
+func (s *sqlStore) RemoveParticipant(challengeID, userID int) error {
+	return requireAffected(s.exec("DELETE FROM challenge_participants WHERE challenge_id = ? AND user_id = ?", challengeID, userID))
+}
+
+func (s *sqlStore) ListParticipants(challengeID int) ([]ChallengeParticipant, error) {
+	rows, err := s.query(participantQuery+"WHERE cp.challenge_id = ? ORDER BY cp.progress DESC, cp.joined_at ASC", challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []ChallengeParticipant
+	for rows.Next() {
+		cp, err := scanParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, *cp)
+	}
+	return participants, rows.Err()
+}
+
+func (s *sqlStore) UpdateParticipantProgress(participant *ChallengeParticipant) error {
+	participant.UpdatedAt = time.Now()
+	return requireAffected(s.exec("UPDATE challenge_participants SET progress = ?, notes = ?, updated_at = ? WHERE challenge_id = ? AND user_id = ?",
+		participant.Progress, participant.Notes, participant.UpdatedAt, participant.ChallengeID, participant.UserID))
+}
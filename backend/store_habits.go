@@ -0,0 +1,615 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Usuários, hábitos, entradas e histórico de metas
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *sqlStore) CreateUser(user *User, passwordHash string) error {
+	if user.Timezone == "" {
+		user.Timezone = defaultTimezone
+	}
+	if user.Locale == "" {
+		user.Locale = defaultLocale
+	}
+	id, err := s.insert(s.db, "INSERT INTO users (username, email, password, timezone, locale) VALUES (?, ?, ?, ?, ?)",
+		user.Username, user.Email, passwordHash, user.Timezone, user.Locale)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+const userColumns = "id, username, email, created_at, email_verified_at, totp_enabled, display_name, bio, avatar_path, timezone, locale, week_start, quiet_hours_start, quiet_hours_end, digest_frequency"
+
+func scanUser(row rowScanner, extra ...interface{}) (*User, error) {
+	var user User
+	var verifiedAt sql.NullTime
+	var totpEnabled sql.NullBool
+	var displayName, bio, avatarPath, quietStart, quietEnd sql.NullString
+	dest := append([]interface{}{&user.ID, &user.Username, &user.Email, &user.CreatedAt, &verifiedAt, &totpEnabled,
+		&displayName, &bio, &avatarPath, &user.Timezone, &user.Locale, &user.WeekStart, &quietStart, &quietEnd, &user.DigestFrequency}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, notFound(err)
+	}
+	user.EmailVerified = verifiedAt.Valid
+	user.TwoFactorEnabled = totpEnabled.Bool
+	user.DisplayName = displayName.String
+	user.Bio = bio.String
+	user.AvatarPath = avatarPath.String
+	user.AvatarURL = avatarURL(user.AvatarPath)
+	user.QuietHoursStart = quietStart.String
+	user.QuietHoursEnd = quietEnd.String
+	return &user, nil
+}
+
+func (s *sqlStore) GetUser(userID int) (*User, error) {
+	return scanUser(s.queryRow("SELECT "+userColumns+" FROM users WHERE id = ?", userID))
+}
+
+// Retorna o usuário e o hash da senha
+func (s *sqlStore) GetUserByEmail(email string) (*User, string, error) {
+	var hashedPassword string
+	user, err := scanUser(s.queryRow("SELECT "+userColumns+", password FROM users WHERE email = ?", email), &hashedPassword)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, hashedPassword, nil
+}
+
+func (s *sqlStore) GetPasswordHash(userID int) (string, error) {
+	var hashedPassword string
+	err := s.queryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hashedPassword)
+	return hashedPassword, notFound(err)
+}
+
+func (s *sqlStore) UpdatePassword(userID int, passwordHash string) error {
+	return requireAffected(s.exec("UPDATE users SET password = ? WHERE id = ?", passwordHash, userID))
+}
+
+// Atualiza os campos editáveis do perfil (não o e-mail nem o avatar)
+func (s *sqlStore) UpdateProfile(user *User) error {
+	return requireAffected(s.exec("UPDATE users SET username = ?, display_name = ?, bio = ?, timezone = ?, locale = ?, week_start = ?, quiet_hours_start = ?, quiet_hours_end = ?, digest_frequency = ? WHERE id = ?",
+		user.Username, user.DisplayName, user.Bio, user.Timezone, user.Locale, user.WeekStart,
+		user.QuietHoursStart, user.QuietHoursEnd, user.DigestFrequency, user.ID))
+}
+
+func (s *sqlStore) UpdateAvatar(userID int, avatarPath string) error {
+	return requireAffected(s.exec("UPDATE users SET avatar_path = ? WHERE id = ?", avatarPath, userID))
+}
+
+// Troca o e-mail; o novo endereço precisa ser verificado de novo
+func (s *sqlStore) UpdateEmail(userID int, email string) error {
+	return requireAffected(s.exec("UPDATE users SET email = ?, email_verified_at = NULL WHERE id = ?", email, userID))
+}
+
+// Remove o usuário; hábitos, entradas, amizades, grupos criados,
+// participações, atividades e sessões saem junto pelo ON DELETE CASCADE
+func (s *sqlStore) DeleteUser(userID int) error {
+	return requireAffected(s.exec("DELETE FROM users WHERE id = ?", userID))
+}
+
+// Marca o e-mail como verificado, desde que ainda seja o e-mail do usuário
+func (s *sqlStore) MarkEmailVerified(userID int, email string) error {
+	return requireAffected(s.exec("UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ?",
+		time.Now(), userID, email))
+}
+
+const habitColumns = "id, user_id, name, description, is_active, multipleUpdate, category, icon, goal, goal_type, reminder_enabled, reminder_time, reminder_times, reminder_mode, visibility, schedule, unit, target_value, polarity, goal_window_days, goal_start_date, goal_end_date, last_goal_reset, archived_at, deleted_at, sort_order, created_at"
+
+func scanHabit(row rowScanner) (*Habit, error) {
+	var habit Habit
+	var description, category, icon, reminderTime, reminderTimesStr, visibility, schedule, unit, goalStartDate, goalEndDate sql.NullString
+	var lastGoalReset, archivedAt, deletedAt sql.NullTime
+	err := row.Scan(&habit.ID, &habit.UserID, &habit.Name, &description, &habit.IsActive, &habit.MultipleUpdate,
+		&category, &icon, &habit.Goal, &habit.GoalType, &habit.ReminderEnabled, &reminderTime, &reminderTimesStr,
+		&habit.ReminderMode, &visibility, &schedule, &unit, &habit.TargetValue, &habit.Polarity, &habit.GoalWindowDays, &goalStartDate, &goalEndDate, &lastGoalReset, &archivedAt, &deletedAt, &habit.SortOrder, &habit.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	habit.Description = description.String
+	habit.Category = category.String
+	habit.Icon = icon.String
+	habit.ReminderTime = reminderTime.String
+	habit.Schedule = stringToSchedule(schedule.String)
+	habit.Unit = unit.String
+	habit.GoalStartDate = goalStartDate.String
+	habit.GoalEndDate = goalEndDate.String
+	if lastGoalReset.Valid {
+		habit.LastGoalReset = &lastGoalReset.Time
+	}
+	if archivedAt.Valid {
+		habit.ArchivedAt = &archivedAt.Time
+	}
+	if deletedAt.Valid {
+		habit.DeletedAt = &deletedAt.Time
+	}
+
+	// Definir visibilidade padrão se estiver vazio
+	if visibility.Valid {
+		habit.Visibility = visibility.String
+	} else {
+		habit.Visibility = "public"
+	}
+
+	// Converter reminder_times do banco para array; um valor corrompido não
+	// derruba a listagem, o hábito volta ao reminder_time
+	var times []string
+	if reminderTimesStr.Valid && reminderTimesStr.String != "" {
+		if times, err = stringToReminderTimes(reminderTimesStr.String); err != nil {
+			log.Printf("Habit %d: %v", habit.ID, err)
+		}
+	}
+	if times != nil {
+		habit.ReminderTimes = times
+	} else if habit.ReminderTime != "" {
+		// Se não tem reminder_times, usar reminder_time como fallback
+		habit.ReminderTimes = []string{habit.ReminderTime}
+	} else {
+		habit.ReminderTimes = []string{}
+	}
+
+	return &habit, nil
+}
+
+// Na ordem definida pelo usuário; sem ordem, os mais novos primeiro
+func (s *sqlStore) ListHabits(userID int) ([]Habit, error) {
+	habits, err := s.listHabits("SELECT "+habitColumns+" FROM habits WHERE user_id = ? AND deleted_at IS NULL ORDER BY sort_order, created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	return habits, s.attachTags(userID, habits)
+}
+
+func (s *sqlStore) listHabits(query string, args ...interface{}) ([]Habit, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var habits []Habit
+	for rows.Next() {
+		habit, err := scanHabit(rows)
+		if err != nil {
+			return nil, err
+		}
+		habits = append(habits, *habit)
+	}
+	return habits, rows.Err()
+}
+
+// Hábitos ativos de todos os usuários com meta por período encerrável,
+// para o job de metas
+func (s *sqlStore) ListGoalHabits() ([]Habit, error) {
+	return s.listHabits("SELECT "+habitColumns+" FROM habits WHERE is_active = ? AND deleted_at IS NULL AND polarity <> ? AND goal_type IN ('count', 'weekly', 'monthly', 'yearly', 'range') ORDER BY user_id, id",
+		true, polarityQuit)
+}
+
+// Hábitos removidos e ainda não apagados, do mais recente para o mais antigo
+func (s *sqlStore) ListDeletedHabits(userID int) ([]Habit, error) {
+	habits, err := s.listHabits("SELECT "+habitColumns+" FROM habits WHERE user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	return habits, s.attachTags(userID, habits)
+}
+
+func (s *sqlStore) GetHabit(userID, habitID int) (*Habit, error) {
+	habit, err := scanHabit(s.queryRow("SELECT "+habitColumns+" FROM habits WHERE id = ? AND user_id = ? AND deleted_at IS NULL", habitID, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	habits := []Habit{*habit}
+	if err := s.attachTags(userID, habits); err != nil {
+		return nil, err
+	}
+	return &habits[0], nil
+}
+
+// O hábito novo entra no topo da lista
+func (s *sqlStore) CreateHabit(habit *Habit) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT COALESCE(MIN(sort_order), 0) - 1 FROM habits WHERE user_id = ? AND deleted_at IS NULL",
+			s.bind([]interface{}{habit.UserID})...).Scan(&habit.SortOrder)
+		if err != nil {
+			return err
+		}
+		return s.insertHabit(tx, habit)
+	})
+}
+
+func (s *sqlStore) insertHabit(ex sqlExecutor, habit *Habit) error {
+	if habit.CreatedAt.IsZero() {
+		habit.CreatedAt = time.Now()
+	}
+	query := "INSERT INTO habits (user_id, name, description, is_active, multipleUpdate, category, icon, goal, goal_type, reminder_enabled, reminder_time, reminder_times, reminder_mode, visibility, schedule, unit, target_value, polarity, goal_window_days, goal_start_date, goal_end_date, last_goal_reset, archived_at, sort_order, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	id, err := s.insert(ex, query, habit.UserID, habit.Name, habit.Description, habit.IsActive, habit.MultipleUpdate,
+		habit.Category, habit.Icon, habit.Goal, habit.GoalType, habit.ReminderEnabled, habit.ReminderTime,
+		reminderTimesToString(habit.ReminderTimes), habit.reminderMode(), habit.Visibility, scheduleToString(habit.Schedule), habit.Unit, habit.TargetValue, habit.polarity(), habit.GoalWindowDays, habit.GoalStartDate, habit.GoalEndDate, habit.LastGoalReset, habit.ArchivedAt, habit.SortOrder, habit.CreatedAt)
+	if err != nil {
+		return err
+	}
+	habit.ID = id
+	if habit.Tags == nil {
+		habit.Tags = []string{}
+	}
+	return s.setHabitTags(ex, habit.UserID, habit.ID, habit.Tags)
+}
+
+// Não altera is_active (arquivar e desarquivar têm rotas próprias) nem
+// sort_order; Tags nil mantém as etiquetas
+func (s *sqlStore) UpdateHabit(habit *Habit) error {
+	query := "UPDATE habits SET name = ?, description = ?, multipleUpdate = ?, category = ?, icon = ?, goal = ?, goal_type = ?, reminder_enabled = ?, reminder_time = ?, reminder_times = ?, reminder_mode = ?, visibility = ?, schedule = ?, unit = ?, target_value = ?, polarity = ?, goal_window_days = ?, goal_start_date = ?, goal_end_date = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL"
+	return s.withTx(func(tx *sql.Tx) error {
+		err := requireAffected(s.execOn(tx, query, habit.Name, habit.Description, habit.MultipleUpdate,
+			habit.Category, habit.Icon, habit.Goal, habit.GoalType, habit.ReminderEnabled, habit.ReminderTime,
+			reminderTimesToString(habit.ReminderTimes), habit.reminderMode(), habit.Visibility, scheduleToString(habit.Schedule), habit.Unit, habit.TargetValue, habit.polarity(), habit.GoalWindowDays, habit.GoalStartDate, habit.GoalEndDate, habit.ID, habit.UserID))
+		if err != nil || habit.Tags == nil {
+			return err
+		}
+		return s.setHabitTags(tx, habit.UserID, habit.ID, habit.Tags)
+	})
+}
+
+// Arquivado fica inativo, fora das listas e dos jobs, mas mantém o histórico
+func (s *sqlStore) ArchiveHabit(userID, habitID int, archived bool) error {
+	var archivedAt *time.Time
+	if archived {
+		now := time.Now()
+		archivedAt = &now
+	}
+	return requireAffected(s.exec("UPDATE habits SET is_active = ?, archived_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+		!archived, archivedAt, habitID, userID))
+}
+
+// Remoção reversível; os dados só saem com PurgeHabit ou PurgeDeletedHabits
+func (s *sqlStore) DeleteHabit(userID, habitID int) error {
+	return requireAffected(s.exec("UPDATE habits SET deleted_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+		time.Now(), habitID, userID))
+}
+
+func (s *sqlStore) RestoreHabit(userID, habitID int, deletedSince time.Time) error {
+	return requireAffected(s.exec("UPDATE habits SET deleted_at = NULL WHERE id = ? AND user_id = ? AND deleted_at >= ?",
+		habitID, userID, deletedSince))
+}
+
+// Apaga o hábito de vez; entradas, metas e atividades saem pelo ON DELETE CASCADE
+func (s *sqlStore) PurgeHabit(userID, habitID int) error {
+	return requireAffected(s.exec("DELETE FROM habits WHERE id = ? AND user_id = ?", habitID, userID))
+}
+
+func (s *sqlStore) PurgeDeletedHabits(deletedBefore time.Time) (int64, error) {
+	result, err := s.exec("DELETE FROM habits WHERE deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) SetGoalReset(habitID int, at time.Time) error {
+	_, err := s.exec("UPDATE habits SET last_goal_reset = ? WHERE id = ?", at, habitID)
+	return err
+}
+
+const entryColumns = "id, habit_id, completed_at, value, notes, edited_at"
+
+func scanEntry(row rowScanner) (*HabitEntry, error) {
+	var entry HabitEntry
+	var notes sql.NullString
+	var editedAt sql.NullTime
+	if err := row.Scan(&entry.ID, &entry.HabitID, &entry.CompletedAt, &entry.Value, &notes, &editedAt); err != nil {
+		return nil, err
+	}
+	entry.Notes = notes.String
+	if editedAt.Valid {
+		entry.EditedAt = &editedAt.Time
+	}
+	return &entry, nil
+}
+
+func scanEntries(rows *sql.Rows) ([]HabitEntry, error) {
+	defer rows.Close()
+
+	var entries []HabitEntry
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) ListEntries(habitID int) ([]HabitEntry, error) {
+	rows, err := s.query("SELECT "+entryColumns+" FROM habit_entries WHERE habit_id = ? ORDER BY completed_at DESC", habitID)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func (s *sqlStore) GetEntry(habitID, entryID int) (*HabitEntry, error) {
+	return s.getEntry(s.db, habitID, entryID)
+}
+
+func (s *sqlStore) getEntry(ex sqlExecutor, habitID, entryID int) (*HabitEntry, error) {
+	entry, err := scanEntry(ex.QueryRow("SELECT "+entryColumns+" FROM habit_entries WHERE id = ? AND habit_id = ?", s.bind([]interface{}{entryID, habitID})...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return entry, nil
+}
+
+func (s *sqlStore) CreateEntry(entry *HabitEntry) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return s.createEntry(tx, entry)
+	})
+}
+
+func (s *sqlStore) CreateEntries(entries []HabitEntry) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		for i := range entries {
+			if err := s.createEntry(tx, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Entrada nova com o registro "create" no histórico
+func (s *sqlStore) createEntry(ex sqlExecutor, entry *HabitEntry) error {
+	if err := s.insertEntry(ex, entry); err != nil {
+		return err
+	}
+	return s.insertEntryChange(ex, "create", nil, entry)
+}
+
+// Só a entrada, sem histórico (importação)
+func (s *sqlStore) insertEntry(ex sqlExecutor, entry *HabitEntry) error {
+	if entry.Value == 0 {
+		entry.Value = 1
+	}
+	id, err := s.insert(ex, "INSERT INTO habit_entries (habit_id, completed_at, value, notes, edited_at) VALUES (?, ?, ?, ?, ?)",
+		entry.HabitID, entry.CompletedAt, entry.Value, entry.Notes, entry.EditedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	return nil
+}
+
+func (s *sqlStore) UpdateEntry(entry *HabitEntry) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		old, err := s.getEntry(tx, entry.HabitID, entry.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		entry.EditedAt = &now
+		_, err = s.execOn(tx, "UPDATE habit_entries SET completed_at = ?, value = ?, notes = ?, edited_at = ? WHERE id = ? AND habit_id = ?",
+			entry.CompletedAt, entry.Value, entry.Notes, entry.EditedAt, entry.ID, entry.HabitID)
+		if err != nil {
+			return err
+		}
+		return s.insertEntryChange(tx, "update", old, entry)
+	})
+}
+
+func (s *sqlStore) DeleteEntry(habitID, entryID int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		old, err := s.getEntry(tx, habitID, entryID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(s.execOn(tx, "DELETE FROM habit_entries WHERE id = ? AND habit_id = ?", entryID, habitID)); err != nil {
+			return err
+		}
+		return s.insertEntryChange(tx, "delete", old, nil)
+	})
+}
+
+// Grava a alteração de old para new; nil indica criação ou remoção
+func (s *sqlStore) insertEntryChange(ex sqlExecutor, action string, old, new *HabitEntry) error {
+	change := EntryChange{Action: action, ChangedAt: time.Now()}
+	if old != nil {
+		change.EntryID, change.HabitID = old.ID, old.HabitID
+		change.OldCompletedAt, change.OldValue, change.OldNotes = &old.CompletedAt, &old.Value, &old.Notes
+	}
+	if new != nil {
+		change.EntryID, change.HabitID = new.ID, new.HabitID
+		change.NewCompletedAt, change.NewValue, change.NewNotes = &new.CompletedAt, &new.Value, &new.Notes
+	}
+
+	_, err := s.execOn(ex, `INSERT INTO habit_entry_changes (entry_id, habit_id, action, old_completed_at, new_completed_at,
+			old_value, new_value, old_notes, new_notes, changed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		change.EntryID, change.HabitID, change.Action, change.OldCompletedAt, change.NewCompletedAt,
+		change.OldValue, change.NewValue, change.OldNotes, change.NewNotes, change.ChangedAt)
+	return err
+}
+
+const entryChangeColumns = "c.id, c.entry_id, c.habit_id, c.action, c.old_completed_at, c.new_completed_at, c.old_value, c.new_value, c.old_notes, c.new_notes, c.changed_at"
+
+func scanEntryChanges(rows *sql.Rows) ([]EntryChange, error) {
+	defer rows.Close()
+
+	var changes []EntryChange
+	for rows.Next() {
+		var change EntryChange
+		var oldAt, newAt sql.NullTime
+		var oldValue, newValue sql.NullFloat64
+		var oldNotes, newNotes sql.NullString
+		err := rows.Scan(&change.ID, &change.EntryID, &change.HabitID, &change.Action, &oldAt, &newAt,
+			&oldValue, &newValue, &oldNotes, &newNotes, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		if oldAt.Valid {
+			change.OldCompletedAt = &oldAt.Time
+			change.OldValue = &oldValue.Float64
+			change.OldNotes = &oldNotes.String
+		}
+		if newAt.Valid {
+			change.NewCompletedAt = &newAt.Time
+			change.NewValue = &newValue.Float64
+			change.NewNotes = &newNotes.String
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (s *sqlStore) ListEntryChanges(habitID, entryID int) ([]EntryChange, error) {
+	query := "SELECT " + entryChangeColumns + " FROM habit_entry_changes c WHERE c.habit_id = ?"
+	args := []interface{}{habitID}
+	if entryID != 0 {
+		query += " AND c.entry_id = ?"
+		args = append(args, entryID)
+	}
+	rows, err := s.query(query+" ORDER BY c.changed_at DESC, c.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntryChanges(rows)
+}
+
+func (s *sqlStore) ListUserEntryChanges(userID int, habitName string, from, to time.Time) ([]EntryChange, error) {
+	query := `SELECT ` + entryChangeColumns + `
+		FROM habit_entry_changes c
+		JOIN habits h ON h.id = c.habit_id
+		WHERE h.user_id = ? AND h.deleted_at IS NULL AND LOWER(h.name) = LOWER(?)
+		  AND ((c.old_completed_at >= ? AND c.old_completed_at <= ?) OR (c.new_completed_at >= ? AND c.new_completed_at <= ?))
+		ORDER BY c.changed_at DESC, c.id DESC`
+	rows, err := s.query(query, userID, habitName, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntryChanges(rows)
+}
+
+func (s *sqlStore) CountEntries(habitID int, from, to time.Time) (int, error) {
+	query := "SELECT COUNT(*) FROM habit_entries WHERE habit_id = ?"
+	args := []interface{}{habitID}
+	if !from.IsZero() {
+		query += " AND completed_at >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND completed_at <= ?"
+		args = append(args, to)
+	}
+
+	var count int
+	err := s.queryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// Horários de conclusão do hábito, do mais recente para o mais antigo
+func (s *sqlStore) EntryTimes(habitID int) ([]time.Time, error) {
+	rows, err := s.query("SELECT completed_at FROM habit_entries WHERE habit_id = ? ORDER BY completed_at DESC", habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+// Entradas de todos os hábitos do usuário desde since (zero = todas)
+func (s *sqlStore) ListUserEntries(userID int, since time.Time) ([]HabitEntry, error) {
+	query := `
+		SELECT he.id, he.habit_id, he.completed_at, he.value, he.notes, he.edited_at
+		FROM habit_entries he
+		JOIN habits h ON he.habit_id = h.id
+		WHERE h.user_id = ? AND h.deleted_at IS NULL AND he.completed_at >= ?
+		ORDER BY he.completed_at DESC
+	`
+	rows, err := s.query(query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func (s *sqlStore) ListGoalCompletions(habitID int) ([]GoalCompletion, error) {
+	query := `SELECT id, habit_id, goal_type, goal_value, completed_at, period_start, period_end, period_definition, actual_count, missed, notes
+			 FROM goal_completions WHERE habit_id = ? ORDER BY completed_at DESC`
+	rows, err := s.query(query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var completions []GoalCompletion
+	for rows.Next() {
+		var completion GoalCompletion
+		var definition, notes sql.NullString
+		err := rows.Scan(&completion.ID, &completion.HabitID, &completion.GoalType, &completion.GoalValue,
+			&completion.CompletedAt, &completion.PeriodStart, &completion.PeriodEnd, &definition, &completion.ActualCount, &completion.Missed, &notes)
+		if err != nil {
+			return nil, err
+		}
+		completion.PeriodDefinition = definition.String
+		completion.Notes = notes.String
+		completions = append(completions, completion)
+	}
+	return completions, rows.Err()
+}
+
+func (s *sqlStore) CreateGoalCompletion(completion *GoalCompletion) error {
+	return s.insertGoalCompletion(s.db, completion)
+}
+
+func (s *sqlStore) insertGoalCompletion(ex sqlExecutor, completion *GoalCompletion) error {
+	if completion.CompletedAt.IsZero() {
+		completion.CompletedAt = time.Now()
+	}
+	query := `INSERT INTO goal_completions (habit_id, goal_type, goal_value, completed_at, period_start, period_end, period_definition, actual_count, missed, notes)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.insert(ex, query, completion.HabitID, completion.GoalType, completion.GoalValue, completion.CompletedAt,
+		completion.PeriodStart, completion.PeriodEnd, completion.PeriodDefinition, completion.ActualCount, completion.Missed, completion.Notes)
+	if err != nil {
+		return err
+	}
+	completion.ID = id
+	return nil
+}
+
+// Registros de meta (cumpridas ou não) cujo período se sobrepõe a [periodStart, periodEnd]. Nos
+// períodos de calendário equivale ao mesmo período; numa janela móvel,
+// uma meta já registrada vale até a janela deixar de alcançá-la.
+func (s *sqlStore) CountGoalCompletions(habitID int, periodStart, periodEnd time.Time) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM goal_completions WHERE habit_id = ? AND period_start <= ? AND period_end >= ?",
+		habitID, periodEnd, periodStart).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) DeleteGoalCompletions(habitID int, periodStart, periodEnd time.Time) (int64, error) {
+	result, err := s.exec("DELETE FROM goal_completions WHERE habit_id = ? AND period_start <= ? AND period_end >= ?",
+		habitID, periodEnd, periodStart)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type mysqlDialect struct{}
+
+func newMySQLStore(dsn string) (*sqlStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// RowsAffected conta as linhas encontradas, não só as alteradas, para
+	// que um UPDATE sem mudanças não vire ErrNotFound em requireAffected
+	cfg.ClientFoundRows = true
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: db, dialect: mysqlDialect{}}, nil
+}
+
+func (mysqlDialect) upsert(table string, cols, keys, update []string) string {
+	sets := make([]string, len(update))
+	for i, col := range update {
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", col, col)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+		table, strings.Join(cols, ", "), placeholders(len(cols)), strings.Join(sets, ", "))
+}
+
+func (mysqlDialect) isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func (mysqlDialect) bindArg(arg interface{}) interface{} {
+	return arg
+}
+
+func (mysqlDialect) name() string {
+	return "mysql"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Inscrições Web Push e chaves VAPID
+
+// Grava a inscrição; um endpoint já inscrito passa para o usuário atual
+// com as chaves novas
+func (s *sqlStore) SavePushSubscription(sub *PushSubscription) error {
+	sub.CreatedAt = time.Now()
+	query := s.dialect.upsert("push_subscriptions",
+		[]string{"user_id", "endpoint", "p256dh", "auth", "user_agent", "created_at"},
+		[]string{"endpoint"},
+		[]string{"user_id", "p256dh", "auth", "user_agent"})
+	if _, err := s.exec(query, sub.UserID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth, sub.UserAgent, sub.CreatedAt); err != nil {
+		return err
+	}
+	return s.queryRow("SELECT id, created_at FROM push_subscriptions WHERE endpoint = ?", sub.Endpoint).Scan(&sub.ID, &sub.CreatedAt)
+}
+
+func (s *sqlStore) ListPushSubscriptions(userID int) ([]PushSubscription, error) {
+	rows, err := s.query(`SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at, last_used_at
+		FROM push_subscriptions WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []PushSubscription
+	for rows.Next() {
+		var sub PushSubscription
+		var userAgent sql.NullString
+		var lastUsedAt sql.NullTime
+		err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.Keys.P256dh, &sub.Keys.Auth, &userAgent, &sub.CreatedAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sub.UserAgent = userAgent.String
+		if lastUsedAt.Valid {
+			sub.LastUsedAt = &lastUsedAt.Time
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s *sqlStore) DeletePushSubscription(userID, subscriptionID int) error {
+	return requireAffected(s.exec("DELETE FROM push_subscriptions WHERE id = ? AND user_id = ?", subscriptionID, userID))
+}
+
+func (s *sqlStore) DeletePushEndpoint(endpoint string) error {
+	_, err := s.exec("DELETE FROM push_subscriptions WHERE endpoint = ?", endpoint)
+	return err
+}
+
+func (s *sqlStore) TouchPushSubscription(subscriptionID int, at time.Time) error {
+	_, err := s.exec("UPDATE push_subscriptions SET last_used_at = ? WHERE id = ?", at, subscriptionID)
+	return err
+}
+
+func (s *sqlStore) GetVAPIDKeys() (publicKey, privateKey string, err error) {
+	err = s.queryRow("SELECT public_key, private_key FROM vapid_keys WHERE id = 1").Scan(&publicKey, &privateKey)
+	return publicKey, privateKey, notFound(err)
+}
+
+func (s *sqlStore) SaveVAPIDKeys(publicKey, privateKey string) error {
+	_, err := s.exec("INSERT INTO vapid_keys (id, public_key, private_key, created_at) VALUES (1, ?, ?, ?)",
+		publicKey, privateKey, time.Now())
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Hábitos com lembrete e registro dos lembretes enviados
+
+func (s *sqlStore) ListReminderHabits() ([]Habit, error) {
+	return s.listHabits("SELECT "+habitColumns+" FROM habits WHERE reminder_enabled = ? AND is_active = ? AND deleted_at IS NULL AND polarity <> ? ORDER BY user_id, id",
+		true, true, polarityQuit)
+}
+
+func (s *sqlStore) ClaimReminder(habitID int, day, at string) error {
+	_, err := s.exec("INSERT INTO reminder_deliveries (habit_id, day, reminder_time, sent_at) VALUES (?, ?, ?, ?)",
+		habitID, day, at, time.Now())
+	return err
+}
+
+func (s *sqlStore) ReleaseReminder(habitID int, day, at string) error {
+	_, err := s.exec("DELETE FROM reminder_deliveries WHERE habit_id = ? AND day = ? AND reminder_time = ?", habitID, day, at)
+	return err
+}
+
+const reminderDeliveryColumns = "habit_id, day, reminder_time, sent_at, snoozed_until, snooze_count"
+
+func scanReminderDelivery(row rowScanner) (*ReminderDelivery, error) {
+	var delivery ReminderDelivery
+	var snoozedUntil sql.NullTime
+	err := row.Scan(&delivery.HabitID, &delivery.Day, &delivery.ReminderTime, &delivery.SentAt, &snoozedUntil, &delivery.SnoozeCount)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if snoozedUntil.Valid {
+		delivery.SnoozedUntil = &snoozedUntil.Time
+	}
+	return &delivery, nil
+}
+
+func (s *sqlStore) GetReminderDelivery(habitID int, day, at string) (*ReminderDelivery, error) {
+	return scanReminderDelivery(s.queryRow("SELECT "+reminderDeliveryColumns+" FROM reminder_deliveries WHERE habit_id = ? AND day = ? AND reminder_time = ?",
+		habitID, day, at))
+}
+
+func (s *sqlStore) LatestReminderDelivery(habitID int, day string) (*ReminderDelivery, error) {
+	return scanReminderDelivery(s.queryRow("SELECT "+reminderDeliveryColumns+" FROM reminder_deliveries WHERE habit_id = ? AND day = ? ORDER BY reminder_time DESC LIMIT 1",
+		habitID, day))
+}
+
+func (s *sqlStore) SnoozeReminder(delivery *ReminderDelivery) error {
+	return requireAffected(s.exec("UPDATE reminder_deliveries SET snoozed_until = ?, snooze_count = ? WHERE habit_id = ? AND day = ? AND reminder_time = ?",
+		delivery.SnoozedUntil, delivery.SnoozeCount, delivery.HabitID, delivery.Day, delivery.ReminderTime))
+}
+
+func (s *sqlStore) ListDueSnoozes(now time.Time) ([]ReminderDelivery, error) {
+	rows, err := s.query("SELECT "+reminderDeliveryColumns+" FROM reminder_deliveries WHERE snoozed_until IS NOT NULL AND snoozed_until <= ? ORDER BY snoozed_until", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []ReminderDelivery
+	for rows.Next() {
+		delivery, err := scanReminderDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *sqlStore) ClaimSnooze(habitID int, day, at string, now time.Time) error {
+	return requireAffected(s.exec("UPDATE reminder_deliveries SET snoozed_until = NULL, sent_at = ? WHERE habit_id = ? AND day = ? AND reminder_time = ? AND snoozed_until IS NOT NULL AND snoozed_until <= ?",
+		now, habitID, day, at, now))
+}
+
+func (s *sqlStore) PruneReminderDeliveries(before string) (int64, error) {
+	result, err := s.exec("DELETE FROM reminder_deliveries WHERE day < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
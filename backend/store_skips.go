@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Dias pulados e congelados, pausas (modo férias) e congelamentos ganhos
+
+func (s *sqlStore) listSkips(query string, args ...interface{}) ([]HabitSkip, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var skips []HabitSkip
+	for rows.Next() {
+		var skip HabitSkip
+		if err := rows.Scan(&skip.HabitID, &skip.Date, &skip.Kind, &skip.CreatedAt); err != nil {
+			return nil, err
+		}
+		skips = append(skips, skip)
+	}
+	return skips, rows.Err()
+}
+
+func (s *sqlStore) ListSkips(habitID int) ([]HabitSkip, error) {
+	return s.listSkips("SELECT habit_id, day, kind, created_at FROM habit_skips WHERE habit_id = ? ORDER BY day DESC", habitID)
+}
+
+func (s *sqlStore) ListUserSkips(userID int) ([]HabitSkip, error) {
+	return s.listSkips(`SELECT hs.habit_id, hs.day, hs.kind, hs.created_at
+		FROM habit_skips hs
+		JOIN habits h ON h.id = hs.habit_id
+		WHERE h.user_id = ? AND h.deleted_at IS NULL`, userID)
+}
+
+// A contagem e o insert ficam na mesma transação, com a linha do usuário
+// travada: pedidos simultâneos não gastam o mesmo congelamento nem passam
+// do limite do mês
+func (s *sqlStore) CreateSkip(userID int, skip *HabitSkip) error {
+	day, err := time.Parse(dateLayout, skip.Date)
+	if err != nil {
+		return err
+	}
+	skip.CreatedAt = time.Now()
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := s.execOn(tx, "UPDATE users SET id = id WHERE id = ?", userID); err != nil {
+			return err
+		}
+
+		var available int
+		if skip.Kind == skipFreeze {
+			err = tx.QueryRow(`SELECT
+				(SELECT COUNT(*) FROM streak_freeze_awards WHERE user_id = ?) -
+				(SELECT COUNT(*) FROM habit_skips hs JOIN habits h ON h.id = hs.habit_id WHERE h.user_id = ? AND hs.kind = ?)`,
+				s.bind([]interface{}{userID, userID, skipFreeze})...).Scan(&available)
+		} else {
+			first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+			var used int
+			err = tx.QueryRow("SELECT COUNT(*) FROM habit_skips WHERE habit_id = ? AND kind = ? AND day >= ? AND day < ?",
+				s.bind([]interface{}{skip.HabitID, skipSkip, first.Format(dateLayout), first.AddDate(0, 1, 0).Format(dateLayout)})...).Scan(&used)
+			available = maxSkipsPerMonth - used
+		}
+		if err != nil {
+			return err
+		}
+		if available <= 0 {
+			return ErrLimit
+		}
+
+		_, err = s.execOn(tx, "INSERT INTO habit_skips (habit_id, day, kind, created_at) VALUES (?, ?, ?, ?)",
+			skip.HabitID, skip.Date, skip.Kind, skip.CreatedAt)
+		return err
+	})
+}
+
+func (s *sqlStore) DeleteSkip(habitID int, day string) error {
+	return requireAffected(s.exec("DELETE FROM habit_skips WHERE habit_id = ? AND day = ?", habitID, day))
+}
+
+func (s *sqlStore) ListPauses(userID int) ([]Pause, error) {
+	rows, err := s.query("SELECT id, user_id, start_date, end_date, all_habits, reason, created_at FROM pauses WHERE user_id = ? ORDER BY start_date DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pauses []Pause
+	byID := map[int]int{}
+	for rows.Next() {
+		var pause Pause
+		var reason sql.NullString
+		if err := rows.Scan(&pause.ID, &pause.UserID, &pause.StartDate, &pause.EndDate, &pause.AllHabits, &reason, &pause.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pause.Reason = reason.String
+		pause.HabitIDs = []int{}
+		byID[pause.ID] = len(pauses)
+		pauses = append(pauses, pause)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.query(`SELECT ph.pause_id, ph.habit_id
+		FROM pause_habits ph
+		JOIN pauses p ON p.id = ph.pause_id
+		WHERE p.user_id = ?
+		ORDER BY ph.habit_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pauseID, habitID int
+		if err := rows.Scan(&pauseID, &habitID); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[pauseID]; ok {
+			pauses[i].HabitIDs = append(pauses[i].HabitIDs, habitID)
+		}
+	}
+	return pauses, rows.Err()
+}
+
+func (s *sqlStore) CreatePause(pause *Pause) error {
+	pause.CreatedAt = time.Now()
+	return s.withTx(func(tx *sql.Tx) error {
+		return s.insertPause(tx, pause)
+	})
+}
+
+func (s *sqlStore) insertPause(ex sqlExecutor, pause *Pause) error {
+	if pause.CreatedAt.IsZero() {
+		pause.CreatedAt = time.Now()
+	}
+	id, err := s.insert(ex, "INSERT INTO pauses (user_id, start_date, end_date, all_habits, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		pause.UserID, pause.StartDate, pause.EndDate, pause.AllHabits, pause.Reason, pause.CreatedAt)
+	if err != nil {
+		return err
+	}
+	pause.ID = id
+
+	for _, habitID := range pause.HabitIDs {
+		if _, err := s.execOn(ex, "INSERT INTO pause_habits (pause_id, habit_id) VALUES (?, ?)", id, habitID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) DeletePause(userID, pauseID int) error {
+	return requireAffected(s.exec("DELETE FROM pauses WHERE id = ? AND user_id = ?", pauseID, userID))
+}
+
+// Encerra a pausa em endDate, mantendo os dias já cobertos
+func (s *sqlStore) EndPause(userID, pauseID int, endDate string) error {
+	return requireAffected(s.exec("UPDATE pauses SET end_date = ? WHERE id = ? AND user_id = ?", endDate, pauseID, userID))
+}
+
+func (s *sqlStore) AwardStreakFreeze(userID, habitID int, day string, streak int) error {
+	_, err := s.exec("INSERT INTO streak_freeze_awards (user_id, habit_id, day, streak, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, habitID, day, streak, time.Now())
+	return err
+}
+
+func (s *sqlStore) StreakFreezeCounts(userID int) (earned, used int, err error) {
+	err = s.queryRow("SELECT COUNT(*) FROM streak_freeze_awards WHERE user_id = ?", userID).Scan(&earned)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = s.queryRow(`SELECT COUNT(*) FROM habit_skips hs
+		JOIN habits h ON h.id = hs.habit_id
+		WHERE h.user_id = ? AND hs.kind = ?`, userID, skipFreeze).Scan(&used)
+	return earned, used, err
+}
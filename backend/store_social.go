@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Amizades, feed de atividades, reações e comentários
+
+const friendshipColumns = "id, user_id, friend_id, status, created_at, updated_at"
+
+func scanFriendship(row rowScanner) (*Friendship, error) {
+	var f Friendship
+	if err := row.Scan(&f.ID, &f.UserID, &f.FriendID, &f.Status, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *sqlStore) GetFriendship(id int) (*Friendship, error) {
+	f, err := scanFriendship(s.queryRow("SELECT "+friendshipColumns+" FROM friendships WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return f, nil
+}
+
+// Busca uma amizade entre os dois usuários, em qualquer direção
+func (s *sqlStore) FindFriendship(userID, otherID int) (*Friendship, error) {
+	f, err := scanFriendship(s.queryRow("SELECT "+friendshipColumns+" FROM friendships WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
+		userID, otherID, otherID, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return f, nil
+}
+
+func (s *sqlStore) CreateFriendship(friendship *Friendship) error {
+	now := time.Now()
+	id, err := s.insert(s.db, "INSERT INTO friendships (user_id, friend_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		friendship.UserID, friendship.FriendID, friendship.Status, now, now)
+	if err != nil {
+		return err
+	}
+	friendship.ID = id
+	friendship.CreatedAt = now
+	friendship.UpdatedAt = now
+	return nil
+}
+
+func (s *sqlStore) UpdateFriendshipStatus(id int, status string) error {
+	return requireAffected(s.exec("UPDATE friendships SET status = ?, updated_at = ? WHERE id = ?", status, time.Now(), id))
+}
+
+func (s *sqlStore) DeleteFriendship(id int) error {
+	return requireAffected(s.exec("DELETE FROM friendships WHERE id = ?", id))
+}
+
+func (s *sqlStore) ListFriends(userID int) ([]Friendship, error) {
+	query := `
+		SELECT f.id, f.user_id, f.friend_id, f.status, f.created_at, f.updated_at,
+			   u.id, u.username, u.email
+		FROM friendships f
+		JOIN users u ON (CASE WHEN f.user_id = ? THEN u.id = f.friend_id ELSE u.id = f.user_id END)
+		WHERE (f.user_id = ? OR f.friend_id = ?) AND f.status = 'accepted'
+		ORDER BY u.username
+	`
+	rows, err := s.query(query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var friends []Friendship
+	for rows.Next() {
+		var f Friendship
+		var u User
+		err := rows.Scan(&f.ID, &f.UserID, &f.FriendID, &f.Status, &f.CreatedAt, &f.UpdatedAt,
+			&u.ID, &u.Username, &u.Email)
+		if err != nil {
+			return nil, err
+		}
+		f.Friend = &u
+		friends = append(friends, f)
+	}
+	return friends, rows.Err()
+}
+
+// Solicitações pendentes recebidas (que o usuário pode aceitar) e enviadas
+func (s *sqlStore) ListFriendRequests(userID int) ([]PendingFriendRequest, error) {
+	query := `
+		SELECT f.id, f.user_id, f.friend_id, f.status, f.created_at, f.updated_at,
+			   u.id, u.username, u.email, 'received' as request_type
+		FROM friendships f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.friend_id = ? AND f.status = 'pending'
+		UNION
+		SELECT f.id, f.user_id, f.friend_id, f.status, f.created_at, f.updated_at,
+			   u.id, u.username, u.email, 'sent' as request_type
+		FROM friendships f
+		JOIN users u ON u.id = f.friend_id
+		WHERE f.user_id = ? AND f.status = 'pending'
+		ORDER BY created_at DESC
+	`
+	rows, err := s.query(query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []PendingFriendRequest
+	for rows.Next() {
+		var req PendingFriendRequest
+		var u User
+		err := rows.Scan(&req.ID, &req.UserID, &req.FriendID, &req.Status, &req.CreatedAt, &req.UpdatedAt,
+			&u.ID, &u.Username, &u.Email, &req.Type)
+		if err != nil {
+			return nil, err
+		}
+		req.Friend = &u
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+func (s *sqlStore) CreateActivity(activity *ActivityFeed) error {
+	return s.insertActivity(s.db, activity)
+}
+
+func (s *sqlStore) insertActivity(ex sqlExecutor, activity *ActivityFeed) error {
+	metadataJSON, _ := json.Marshal(activity.Metadata)
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+	id, err := s.insert(ex, `
+		INSERT INTO activity_feeds (user_id, activity_type, habit_id, goal_completion_id, challenge_id, metadata, visibility, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, activity.UserID, activity.ActivityType, activity.HabitID, activity.GoalCompletionID, activity.ChallengeID,
+		string(metadataJSON), activity.Visibility, activity.CreatedAt)
+	if err != nil {
+		return err
+	}
+	activity.ID = id
+	return nil
+}
+
+func (s *sqlStore) GetActivity(id int) (*ActivityFeed, error) {
+	var af ActivityFeed
+	err := s.queryRow("SELECT id, user_id, activity_type, visibility, created_at FROM activity_feeds WHERE id = ?", id).
+		Scan(&af.ID, &af.UserID, &af.ActivityType, &af.Visibility, &af.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &af, nil
+}
+
+// Atividades do usuário e dos amigos, com contagem de reações e comentários
+func (s *sqlStore) ListFeed(userID, limit, offset int) ([]ActivityFeed, error) {
+	query := `
+		SELECT DISTINCT af.id, af.user_id, af.activity_type, af.habit_id, af.goal_completion_id,
+			   af.challenge_id, af.metadata, af.visibility, af.created_at,
+			   u.id, u.username, u.email,
+			   h.id, h.name, h.icon,
+			   c.id, c.name, c.habit_name
+		FROM activity_feeds af
+		JOIN users u ON u.id = af.user_id
+		LEFT JOIN habits h ON h.id = af.habit_id
+		LEFT JOIN challenges c ON c.id = af.challenge_id
+		WHERE (af.user_id = ? OR af.user_id IN (
+			SELECT CASE WHEN f.user_id = ? THEN f.friend_id ELSE f.user_id END
+			FROM friendships f
+			WHERE (f.user_id = ? OR f.friend_id = ?) AND f.status = 'accepted'
+		)) AND af.visibility IN ('public', 'friends')
+		AND (af.habit_id IS NULL OR (h.visibility != 'private' AND h.deleted_at IS NULL))
+		ORDER BY af.created_at DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.query(query, userID, userID, userID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var activities []ActivityFeed
+	for rows.Next() {
+		var af ActivityFeed
+		var u User
+		var metadataJSON []byte
+		var habitID, challengeID sql.NullInt64
+		var habitName, habitIcon, challengeName, challengeHabitName sql.NullString
+
+		err := rows.Scan(&af.ID, &af.UserID, &af.ActivityType, &af.HabitID, &af.GoalCompletionID,
+			&af.ChallengeID, &metadataJSON, &af.Visibility, &af.CreatedAt,
+			&u.ID, &u.Username, &u.Email,
+			&habitID, &habitName, &habitIcon,
+			&challengeID, &challengeName, &challengeHabitName)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if len(metadataJSON) > 0 {
+			json.Unmarshal(metadataJSON, &af.Metadata)
+		}
+		af.User = &u
+
+		// Adicionar hábito se existir
+		if habitID.Valid {
+			af.Habit = &Habit{ID: int(habitID.Int64), Name: habitName.String, Icon: habitIcon.String}
+		}
+
+		// Adicionar desafio se existir
+		if challengeID.Valid {
+			af.Challenge = &Challenge{ID: int(challengeID.Int64), Name: challengeName.String, HabitName: challengeHabitName.String}
+		}
+
+		activities = append(activities, af)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Reações e comentários; feito depois de fechar rows porque o SQLite
+	// trabalha com uma única conexão
+	for i := range activities {
+		af := &activities[i]
+		af.ReactionCount = make(map[string]int)
+
+		reactionRows, err := s.query("SELECT reaction_type, COUNT(*) FROM activity_reactions WHERE activity_id = ? GROUP BY reaction_type", af.ID)
+		if err == nil {
+			for reactionRows.Next() {
+				var reactionType string
+				var count int
+				reactionRows.Scan(&reactionType, &count)
+				af.ReactionCount[reactionType] = count
+			}
+			reactionRows.Close()
+		}
+
+		// Verificar reação do usuário atual
+		var userReaction sql.NullString
+		s.queryRow("SELECT reaction_type FROM activity_reactions WHERE activity_id = ? AND user_id = ?",
+			af.ID, userID).Scan(&userReaction)
+		if userReaction.Valid {
+			af.UserReaction = &userReaction.String
+		}
+
+		s.queryRow("SELECT COUNT(*) FROM activity_comments WHERE activity_id = ?", af.ID).Scan(&af.CommentCount)
+	}
+
+	return activities, nil
+}
+
+// Insere ou atualiza a reação do usuário
+func (s *sqlStore) SetReaction(activityID, userID int, reactionType string) error {
+	query := s.dialect.upsert("activity_reactions",
+		[]string{"activity_id", "user_id", "reaction_type", "created_at"},
+		[]string{"activity_id", "user_id"},
+		[]string{"reaction_type", "created_at"})
+	_, err := s.exec(query, activityID, userID, reactionType, time.Now())
+	return err
+}
+
+func (s *sqlStore) DeleteReaction(activityID, userID int) error {
+	_, err := s.exec("DELETE FROM activity_reactions WHERE activity_id = ? AND user_id = ?", activityID, userID)
+	return err
+}
+
+const commentQuery = `
+	SELECT ac.id, ac.activity_id, ac.user_id, ac.comment, ac.created_at,
+		   u.id, u.username, u.email
+	FROM activity_comments ac
+	JOIN users u ON u.id = ac.user_id
+`
+
+func scanComment(row rowScanner) (*ActivityComment, error) {
+	var comment ActivityComment
+	var user User
+	err := row.Scan(&comment.ID, &comment.ActivityID, &comment.UserID, &comment.Comment, &comment.CreatedAt,
+		&user.ID, &user.Username, &user.Email)
+	if err != nil {
+		return nil, err
+	}
+	comment.User = &user
+	return &comment, nil
+}
+
+// Insere o comentário e o recarrega com os dados do autor
+func (s *sqlStore) CreateComment(comment *ActivityComment) error {
+	id, err := s.insert(s.db, "INSERT INTO activity_comments (activity_id, user_id, comment, created_at) VALUES (?, ?, ?, ?)",
+		comment.ActivityID, comment.UserID, comment.Comment, time.Now())
+	if err != nil {
+		return err
+	}
+
+	created, err := scanComment(s.queryRow(commentQuery+"WHERE ac.id = ?", id))
+	if err != nil {
+		return err
+	}
+	*comment = *created
+	return nil
+}
+
+func (s *sqlStore) ListComments(activityID int) ([]ActivityComment, error) {
+	rows, err := s.query(commentQuery+"WHERE ac.activity_id = ? ORDER BY ac.created_at ASC", activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []ActivityComment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, *comment)
+	}
+	return comments, rows.Err()
+}
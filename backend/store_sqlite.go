@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Formato usado pelo CURRENT_TIMESTAMP do SQLite; gravar todos os horários
+// assim (em UTC) mantém as comparações de texto corretas
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+type sqliteDialect struct{}
+
+func newSQLiteStore(dsn string) (*sqlStore, error) {
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_foreign_keys=on&_busy_timeout=5000"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite aceita um único escritor por vez
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: db, dialect: sqliteDialect{}}, nil
+}
+
+func (sqliteDialect) upsert(table string, cols, keys, update []string) string {
+	sets := make([]string, len(update))
+	for i, col := range update {
+		sets[i] = fmt.Sprintf("%s = excluded.%s", col, col)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		table, strings.Join(cols, ", "), placeholders(len(cols)), strings.Join(keys, ", "), strings.Join(sets, ", "))
+}
+
+func (sqliteDialect) isDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) bindArg(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case time.Time:
+		return v.UTC().Format(sqliteTimeFormat)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC().Format(sqliteTimeFormat)
+	}
+	return arg
+}
+
+func (sqliteDialect) name() string {
+	return "sqlite"
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Etiquetas dos hábitos, ordem da lista e filtros salvos
+
+// Etiquetas por hábito, em ordem alfabética
+func (s *sqlStore) habitTags(query string, args ...interface{}) (map[int][]string, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int][]string{}
+	for rows.Next() {
+		var habitID int
+		var name string
+		if err := rows.Scan(&habitID, &name); err != nil {
+			return nil, err
+		}
+		tags[habitID] = append(tags[habitID], name)
+	}
+	return tags, rows.Err()
+}
+
+// Preenche Tags dos hábitos do usuário
+func (s *sqlStore) attachTags(userID int, habits []Habit) error {
+	if len(habits) == 0 {
+		return nil
+	}
+	tags, err := s.habitTags(`SELECT ht.habit_id, t.name FROM habit_tags ht
+		JOIN tags t ON t.id = ht.tag_id
+		WHERE t.user_id = ? ORDER BY t.name`, userID)
+	if err != nil {
+		return err
+	}
+	for i := range habits {
+		habits[i].Tags = tags[habits[i].ID]
+		if habits[i].Tags == nil {
+			habits[i].Tags = []string{}
+		}
+	}
+	return nil
+}
+
+// Troca as etiquetas do hábito, criando as que o usuário ainda não tem
+func (s *sqlStore) setHabitTags(ex sqlExecutor, userID, habitID int, tags []string) error {
+	if _, err := s.execOn(ex, "DELETE FROM habit_tags WHERE habit_id = ?", habitID); err != nil {
+		return err
+	}
+	for _, name := range tags {
+		var tagID int
+		err := ex.QueryRow("SELECT id FROM tags WHERE user_id = ? AND name = ?", s.bind([]interface{}{userID, name})...).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			tagID, err = s.insert(ex, "INSERT INTO tags (user_id, name, created_at) VALUES (?, ?, ?)", userID, name, time.Now())
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := s.execOn(ex, "INSERT INTO habit_tags (habit_id, tag_id) VALUES (?, ?)", habitID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Etiquetas do usuário com o número de hábitos (não removidos) de cada uma
+func (s *sqlStore) ListTags(userID int) ([]Tag, error) {
+	rows, err := s.query(`
+		SELECT t.id, t.name, t.created_at, COUNT(h.id)
+		FROM tags t
+		LEFT JOIN habit_tags ht ON ht.tag_id = t.id
+		LEFT JOIN habits h ON h.id = ht.habit_id AND h.deleted_at IS NULL
+		WHERE t.user_id = ?
+		GROUP BY t.id, t.name, t.created_at
+		ORDER BY t.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.HabitCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *sqlStore) RenameTag(userID, tagID int, name string) error {
+	return requireAffected(s.exec("UPDATE tags SET name = ? WHERE id = ? AND user_id = ?", name, tagID, userID))
+}
+
+// Remove a etiqueta de todos os hábitos
+func (s *sqlStore) DeleteTag(userID, tagID int) error {
+	return requireAffected(s.exec("DELETE FROM tags WHERE id = ? AND user_id = ?", tagID, userID))
+}
+
+// sort_order segue a posição em habitIDs
+func (s *sqlStore) ReorderHabits(userID int, habitIDs []int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		for i, habitID := range habitIDs {
+			err := requireAffected(s.execOn(tx, "UPDATE habits SET sort_order = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+				i, habitID, userID))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func scanHabitView(row rowScanner) (*HabitView, error) {
+	var view HabitView
+	var filters string
+	if err := row.Scan(&view.ID, &view.UserID, &view.Name, &filters, &view.CreatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	json.Unmarshal([]byte(filters), &view.Filters)
+	return &view, nil
+}
+
+func (s *sqlStore) ListHabitViews(userID int) ([]HabitView, error) {
+	rows, err := s.query("SELECT id, user_id, name, filters, created_at FROM habit_views WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []HabitView
+	for rows.Next() {
+		view, err := scanHabitView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, *view)
+	}
+	return views, rows.Err()
+}
+
+func (s *sqlStore) GetHabitView(userID, viewID int) (*HabitView, error) {
+	return scanHabitView(s.queryRow("SELECT id, user_id, name, filters, created_at FROM habit_views WHERE id = ? AND user_id = ?", viewID, userID))
+}
+
+func (s *sqlStore) CreateHabitView(view *HabitView) error {
+	filters, err := json.Marshal(view.Filters)
+	if err != nil {
+		return err
+	}
+	view.CreatedAt = time.Now()
+	id, err := s.insert(s.db, "INSERT INTO habit_views (user_id, name, filters, created_at) VALUES (?, ?, ?, ?)",
+		view.UserID, view.Name, string(filters), view.CreatedAt)
+	if err != nil {
+		return err
+	}
+	view.ID = id
+	return nil
+}
+
+func (s *sqlStore) UpdateHabitView(view *HabitView) error {
+	filters, err := json.Marshal(view.Filters)
+	if err != nil {
+		return err
+	}
+	return requireAffected(s.exec("UPDATE habit_views SET name = ?, filters = ? WHERE id = ? AND user_id = ?",
+		view.Name, string(filters), view.ID, view.UserID))
+}
+
+func (s *sqlStore) DeleteHabitView(userID, viewID int) error {
+	return requireAffected(s.exec("DELETE FROM habit_views WHERE id = ? AND user_id = ?", viewID, userID))
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Etiquetas (várias por hábito, além da categoria única), ordem manual da
+// lista de hábitos e filtros de getHabits, que podem ser salvos com um
+// nome (habit_views) e reaplicados com ?view={id}.
+
+const (
+	maxHabitTags      = 20
+	maxTagLength      = 50
+	maxViewNameLength = 100
+)
+
+type Tag struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	HabitCount int       `json:"habit_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Filtros de getHabits; campos vazios não filtram
+type HabitFilter struct {
+	Tag        string `json:"tag,omitempty"`
+	Category   string `json:"category,omitempty"`
+	Archived   string `json:"archived,omitempty"` // "" só ativos, "true" só arquivados, "all" todos
+	DueToday   bool   `json:"due_today,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+type HabitView struct {
+	ID        int         `json:"id"`
+	UserID    int         `json:"user_id"`
+	Name      string      `json:"name"`
+	Filters   HabitFilter `json:"filters"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type ReorderHabitsRequest struct {
+	HabitIDs []int `json:"habit_ids"`
+}
+
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", errors.New("Tag names must not be empty")
+	}
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return "", fmt.Errorf("Tag names must be at most %d characters", maxTagLength)
+	}
+	return name, nil
+}
+
+// Etiquetas em minúsculas, sem repetição e em ordem alfabética; os erros
+// vão para o campo tags da validação do hábito
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		name, err := normalizeTag(tag)
+		if err != nil {
+			if strings.TrimSpace(tag) == "" {
+				return nil, fieldError("tags", "required", "Nomes de etiquetas não podem ser vazios")
+			}
+			return nil, fieldError("tags", "too_long", fmt.Sprintf("Etiquetas devem ter no máximo %d caracteres", maxTagLength))
+		}
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	if len(normalized) > maxHabitTags {
+		return nil, fieldError("tags", "too_many", fmt.Sprintf("Um hábito pode ter no máximo %d etiquetas", maxHabitTags))
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func (f *HabitFilter) normalize() error {
+	if f.Archived == "false" {
+		f.Archived = ""
+	}
+	switch f.Archived {
+	case "", "true", "all":
+	default:
+		return errors.New("archived must be true, false or all")
+	}
+	switch f.Visibility {
+	case "", "public", "private", "friends":
+	default:
+		return errors.New("visibility must be public, private or friends")
+	}
+	if f.Tag != "" {
+		tag, err := normalizeTag(f.Tag)
+		if err != nil {
+			return err
+		}
+		f.Tag = tag
+	}
+	f.Category = strings.TrimSpace(f.Category)
+	return nil
+}
+
+// Aplica os parâmetros da query sobre f (os filtros de um view salvo);
+// active=false equivale a archived=true
+func (f *HabitFilter) override(query url.Values) error {
+	if query.Has("tag") {
+		f.Tag = query.Get("tag")
+	}
+	if query.Has("category") {
+		f.Category = query.Get("category")
+	}
+	if query.Has("archived") {
+		f.Archived = query.Get("archived")
+	}
+	if query.Has("active") {
+		switch query.Get("active") {
+		case "true":
+			f.Archived = ""
+		case "false":
+			f.Archived = "true"
+		default:
+			return errors.New("active must be true or false")
+		}
+	}
+	if query.Has("due_today") {
+		due, err := strconv.ParseBool(query.Get("due_today"))
+		if err != nil {
+			return errors.New("due_today must be true or false")
+		}
+		f.DueToday = due
+	}
+	if query.Has("visibility") {
+		f.Visibility = query.Get("visibility")
+	}
+	return f.normalize()
+}
+
+func (f HabitFilter) matches(habit *Habit) bool {
+	if f.Archived != "all" && (f.Archived == "true") == habit.IsActive {
+		return false
+	}
+	if f.Category != "" && !strings.EqualFold(habit.Category, f.Category) {
+		return false
+	}
+	if f.Visibility != "" && habit.Visibility != f.Visibility {
+		return false
+	}
+	if f.Tag != "" {
+		tagged := false
+		for _, tag := range habit.Tags {
+			tagged = tagged || tag == f.Tag
+		}
+		if !tagged {
+			return false
+		}
+	}
+	return true
+}
+
+func (f HabitFilter) apply(userID int, habits []Habit) ([]Habit, error) {
+	var cal Calendar
+	var ex *Excuses
+	if f.DueToday {
+		cal, ex = userCalendar(userID), userExcuses(userID)
+	}
+
+	filtered := []Habit{}
+	for i := range habits {
+		habit := &habits[i]
+		if !f.matches(habit) {
+			continue
+		}
+		if f.DueToday {
+			due, err := habitDueToday(habit, cal, ex)
+			if err != nil {
+				return nil, err
+			}
+			if !due {
+				continue
+			}
+		}
+		filtered = append(filtered, *habit)
+	}
+	return filtered, nil
+}
+
+// Hábito ativo previsto para hoje e não dispensado; nos tipos por
+// frequência, enquanto a meta do período não foi cumprida
+func habitDueToday(habit *Habit, cal Calendar, ex *Excuses) (bool, error) {
+	return habitDueOn(habit, cal.today(), cal, ex)
+}
+
+// Como habitDueToday, para o dia local day
+func habitDueOn(habit *Habit, day time.Time, cal Calendar, ex *Excuses) (bool, error) {
+	if !habit.IsActive || habit.isQuit() || ex.habit(habit.ID).has(day) || day.Before(cal.day(habit.CreatedAt)) {
+		return false, nil
+	}
+	if !habit.Schedule.isFrequency() {
+		return habit.Schedule.isDue(day), nil
+	}
+
+	first, next := cal.bounds(habit.Schedule.periodUnit(), day)
+	done, err := store.CountEntries(habit.ID, dayStart(first, cal.Loc), dayStart(next, cal.Loc).Add(-time.Second))
+	if err != nil {
+		return false, err
+	}
+	return done < habit.Schedule.Times, nil
+}
+
+// Filtros de ?view={id} sobrepostos pelos demais parâmetros
+func habitFilterFromRequest(w http.ResponseWriter, r *http.Request) (HabitFilter, bool) {
+	var filter HabitFilter
+	query := r.URL.Query()
+	if query.Has("view") {
+		viewID, err := strconv.Atoi(query.Get("view"))
+		if err != nil {
+			http.Error(w, "Invalid view ID", http.StatusBadRequest)
+			return filter, false
+		}
+		view, err := store.GetHabitView(getUserID(r), viewID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				http.Error(w, "View not found", http.StatusNotFound)
+				return filter, false
+			}
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return filter, false
+		}
+		filter = view.Filters
+	}
+
+	if err := filter.override(query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filter, false
+	}
+	return filter, true
+}
+
+// Nova ordem da lista: os hábitos de habit_ids primeiro, nessa ordem, e os
+// demais depois, na ordem em que já estavam
+func reorderHabits(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	var req ReorderHabitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.HabitIDs) == 0 {
+		http.Error(w, "habit_ids must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	habits, err := store.ListHabits(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	owned := map[int]bool{}
+	for _, habit := range habits {
+		owned[habit.ID] = true
+	}
+
+	listed := map[int]bool{}
+	order := []int{}
+	for _, habitID := range req.HabitIDs {
+		if !owned[habitID] {
+			http.Error(w, fmt.Sprintf("Habit %d not found", habitID), http.StatusBadRequest)
+			return
+		}
+		if listed[habitID] {
+			http.Error(w, fmt.Sprintf("Habit %d is listed more than once", habitID), http.StatusBadRequest)
+			return
+		}
+		listed[habitID] = true
+		order = append(order, habitID)
+	}
+	for _, habit := range habits {
+		if !listed[habit.ID] {
+			order = append(order, habit.ID)
+		}
+	}
+
+	if err := store.ReorderHabits(userID, order); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error reordering habits", http.StatusInternalServerError)
+		return
+	}
+
+	habits, err = store.ListHabits(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(habits)
+}
+
+func getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := store.ListTags(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if tags == nil {
+		tags = []Tag{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// Renomeia a etiqueta em todos os hábitos
+func updateTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var tag Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	name, err := normalizeTag(tag.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := store.RenameTag(getUserID(r), tagID, name); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrDuplicate) {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error updating tag", http.StatusInternalServerError)
+		return
+	}
+
+	tags, err := store.ListTags(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for _, tag := range tags {
+		if tag.ID == tagID {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tag)
+			return
+		}
+	}
+	http.Error(w, "Tag not found", http.StatusNotFound)
+}
+
+func deleteTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.DeleteTag(getUserID(r), tagID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getHabitViews(w http.ResponseWriter, r *http.Request) {
+	views, err := store.ListHabitViews(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if views == nil {
+		views = []HabitView{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func decodeHabitView(w http.ResponseWriter, r *http.Request) (*HabitView, bool) {
+	var view HabitView
+	if err := json.NewDecoder(r.Body).Decode(&view); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return nil, false
+	}
+	view.Name = strings.TrimSpace(view.Name)
+	if view.Name == "" || utf8.RuneCountInString(view.Name) > maxViewNameLength {
+		http.Error(w, fmt.Sprintf("Name is required and must be at most %d characters", maxViewNameLength), http.StatusBadRequest)
+		return nil, false
+	}
+	if err := view.Filters.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	view.UserID = getUserID(r)
+	return &view, true
+}
+
+func createHabitView(w http.ResponseWriter, r *http.Request) {
+	view, ok := decodeHabitView(w, r)
+	if !ok {
+		return
+	}
+
+	if err := store.CreateHabitView(view); err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			http.Error(w, "A view with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error creating view", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+func updateHabitView(w http.ResponseWriter, r *http.Request) {
+	viewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return
+	}
+	view, ok := decodeHabitView(w, r)
+	if !ok {
+		return
+	}
+
+	view.ID = viewID
+	if err := store.UpdateHabitView(view); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "View not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrDuplicate) {
+			http.Error(w, "A view with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error updating view", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := store.GetHabitView(view.UserID, viewID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func deleteHabitView(w http.ResponseWriter, r *http.Request) {
+	viewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.DeleteHabitView(getUserID(r), viewID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "View not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting view", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
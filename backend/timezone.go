@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Fuso horário do usuário. Os limites de dia, semana e mês (streaks, metas,
+// analytics e datas de desafios) são calculados na hora local dele. Um dia
+// é representado pela meia-noite UTC da data local: assim AddDate e Weekday
+// funcionam sem surpresas nas trocas de horário de verão, e dayStart volta
+// para o instante real em que o dia começa no fuso.
+
+var locations sync.Map // nome do fuso → *time.Location
+
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Unknown time zone %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+func userLocation(userID int) *time.Location {
+	user, err := store.GetUser(userID)
+	if err != nil {
+		return time.UTC
+	}
+	return loadLocation(user.Timezone)
+}
+
+// Data local de t no fuso, como meia-noite UTC
+func entryDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Instante em que o dia (meia-noite UTC da data local) começa no fuso. Num
+// dia com horário de verão começando à meia-noite, é a primeira hora válida.
+func dayStart(day time.Time, loc *time.Location) time.Time {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	for entryDay(start, loc).Before(day) {
+		start = start.Add(time.Hour)
+	}
+	return start
+}
+
+func localToday(loc *time.Location) time.Time {
+	return entryDay(time.Now(), loc)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func date(s string) time.Time {
+	day, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return day
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// São Paulo teve horário de verão até 2019: começava à meia-noite (o dia
+// pulava de 23:59 para 01:00) e terminava à meia-noite (23:00 se repetia).
+// Berlim troca às 02:00/03:00, longe da meia-noite.
+
+func TestEntryDay(t *testing.T) {
+	saoPaulo := mustLoad(t, "America/Sao_Paulo")
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	tests := []struct {
+		name string
+		t    string
+		loc  *time.Location
+		want string
+	}{
+		{"sp before spring forward", "2018-11-04T02:59:59Z", saoPaulo, "2018-11-03"},
+		{"sp first instant after spring forward", "2018-11-04T03:00:00Z", saoPaulo, "2018-11-04"},
+		{"sp last minute before fall back", "2019-02-17T01:59:00Z", saoPaulo, "2019-02-16"},
+		{"sp repeated hour after fall back", "2019-02-17T02:30:00Z", saoPaulo, "2019-02-16"},
+		{"sp midnight after fall back", "2019-02-17T03:00:00Z", saoPaulo, "2019-02-17"},
+		{"berlin just before midnight, winter time", "2024-03-30T22:59:59Z", berlin, "2024-03-30"},
+		{"berlin midnight, winter time", "2024-03-30T23:00:00Z", berlin, "2024-03-31"},
+		{"berlin midnight, summer time", "2024-03-31T22:00:00Z", berlin, "2024-04-01"},
+		{"berlin midnight before fall back", "2024-10-26T22:00:00Z", berlin, "2024-10-27"},
+		{"berlin late on the 25-hour day", "2024-10-27T22:59:59Z", berlin, "2024-10-27"},
+		{"berlin midnight after fall back", "2024-10-27T23:00:00Z", berlin, "2024-10-28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := entryDay(utc(tt.t), tt.loc)
+			if !got.Equal(date(tt.want)) {
+				t.Errorf("entryDay(%s) = %s, want %s", tt.t, got.Format(dateLayout), tt.want)
+			}
+		})
+	}
+}
+
+func TestDayStart(t *testing.T) {
+	saoPaulo := mustLoad(t, "America/Sao_Paulo")
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	tests := []struct {
+		name string
+		day  string
+		loc  *time.Location
+		want string
+	}{
+		{"sp day before spring forward", "2018-11-03", saoPaulo, "2018-11-03T03:00:00Z"},
+		// Meia-noite não existe: o dia começa à 01:00 (-02)
+		{"sp spring forward day", "2018-11-04", saoPaulo, "2018-11-04T03:00:00Z"},
+		{"sp day after spring forward", "2018-11-05", saoPaulo, "2018-11-05T02:00:00Z"},
+		{"sp day before fall back", "2019-02-16", saoPaulo, "2019-02-16T02:00:00Z"},
+		{"sp fall back day", "2019-02-17", saoPaulo, "2019-02-17T03:00:00Z"},
+		{"berlin spring forward day", "2024-03-31", berlin, "2024-03-30T23:00:00Z"},
+		{"berlin day after spring forward", "2024-04-01", berlin, "2024-03-31T22:00:00Z"},
+		{"berlin fall back day", "2024-10-27", berlin, "2024-10-26T22:00:00Z"},
+		{"berlin day after fall back", "2024-10-28", berlin, "2024-10-27T23:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dayStart(date(tt.day), tt.loc)
+			if !got.Equal(utc(tt.want)) {
+				t.Errorf("dayStart(%s) = %s, want %s", tt.day, got.UTC().Format(time.RFC3339), tt.want)
+			}
+			if back := entryDay(got, tt.loc); !back.Equal(date(tt.day)) {
+				t.Errorf("entryDay(dayStart(%s)) = %s", tt.day, back.Format(dateLayout))
+			}
+		})
+	}
+}
+
+// Streaks diários com entradas perto da meia-noite local, dos dois lados
+// das trocas de horário; times vem da mais recente para a mais antiga,
+// como em EntryTimes
+func TestDailyStreaksAcrossDST(t *testing.T) {
+	saoPaulo := mustLoad(t, "America/Sao_Paulo")
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	tests := []struct {
+		name    string
+		loc     *time.Location
+		times   []string
+		today   string
+		current int
+		longest int
+	}{
+		{
+			name: "sp spring forward, 23:50 every night",
+			loc:  saoPaulo,
+			times: []string{
+				"2018-11-07T01:50:00Z", // 06/11 23:50 -02
+				"2018-11-06T01:50:00Z",
+				"2018-11-05T01:50:00Z", // 04/11, o dia de 23 horas
+				"2018-11-04T02:50:00Z", // 03/11 23:50 -03
+				"2018-11-03T02:50:00Z",
+				"2018-11-02T02:50:00Z",
+			},
+			today:   "2018-11-06",
+			current: 6,
+			longest: 6,
+		},
+		{
+			name: "sp fall back, entry in the repeated hour",
+			loc:  saoPaulo,
+			times: []string{
+				"2019-02-19T02:30:00Z", // 18/02 23:30 -03
+				"2019-02-18T02:30:00Z",
+				"2019-02-17T02:30:00Z", // 16/02 23:30 -03, a hora repetida
+				"2019-02-17T01:30:00Z", // 16/02 23:30 -02, mesmo dia
+				"2019-02-16T01:30:00Z",
+			},
+			today:   "2019-02-18",
+			current: 4,
+			longest: 4,
+		},
+		{
+			name: "sp fall back, repeated hour does not count for the next day",
+			loc:  saoPaulo,
+			times: []string{
+				"2019-02-19T02:30:00Z", // 18/02
+				"2019-02-17T02:30:00Z", // 16/02, não 17/02
+				"2019-02-16T01:30:00Z", // 15/02
+			},
+			today:   "2019-02-18",
+			current: 1,
+			longest: 2,
+		},
+		{
+			name: "berlin spring forward, 00:10 every morning",
+			loc:  berlin,
+			times: []string{
+				"2024-04-01T22:10:00Z", // 02/04 00:10 +02
+				"2024-03-31T22:10:00Z",
+				"2024-03-30T23:10:00Z", // 31/03 00:10 +01
+				"2024-03-29T23:10:00Z",
+				"2024-03-28T23:10:00Z",
+			},
+			today:   "2024-04-02",
+			current: 5,
+			longest: 5,
+		},
+		{
+			name: "berlin fall back, 23:55 every night",
+			loc:  berlin,
+			times: []string{
+				"2024-10-29T22:55:00Z", // 29/10 23:55 +01
+				"2024-10-28T22:55:00Z",
+				"2024-10-27T22:55:00Z", // 27/10, o dia de 25 horas
+				"2024-10-26T21:55:00Z", // 26/10 23:55 +02
+				"2024-10-25T21:55:00Z",
+			},
+			today:   "2024-10-29",
+			current: 5,
+			longest: 5,
+		},
+		{
+			name: "berlin fall back, today not done yet keeps the streak",
+			loc:  berlin,
+			times: []string{
+				"2024-10-27T22:55:00Z",
+				"2024-10-26T21:55:00Z",
+			},
+			today:   "2024-10-28",
+			current: 2,
+			longest: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := make([]time.Time, len(tt.times))
+			for i, s := range tt.times {
+				times[i] = utc(s)
+			}
+			dates := completionDates(times, tt.loc)
+			current, longest := dueDayStreaks(dates, date(tt.today), Schedule{}.isDue)
+			if current != tt.current || longest != tt.longest {
+				t.Errorf("streaks = (%d, %d), want (%d, %d)", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
+
+// Semanas (segunda a domingo) em Berlim: 00:30 de segunda, logo após a
+// troca para o horário de verão, ainda é domingo em UTC e precisa contar
+// para a semana nova
+func TestWeeklyStreaksAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	cal := Calendar{Loc: berlin, WeekStart: time.Monday}
+	schedule := Schedule{Type: scheduleWeekly, Times: 2}
+
+	times := []time.Time{
+		utc("2024-04-03T10:00:00Z"),
+		utc("2024-03-31T22:30:00Z"), // segunda 01/04 00:30 +02
+		utc("2024-03-28T11:00:00Z"),
+		utc("2024-03-26T11:00:00Z"),
+	}
+	_, longest := scheduleStreaks(schedule, completionDates(times, berlin), cal, nil)
+	if longest != 2 {
+		t.Errorf("longest = %d, want 2", longest)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Tokens de acesso pessoal para scripts e integrações. São aceitos no
+// header Authorization como os JWTs, mas só valem nas rotas listadas em
+// routeScopes e apenas com o escopo exigido; o resto da API (sessões, 2FA,
+// os próprios tokens) continua exigindo login.
+
+const accessTokenPrefix = "hpat_"
+
+const (
+	scopeHabitsRead    = "habits:read"
+	scopeHabitsWrite   = "habits:write"
+	scopeEntriesRead   = "entries:read"
+	scopeEntriesWrite  = "entries:write"
+	scopeSocialRead    = "social:read"
+	scopeSocialWrite   = "social:write"
+	scopeAnalyticsRead = "analytics:read"
+)
+
+var validScopes = map[string]bool{
+	scopeHabitsRead:    true,
+	scopeHabitsWrite:   true,
+	scopeEntriesRead:   true,
+	scopeEntriesWrite:  true,
+	scopeSocialRead:    true,
+	scopeSocialWrite:   true,
+	scopeAnalyticsRead: true,
+}
+
+// Escopo exigido por rota ("MÉTODO template"); rotas ausentes recusam tokens
+var routeScopes = map[string]string{
+	"GET /api/habits":                          scopeHabitsRead,
+	"POST /api/habits":                         scopeHabitsWrite,
+	"GET /api/habits/{id}":                     scopeHabitsRead,
+	"PUT /api/habits/{id}":                     scopeHabitsWrite,
+	"DELETE /api/habits/{id}":                  scopeHabitsWrite,
+	"GET /api/habits/deleted":                  scopeHabitsRead,
+	"PUT /api/habits/order":                    scopeHabitsWrite,
+	"POST /api/habits/{id}/archive":            scopeHabitsWrite,
+	"POST /api/habits/{id}/unarchive":          scopeHabitsWrite,
+	"POST /api/habits/{id}/restore":            scopeHabitsWrite,
+	"GET /api/habits/{id}/stats":               scopeHabitsRead,
+	"POST /api/habits/{id}/reminders/snooze":   scopeHabitsWrite,
+	"GET /api/habits/{id}/reminder-suggestion": scopeHabitsRead,
+	"GET /api/habits/{id}/goal-completions":    scopeHabitsRead,
+	"POST /api/habits/{id}/goal-completions":   scopeHabitsWrite,
+	"GET /api/habits/{id}/check-goal":          scopeHabitsRead,
+	"POST /api/habits/{id}/reset-goal":         scopeHabitsWrite,
+	"GET /api/habits/{id}/skips":               scopeHabitsRead,
+	"POST /api/habits/{id}/skips":              scopeHabitsWrite,
+	"DELETE /api/habits/{id}/skips/{date}":     scopeHabitsWrite,
+	"GET /api/pauses":                          scopeHabitsRead,
+	"POST /api/pauses":                         scopeHabitsWrite,
+	"DELETE /api/pauses/{id}":                  scopeHabitsWrite,
+	"GET /api/streak-freezes":                  scopeHabitsRead,
+	"GET /api/tags":                            scopeHabitsRead,
+	"PUT /api/tags/{id}":                       scopeHabitsWrite,
+	"DELETE /api/tags/{id}":                    scopeHabitsWrite,
+	"GET /api/habit-views":                     scopeHabitsRead,
+	"POST /api/habit-views":                    scopeHabitsWrite,
+	"PUT /api/habit-views/{id}":                scopeHabitsWrite,
+	"DELETE /api/habit-views/{id}":             scopeHabitsWrite,
+
+	"GET /api/habits/{id}/entries":                   scopeEntriesRead,
+	"POST /api/habits/{id}/entries":                  scopeEntriesWrite,
+	"POST /api/habits/{id}/entries/bulk":             scopeEntriesWrite,
+	"GET /api/habits/{id}/entries/history":           scopeEntriesRead,
+	"PUT /api/habits/{id}/entries/{entryId}":         scopeEntriesWrite,
+	"DELETE /api/habits/{id}/entries/{entryId}":      scopeEntriesWrite,
+	"GET /api/habits/{id}/entries/{entryId}/history": scopeEntriesRead,
+
+	"GET /api/friends":                      scopeSocialRead,
+	"GET /api/friends/requests":             scopeSocialRead,
+	"POST /api/friends/request":             scopeSocialWrite,
+	"PUT /api/friends/{id}/accept":          scopeSocialWrite,
+	"DELETE /api/friends/{id}/cancel":       scopeSocialWrite,
+	"DELETE /api/friends/{id}":              scopeSocialWrite,
+	"GET /api/feed":                         scopeSocialRead,
+	"POST /api/activities/{id}/react":       scopeSocialWrite,
+	"DELETE /api/activities/{id}/react":     scopeSocialWrite,
+	"POST /api/activities/{id}/comment":     scopeSocialWrite,
+	"GET /api/activities/{id}/comments":     scopeSocialRead,
+	"GET /api/groups":                       scopeSocialRead,
+	"POST /api/groups":                      scopeSocialWrite,
+	"GET /api/groups/{id}":                  scopeSocialRead,
+	"PUT /api/groups/{id}":                  scopeSocialWrite,
+	"DELETE /api/groups/{id}":               scopeSocialWrite,
+	"POST /api/groups/{id}/join":            scopeSocialWrite,
+	"DELETE /api/groups/{id}/leave":         scopeSocialWrite,
+	"GET /api/groups/{id}/members":          scopeSocialRead,
+	"GET /api/challenges":                   scopeSocialRead,
+	"GET /api/groups/{groupId}/challenges":  scopeSocialRead,
+	"POST /api/groups/{groupId}/challenges": scopeSocialWrite,
+	"GET /api/challenges/{id}":              scopeSocialRead,
+	"PUT /api/challenges/{id}":              scopeSocialWrite,
+	"DELETE /api/challenges/{id}":           scopeSocialWrite,
+	"POST /api/challenges/{id}/join":        scopeSocialWrite,
+	"DELETE /api/challenges/{id}/leave":     scopeSocialWrite,
+	"PUT /api/challenges/{id}/progress":     scopeSocialWrite,
+	"GET /api/challenges/{id}/participants": scopeSocialRead,
+
+	"GET /api/analytics": scopeAnalyticsRead,
+}
+
+type AccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // início do token, para identificá-lo na lista
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 = sem expiração
+}
+
+type CreateAccessTokenResponse struct {
+	AccessToken
+	Token string `json:"token"` // exibido apenas na criação
+}
+
+func (t *AccessToken) hasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Autentica um token de acesso pessoal e confere o escopo da rota
+func authenticateAccessToken(w http.ResponseWriter, r *http.Request, raw string) (int, bool) {
+	token, err := store.FindAccessToken(hashToken(raw))
+	if err != nil || token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Error loading access token: %v", err)
+		}
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	key := r.Method
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			key += " " + template
+		}
+	}
+	scope, allowed := routeScopes[key]
+	if !allowed {
+		http.Error(w, "This endpoint is not available to access tokens", http.StatusForbidden)
+		return 0, false
+	}
+	if !token.hasScope(scope) {
+		http.Error(w, "Token is missing the "+scope+" scope", http.StatusForbidden)
+		return 0, false
+	}
+
+	if now := time.Now(); token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > sessionTouchInterval {
+		if err := store.TouchAccessToken(token.ID, now); err != nil {
+			log.Printf("Error updating access token %d: %v", token.ID, err)
+		}
+	}
+	return token.UserID, true
+}
+
+func createAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	var req CreateAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		http.Error(w, "Name is required (up to 100 characters)", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	seen := map[string]bool{}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			http.Error(w, "Unknown scope "+strconv.Quote(scope), http.StatusBadRequest)
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "expires_in_days must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := newRefreshToken()
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	raw := accessTokenPrefix + secret
+
+	token := AccessToken{
+		UserID: userID,
+		Name:   req.Name,
+		Prefix: raw[:len(accessTokenPrefix)+6],
+		Scopes: scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := store.CreateAccessToken(&token, hashToken(raw)); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAccessTokenResponse{AccessToken: token, Token: raw})
+}
+
+func getAccessTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := store.ListAccessTokens(getUserID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []AccessToken{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func revokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.RevokeAccessToken(getUserID(r), tokenID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
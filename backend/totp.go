@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Autenticação em dois fatores com TOTP (RFC 6238: HMAC-SHA1, passos de
+// 30 segundos, 6 dígitos). Com o 2FA ativo o login tem duas etapas: a
+// senha devolve um challenge token de vida curta e /auth/2fa/verify troca
+// esse token mais um código (ou código de recuperação) pela AuthResponse.
+
+const (
+	totpIssuer = "Habit Tracker"
+	totpPeriod = 30
+	totpDigits = 6
+	// Passos aceitos antes e depois do atual, para relógios dessincronizados
+	totpSkew = 1
+
+	purposeTwoFactorLogin  = "2fa_login"
+	challengeTokenLifetime = 5 * time.Minute
+
+	recoveryCodeCount = 10
+)
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// Ações sensíveis exigem a senha e um código atual
+type TwoFactorReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+func totpURI(secret, account string) string {
+	label := url.PathEscape(totpIssuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Código HOTP (RFC 4226) para o contador informado
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// Devolve o passo em que o código é válido, ou -1
+func matchTOTP(secret, code string, at time.Time) int64 {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return -1
+	}
+
+	current := at.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(b)) // 8 caracteres
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// Confere um código TOTP (sem reutilização) ou um código de recuperação
+func checkSecondFactor(userID int, secret, code string) (bool, error) {
+	code = normalizeCode(code)
+	if step := matchTOTP(secret, code, time.Now()); step >= 0 {
+		err := store.UseTOTPStep(userID, step)
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err := store.UseRecoveryCode(userID, hashToken(code))
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Confere senha e segundo fator do usuário autenticado
+func reauthenticate(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID := getUserID(r)
+
+	var req TwoFactorReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return 0, false
+	}
+
+	passwordHash, err := store.GetPasswordHash(userID)
+	if err != nil || !checkPasswordHash(req.Password, passwordHash) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	secret, enabled, err := store.GetTOTP(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return 0, false
+	}
+
+	ok, err := checkSecondFactor(userID, secret, req.Code)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
+
+// Primeira etapa do login com 2FA: devolve o challenge token
+func writeTwoFactorChallenge(w http.ResponseWriter, user *User, passwordHash string) {
+	token, err := signPurposeToken(purposeTwoFactorLogin, user.ID, challengeTokenLifetime,
+		jwt.MapClaims{"fp": passwordFingerprint(passwordHash)})
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TwoFactorChallengeResponse{TwoFactorRequired: true, ChallengeToken: token})
+}
+
+// Segunda etapa do login: challenge token + código
+func verifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, claims, err := parsePurposeToken(req.ChallengeToken, purposeTwoFactorLogin)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	// A senha pode ter mudado depois do desafio
+	passwordHash, err := store.GetPasswordHash(userID)
+	if err != nil || claims["fp"] != passwordFingerprint(passwordHash) {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := store.GetUser(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	// Os códigos contam para o mesmo bloqueio da senha
+	if !checkLockout(w, r, user.Email) {
+		return
+	}
+
+	secret, enabled, err := store.GetTOTP(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		ok, err := checkSecondFactor(userID, secret, req.Code)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			recordLoginFailure(r, user.Email, user)
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+	}
+	clearLoginFailures(user.Email)
+
+	response, err := startSession(r, *user)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Gera um novo segredo pendente; só passa a valer depois do confirm
+func enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+	if err := store.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TwoFactorEnrollResponse{Secret: secret, OTPAuthURI: totpURI(secret, user.Email)})
+}
+
+// Confirma o segredo pendente com um código e devolve os códigos de recuperação
+func confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := store.GetTOTP(userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if secret == "" {
+		http.Error(w, "Start enrollment first", http.StatusBadRequest)
+		return
+	}
+
+	step := matchTOTP(secret, normalizeCode(req.Code), time.Now())
+	if step < 0 || store.UseTOTPStep(userID, step) != nil {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := store.EnableTOTP(userID, hashes); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %d", userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+func disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := store.DisableTOTP(userID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user %d", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Invalida os códigos de recuperação anteriores e gera novos
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := store.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validação dos corpos de Habit, CreateGroupRequest, CreateChallengeRequest
+// e UpdateProgressRequest. Todas as regras são verificadas de uma vez e a
+// resposta é 422 com os erros por campo, para o formulário mostrar cada
+// mensagem ao lado do campo:
+//
+//	{"error": "validation_failed", "message": "...",
+//	 "fields": {"name": ["Nome é obrigatório"]},
+//	 "errors": [{"field": "name", "code": "required", "message": "Nome é obrigatório"}]}
+//
+// Campos de listas usam o índice, como "reminder_times[1]". As mensagens
+// são em português, como os formulários que as mostram.
+
+const (
+	maxHabitNameLength        = 100
+	maxHabitDescriptionLength = 2000
+	maxHabitCategoryLength    = 50
+	maxHabitIconLength        = 50
+	maxReminderTimes          = 10
+
+	maxGroupNameLength        = 100
+	maxGroupDescriptionLength = 1000
+	maxChallengeNameLength    = 100
+	maxChallengeUnitLength    = 20
+	maxProgressNotesLength    = 500
+)
+
+var habitVisibilities = []string{"public", "private", "friends"}
+var groupPrivacies = []string{"public", "private", "invite_only"}
+var challengeGoalTypes = []string{"count", "streak", "weekly", "monthly"}
+
+// Erro de um campo; os validadores que retornam error usam este tipo para
+// indicar o campo, e quem só testa != nil continua funcionando
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"` // required, invalid, too_long, too_many, out_of_range
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func fieldError(field, code, message string) *FieldError {
+	return &FieldError{Field: field, Code: code, Message: message}
+}
+
+type ValidationErrors []*FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Field + ": " + e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (v *ValidationErrors) add(field, code, message string) {
+	*v = append(*v, fieldError(field, code, message))
+}
+
+// Acrescenta err, se houver; sem campo próprio, vale field
+func (v *ValidationErrors) check(field string, err error) {
+	if err == nil {
+		return
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		*v = append(*v, fe)
+		return
+	}
+	v.add(field, "invalid", err.Error())
+}
+
+// Texto obrigatório (já sem espaços nas pontas) com tamanho máximo
+func (v *ValidationErrors) text(field, value string, required bool, max int, requiredMsg, tooLongMsg string) {
+	if required && value == "" {
+		v.add(field, "required", requiredMsg)
+	} else if utf8.RuneCountInString(value) > max {
+		v.add(field, "too_long", tooLongMsg)
+	}
+}
+
+func (v *ValidationErrors) oneOf(field, value string, allowed []string, message string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, "invalid", message)
+}
+
+// Responde 422 se houver erros; false quando a requisição é válida
+func writeValidationErrors(w http.ResponseWriter, message string, errs ValidationErrors) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	fields := map[string][]string{}
+	for _, e := range errs {
+		fields[e.Field] = append(fields[e.Field], e.Message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "validation_failed",
+		"message": message,
+		"fields":  fields,
+		"errors":  errs,
+	})
+	return true
+}
+
+// Valida os horários HH:MM e devolve a lista sem repetições, em ordem
+func normalizeReminderTimes(times []string) ([]string, ValidationErrors) {
+	var errs ValidationErrors
+	if len(times) > maxReminderTimes {
+		errs.add("reminder_times", "too_many", fmt.Sprintf("No máximo %d horários de lembrete são permitidos", maxReminderTimes))
+		return nil, errs
+	}
+	seen := map[string]bool{}
+	normalized := []string{}
+	for i, t := range times {
+		minutes, err := parseClock(strings.TrimSpace(t))
+		if err != nil {
+			errs.add(fmt.Sprintf("reminder_times[%d]", i), "invalid", "Horário do lembrete deve estar no formato HH:MM")
+			continue
+		}
+		if clock := formatClock(minutes); !seen[clock] {
+			seen[clock] = true
+			normalized = append(normalized, clock)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, errs
+}
+
+// Valida e normaliza o hábito vindo do cliente (nome sem espaços, padrões
+// de polaridade e modo de lembrete, horários e etiquetas normalizados).
+// Agenda e período da meta dependem do fuso e ficam com o handler.
+func (h *Habit) validate() ValidationErrors {
+	var errs ValidationErrors
+
+	h.Name = strings.TrimSpace(h.Name)
+	errs.text("name", h.Name, true, maxHabitNameLength,
+		"Nome é obrigatório", fmt.Sprintf("Nome deve ter no máximo %d caracteres", maxHabitNameLength))
+	errs.text("description", h.Description, false, maxHabitDescriptionLength,
+		"", fmt.Sprintf("Descrição deve ter no máximo %d caracteres", maxHabitDescriptionLength))
+	errs.text("category", h.Category, false, maxHabitCategoryLength,
+		"", fmt.Sprintf("Categoria deve ter no máximo %d caracteres", maxHabitCategoryLength))
+	errs.text("icon", h.Icon, false, maxHabitIconLength,
+		"", fmt.Sprintf("Ícone deve ter no máximo %d caracteres", maxHabitIconLength))
+
+	if h.Goal < 0 {
+		errs.add("goal", "out_of_range", "Meta não pode ser negativa")
+	}
+	errs.check("goal_type", h.periodSpec().validate())
+	errs.oneOf("visibility", h.Visibility, habitVisibilities, "Visibilidade deve ser public, private ou friends")
+	errs.check("unit", validateHabitAmount(h))
+	errs.check("polarity", validatePolarity(h))
+	errs.check("schedule", h.Schedule.validate())
+
+	if h.ReminderTime != "" {
+		if minutes, err := parseClock(h.ReminderTime); err != nil {
+			errs.add("reminder_time", "invalid", "Horário do lembrete deve estar no formato HH:MM")
+		} else {
+			h.ReminderTime = formatClock(minutes)
+			// Clientes antigos mandam só reminder_time
+			if len(h.ReminderTimes) == 0 {
+				h.ReminderTimes = []string{h.ReminderTime}
+			}
+		}
+	}
+	times, timeErrs := normalizeReminderTimes(h.ReminderTimes)
+	errs = append(errs, timeErrs...)
+	if len(timeErrs) == 0 {
+		h.ReminderTimes = times
+		if h.ReminderEnabled && len(times) == 0 && h.ReminderMode != reminderModeAdaptive {
+			errs.add("reminder_times", "required", "Informe ao menos um horário quando os lembretes estão ativados")
+		}
+	}
+	errs.check("reminder_mode", validateReminderMode(h))
+
+	tags, err := normalizeTags(h.Tags)
+	errs.check("tags", err)
+	if err == nil {
+		h.Tags = tags
+	}
+	return errs
+}
+
+// Privacidade vazia vira "public"
+func (req *CreateGroupRequest) validate() ValidationErrors {
+	var errs ValidationErrors
+
+	req.Name = strings.TrimSpace(req.Name)
+	errs.text("name", req.Name, true, maxGroupNameLength,
+		"Nome do grupo é obrigatório", fmt.Sprintf("Nome do grupo deve ter no máximo %d caracteres", maxGroupNameLength))
+	errs.text("description", req.Description, false, maxGroupDescriptionLength,
+		"", fmt.Sprintf("Descrição deve ter no máximo %d caracteres", maxGroupDescriptionLength))
+	if req.Privacy == "" {
+		req.Privacy = "public"
+	}
+	errs.oneOf("privacy", req.Privacy, groupPrivacies, "Privacidade deve ser public, private ou invite_only")
+	return errs
+}
+
+// Aplica os padrões (meta streak de 7 dias) antes de validar; as datas já
+// devem estar no fuso de quem cria (localChallengeDates)
+func (req *CreateChallengeRequest) validate() ValidationErrors {
+	var errs ValidationErrors
+
+	req.Name = strings.TrimSpace(req.Name)
+	errs.text("name", req.Name, true, maxChallengeNameLength,
+		"Nome do desafio é obrigatório", fmt.Sprintf("Nome do desafio deve ter no máximo %d caracteres", maxChallengeNameLength))
+	req.HabitName = strings.TrimSpace(req.HabitName)
+	errs.text("habit_name", req.HabitName, true, maxHabitNameLength,
+		"Nome do hábito é obrigatório", fmt.Sprintf("Nome do hábito deve ter no máximo %d caracteres", maxHabitNameLength))
+	req.Unit = strings.TrimSpace(req.Unit)
+	errs.text("unit", req.Unit, false, maxChallengeUnitLength,
+		"", fmt.Sprintf("Unidade deve ter no máximo %d caracteres", maxChallengeUnitLength))
+
+	if req.GoalType == "" {
+		req.GoalType = "streak"
+	}
+	errs.oneOf("goal_type", req.GoalType, challengeGoalTypes, "Tipo de meta deve ser count, streak, weekly ou monthly")
+	if req.GoalValue == 0 {
+		req.GoalValue = 7 // 7 dias por padrão
+	}
+	if req.GoalValue < 0 {
+		errs.add("goal_value", "out_of_range", "Meta deve ser maior que zero")
+	}
+
+	if req.StartDate.IsZero() {
+		errs.add("start_date", "required", "Data de início é obrigatória")
+	}
+	if req.EndDate.IsZero() {
+		errs.add("end_date", "required", "Data de término é obrigatória")
+	}
+	if !req.StartDate.IsZero() && !req.EndDate.IsZero() && req.EndDate.Before(req.StartDate) {
+		errs.add("end_date", "out_of_range", "Data de término não pode ser anterior à data de início")
+	}
+	return errs
+}
+
+func (req *UpdateProgressRequest) validate() ValidationErrors {
+	var errs ValidationErrors
+	if req.Progress < 0 {
+		errs.add("progress", "out_of_range", "Progresso não pode ser negativo")
+	}
+	errs.text("notes", req.Notes, false, maxProgressNotesLength,
+		"", fmt.Sprintf("Notas devem ter no máximo %d caracteres", maxProgressNotesLength))
+	return errs
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Redefinição de senha e verificação de e-mail. Os tokens são JWTs
+// assinados com um "purpose" próprio, então não servem como access token.
+// O de redefinição carrega uma impressão do hash da senha atual e deixa de
+// valer assim que a senha muda; o de verificação carrega o e-mail e deixa
+// de valer se o e-mail for trocado.
+
+const (
+	purposeResetPassword = "reset_password"
+	purposeVerifyEmail   = "verify_email"
+
+	resetTokenLifetime  = time.Hour
+	verifyTokenLifetime = 48 * time.Hour
+
+	minPasswordLength = 8
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+func signPurposeToken(purpose string, userID int, lifetime time.Duration, extra jwt.MapClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose": purpose,
+		"user_id": userID,
+		"exp":     time.Now().Add(lifetime).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// Valida assinatura, validade e propósito; devolve as claims
+func parsePurposeToken(tokenString, purpose string) (int, jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return 0, nil, errInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return 0, nil, errInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, nil, errInvalidToken
+	}
+	return int(userID), claims, nil
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func appLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", config.AppURL, path, url.QueryEscape(token))
+}
+
+// Mensagem com texto simples e uma versão HTML com o botão do link
+func linkMail(to, subject, intro, action, link, outro string) Mail {
+	text := fmt.Sprintf("%s\n\n%s: %s\n\n%s\n", intro, action, link, outro)
+	htmlBody := fmt.Sprintf(`<p>%s</p><p><a href="%s">%s</a></p><p>%s</p>`,
+		html.EscapeString(intro), html.EscapeString(link), html.EscapeString(action), html.EscapeString(outro))
+	return Mail{To: to, Subject: subject, Text: text, HTML: htmlBody}
+}
+
+func sendVerificationEmail(user User) error {
+	token, err := signPurposeToken(purposeVerifyEmail, user.ID, verifyTokenLifetime, jwt.MapClaims{"email": user.Email})
+	if err != nil {
+		return err
+	}
+	return mailer.Send(linkMail(user.Email,
+		"Confirme seu e-mail",
+		fmt.Sprintf("Olá, %s! Confirme seu endereço de e-mail para ativar todos os recursos do Habit Tracker.", user.Username),
+		"Confirmar e-mail",
+		appLink("/verify-email", token),
+		"O link vale por 48 horas. Se você não criou esta conta, ignore esta mensagem."))
+}
+
+func sendPasswordResetEmail(user User, passwordHash string) error {
+	token, err := signPurposeToken(purposeResetPassword, user.ID, resetTokenLifetime,
+		jwt.MapClaims{"fp": passwordFingerprint(passwordHash)})
+	if err != nil {
+		return err
+	}
+	return mailer.Send(linkMail(user.Email,
+		"Redefinição de senha",
+		fmt.Sprintf("Olá, %s! Recebemos um pedido para redefinir a sua senha.", user.Username),
+		"Redefinir senha",
+		appLink("/reset-password", token),
+		"O link vale por 1 hora e só pode ser usado uma vez. Se você não pediu a redefinição, ignore esta mensagem."))
+}
+
+// Sempre responde 202 para não revelar quais e-mails têm conta
+func forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, passwordHash, err := store.GetUserByEmail(req.Email)
+	if err == nil {
+		if err := sendPasswordResetEmail(*user, passwordHash); err != nil {
+			log.Printf("Error sending password reset to user %d: %v", user.ID, err)
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		log.Printf("Error looking up user for password reset: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the email is registered, a reset link has been sent"})
+}
+
+func resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	userID, claims, err := parsePurposeToken(req.Token, purposeResetPassword)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	// Token de uso único: a impressão muda junto com a senha
+	currentHash, err := store.GetPasswordHash(userID)
+	if err != nil || claims["fp"] != passwordFingerprint(currentHash) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+	if err := store.UpdatePassword(userID, hashedPassword); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Quem tinha a senha antiga perde as sessões abertas
+	if err := store.RevokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions after password reset for user %d: %v", userID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated"})
+}
+
+func verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, claims, err := parsePurposeToken(req.Token, purposeVerifyEmail)
+	email, _ := claims["email"].(string)
+	if err != nil || email == "" {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.MarkEmailVerified(userID, email); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// Reenvia o e-mail de verificação para o usuário autenticado
+func resendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUser(getUserID(r))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	if err := sendVerificationEmail(*user); err != nil {
+		log.Printf("Error sending verification to user %d: %v", user.ID, err)
+		http.Error(w, "Error sending email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Web Push: payload cifrado com aes128gcm (RFC 8188 e RFC 8291) e
+// autenticação do servidor com VAPID (RFC 8292). As chaves usam o formato
+// dos navegadores: P-256 em base64url sem padding, a pública como ponto
+// não comprimido (65 bytes) e a privada como o escalar (32 bytes).
+
+const (
+	pushRecordSize = 4096
+	// Tamanho máximo do texto claro num único registro (RFC 8291, seção 4)
+	maxPushPayload = 3993
+	vapidTokenTTL  = 12 * time.Hour
+)
+
+// O serviço de push informou que a inscrição não existe mais (404 ou 410)
+var errPushGone = errors.New("push subscription expired")
+
+type vapidKeys struct {
+	private *ecdh.PrivateKey
+	// Chave pública em base64url, usada como applicationServerKey
+	Public string
+}
+
+func newVAPIDKeys() (*vapidKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &vapidKeys{private: key, Public: b64(key.PublicKey().Bytes())}, nil
+}
+
+func parseVAPIDKeys(publicKey, privateKey string) (*vapidKeys, error) {
+	raw, err := unb64(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	keys := &vapidKeys{private: key, Public: b64(key.PublicKey().Bytes())}
+	if publicKey != "" && strings.TrimRight(publicKey, "=") != keys.Public {
+		return nil, errors.New("VAPID public key does not match the private key")
+	}
+	return keys, nil
+}
+
+func (k *vapidKeys) privateString() string {
+	return b64(k.private.Bytes())
+}
+
+// Chave de assinatura ES256 equivalente à chave ECDH
+func (k *vapidKeys) signingKey() *ecdsa.PrivateKey {
+	pub := k.private.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:65]),
+		},
+		D: new(big.Int).SetBytes(k.private.Bytes()),
+	}
+}
+
+// Cabeçalho Authorization do VAPID para a origem do endpoint
+func (k *vapidKeys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidTokenTTL).Unix(),
+		"sub": subject,
+	})
+	signed, err := token.SignedString(k.signingKey())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, k.Public), nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Aceita base64url com ou sem padding
+func unb64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Chaves de cifra do registro (RFC 8291, seção 3.4)
+func pushContentKeys(authSecret, ecdhSecret, uaPublic, asPublic, salt []byte) (key, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, ecdhSecret, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	return key, nonce, err
+}
+
+func gcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Cifra o payload para a inscrição num único registro aes128gcm, com uma
+// chave efêmera do servidor no cabeçalho
+func encryptPushPayload(keys PushKeys, plaintext []byte) ([]byte, error) {
+	if len(plaintext) > maxPushPayload {
+		return nil, fmt.Errorf("push payload too large (%d bytes)", len(plaintext))
+	}
+	uaPublicBytes, err := unb64(keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := unb64(keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	key, nonce, err := pushContentKeys(authSecret, ecdhSecret, uaPublicBytes, asPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := gcm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cabeçalho: salt, tamanho do registro, tamanho e valor do keyid
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(pushRecordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	// Delimitador 0x02: último (e único) registro, sem padding
+	record := append(append([]byte{}, plaintext...), 0x02)
+	body.Write(aead.Seal(nil, nonce, record, nil))
+	return body.Bytes(), nil
+}
+
+// Decifra um payload aes128gcm de um único registro com a chave privada e
+// o segredo da inscrição (lado do navegador; usado pelo serviço local)
+func decryptPushPayload(uaPrivate *ecdh.PrivateKey, authSecret, body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("truncated aes128gcm header")
+	}
+	salt := body[:16]
+	idLen := int(body[20])
+	if len(body) < 21+idLen {
+		return nil, errors.New("truncated aes128gcm header")
+	}
+	asPublicBytes := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keyid: %w", err)
+	}
+	ecdhSecret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	key, nonce, err := pushContentKeys(authSecret, ecdhSecret, uaPrivate.PublicKey().Bytes(), asPublicBytes, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := gcm(key)
+	if err != nil {
+		return nil, err
+	}
+	record, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove o padding (zeros) e o delimitador
+	record = bytes.TrimRight(record, "\x00")
+	if len(record) == 0 || record[len(record)-1] != 0x02 {
+		return nil, errors.New("invalid record delimiter")
+	}
+	return record[:len(record)-1], nil
+}
+
+type webPushSender struct {
+	keys    *vapidKeys
+	subject string
+	client  *http.Client
+}
+
+// Envia o payload cifrado para a inscrição; errPushGone se ela expirou
+func (s *webPushSender) send(sub *PushSubscription, payload []byte, ttl time.Duration) error {
+	body, err := encryptPushPayload(sub.Keys, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := s.keys.authorization(sub.Endpoint, s.subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errPushGone
+	case resp.StatusCode >= 300:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
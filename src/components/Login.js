@@ -7,7 +7,9 @@ const Login = () => {
   const [credentials, setCredentials] = useState({ email: '', password: '' });
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
-  const { login, isAuthenticated } = useApi();
+  const [challengeToken, setChallengeToken] = useState('');
+  const [code, setCode] = useState('');
+  const { login, verifyTwoFactor, isAuthenticated } = useApi();
   const navigate = useNavigate();
 
   // Redirecionar se já estiver autenticado
@@ -23,7 +25,17 @@ const Login = () => {
     setError('');
 
     try {
-      await login(credentials);
+      if (challengeToken) {
+        await verifyTwoFactor(challengeToken, code);
+        navigate('/');
+        return;
+      }
+
+      const response = await login(credentials);
+      if (response.two_factor_required) {
+        setChallengeToken(response.challenge_token);
+        return;
+      }
       navigate('/');
     } catch (err) {
       setError(err.message);
@@ -84,12 +96,31 @@ const Login = () => {
             />
           </div>
 
+          {challengeToken && (
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">
+                Código de verificação
+              </label>
+              <input
+                type="text"
+                name="code"
+                required
+                autoFocus
+                autoComplete="one-time-code"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                className="w-full px-3 sm:px-4 py-2.5 sm:py-3 border border-gray-300 rounded-lg focus:border-gray-500 focus:ring-1 focus:ring-gray-500 transition-all duration-200 text-base"
+                placeholder="Código do app ou de recuperação"
+              />
+            </div>
+          )}
+
           <button
             type="submit"
             disabled={loading}
             className="w-full bg-gray-900 text-white py-2.5 sm:py-3 px-4 rounded-lg font-medium hover:bg-gray-800 focus:outline-none focus:ring-2 focus:ring-gray-500 focus:ring-offset-2 disabled:opacity-50 disabled:cursor-not-allowed transition-all duration-200 text-base"
           >
-            {loading ? 'Entrando...' : 'Entrar'}
+            {loading ? 'Entrando...' : challengeToken ? 'Verificar' : 'Entrar'}
           </button>
         </form>
 
@@ -8,7 +8,7 @@ class ApiService {
   }
 
   // Método auxiliar para fazer requisições
-  async request(url, options = {}) {
+  async request(url, options = {}, retried = false) {
     // Garantir que temos o token mais atual do localStorage
     this.token = localStorage.getItem('authToken');
     
@@ -28,13 +28,27 @@ class ApiService {
     try {
       const response = await fetch(`${this.baseURL}${url}`, config);
       
-      // Se o token expirou, limpar e redirecionar
+      // Se o access token expirou, tentar renovar uma vez com o refresh token
+      if (response.status === 401 && !retried && url !== '/auth/refresh' && await this.refreshSession()) {
+        return this.request(url, options, true);
+      }
+
+      // Sessão expirada ou revogada, limpar e redirecionar
       if (response.status === 401) {
         this.clearAuth();
         window.location.href = '/login';
         throw new Error('Token expirado');
       }
 
+      // Erros de validação: error.fields traz as mensagens por campo
+      if (response.status === 422) {
+        const data = await response.json();
+        const messages = Object.values(data.fields || {}).flat();
+        const error = new Error(messages.join('\n') || data.message);
+        error.fields = data.fields || {};
+        throw error;
+      }
+
       if (!response.ok) {
         const errorData = await response.text();
         throw new Error(errorData || `HTTP error! status: ${response.status}`);
@@ -53,15 +67,49 @@ class ApiService {
   }
 
   // Método para definir o token
-  setToken(token) {
+  setToken(token, refreshToken) {
     this.token = token;
     localStorage.setItem('authToken', token);
+    if (refreshToken) {
+      localStorage.setItem('refreshToken', refreshToken);
+    }
+  }
+
+  // Troca o refresh token por um novo par de tokens
+  async refreshSession() {
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) {
+      return false;
+    }
+
+    // Requisições simultâneas compartilham a mesma renovação
+    if (!this.refreshing) {
+      this.refreshing = fetch(`${this.baseURL}/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      })
+        .then(async (response) => {
+          if (!response.ok) {
+            return false;
+          }
+          const data = await response.json();
+          this.setToken(data.token, data.refresh_token);
+          return true;
+        })
+        .catch(() => false)
+        .finally(() => {
+          this.refreshing = null;
+        });
+    }
+    return this.refreshing;
   }
 
   // Método para limpar autenticação
   clearAuth() {
     this.token = null;
     localStorage.removeItem('authToken');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('user');
   }
 
@@ -81,7 +129,7 @@ class ApiService {
     });
     
     if (response.token) {
-      this.setToken(response.token);
+      this.setToken(response.token, response.refresh_token);
       localStorage.setItem('user', JSON.stringify(response.user));
     }
     
@@ -95,14 +143,51 @@ class ApiService {
     });
     
     if (response.token) {
-      this.setToken(response.token);
+      this.setToken(response.token, response.refresh_token);
       localStorage.setItem('user', JSON.stringify(response.user));
     }
     return response;
   }
 
-  logout() {
-    this.clearAuth();
+  // Segunda etapa do login quando o 2FA está ativo
+  async verifyTwoFactor(challengeToken, code) {
+    const response = await this.request('/auth/2fa/verify', {
+      method: 'POST',
+      body: JSON.stringify({ challenge_token: challengeToken, code }),
+    });
+
+    if (response.token) {
+      this.setToken(response.token, response.refresh_token);
+      localStorage.setItem('user', JSON.stringify(response.user));
+    }
+    return response;
+  }
+
+  async logout() {
+    try {
+      await this.request('/auth/logout', { method: 'POST' }, true);
+    } catch (error) {
+      // A sessão local é limpa mesmo se o servidor não responder
+    } finally {
+      this.clearAuth();
+    }
+  }
+
+  async logoutAllSessions() {
+    try {
+      await this.request('/auth/logout-all', { method: 'POST' }, true);
+    } finally {
+      this.clearAuth();
+    }
+  }
+
+  async getSessions() {
+    const data = await this.request('/auth/sessions');
+    return Array.isArray(data) ? data : [];
+  }
+
+  async revokeSession(sessionId) {
+    return await this.request(`/auth/sessions/${sessionId}`, { method: 'DELETE' });
   }
 
   getCurrentUser() {
@@ -438,6 +523,10 @@ export const ApiProvider = ({ children }) => {
   const login = async (credentials) => {
     try {
       const response = await api.login(credentials);
+      // Com 2FA a sessão só começa depois do código
+      if (response.two_factor_required) {
+        return response;
+      }
       setUser(response.user);
       setIsAuthenticated(true);
       return response;
@@ -446,6 +535,13 @@ export const ApiProvider = ({ children }) => {
     }
   };
 
+  const verifyTwoFactor = async (challengeToken, code) => {
+    const response = await api.verifyTwoFactor(challengeToken, code);
+    setUser(response.user);
+    setIsAuthenticated(true);
+    return response;
+  };
+
   const register = async (userData) => {
     try {
       const response = await api.register(userData);
@@ -467,6 +563,7 @@ export const ApiProvider = ({ children }) => {
     api,
     user,
     login,
+    verifyTwoFactor,
     register,
     logout,
     isAuthenticated,